@@ -5,9 +5,15 @@ go 1.24.3
 require github.com/spf13/cobra v1.9.1
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/alecthomas/chroma v0.10.0
 	github.com/briandowns/spinner v1.23.2
 	github.com/mattn/go-colorable v0.1.13
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/spf13/pflag v1.0.6
+	golang.org/x/sys v0.25.0
+	golang.org/x/term v0.1.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -15,7 +21,4 @@ require (
 	github.com/fatih/color v1.7.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/spf13/pflag v1.0.6 // indirect
-	golang.org/x/sys v0.25.0 // indirect
-	golang.org/x/term v0.1.0 // indirect
 )
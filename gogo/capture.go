@@ -0,0 +1,75 @@
+package gogo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// capturedValue turns captured stdout into a variable value. With no field the
+// trimmed output is used as-is; otherwise the output is parsed as JSON and the
+// dotted field path (e.g. "vm.id" or "items.0.name") is looked up.
+func capturedValue(output, field string) (string, error) {
+	output = strings.TrimSpace(output)
+	if field == "" {
+		return output, nil
+	}
+
+	// Numbers are kept as written, so IDs don't come out as 1.2345678e+07
+	dec := json.NewDecoder(strings.NewReader(output))
+	dec.UseNumber()
+	var data interface{}
+	err := dec.Decode(&data)
+	if err == nil && dec.More() {
+		err = errors.New("unexpected text after the JSON value")
+	}
+	if err != nil {
+		return "", fmt.Errorf("output is not JSON, so field '%s' can't be read (try ConvertTo-Json): %w", field, err)
+	}
+	for _, part := range strings.Split(field, ".") {
+		switch node := data.(type) {
+		case map[string]interface{}:
+			val, ok := node[part]
+			if !ok {
+				// PowerShell property names are case-insensitive, so match them that way too
+				for k, v := range node {
+					if strings.EqualFold(k, part) {
+						val, ok = v, true
+						break
+					}
+				}
+			}
+			if !ok {
+				return "", fmt.Errorf("field '%s' not found in output", field)
+			}
+			data = val
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return "", fmt.Errorf("field '%s': '%s' is not a valid index into a list of %d", field, part, len(node))
+			}
+			data = node[idx]
+		default:
+			return "", fmt.Errorf("field '%s': '%s' has no fields", field, part)
+		}
+	}
+
+	switch v := data.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+}
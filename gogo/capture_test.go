@@ -0,0 +1,38 @@
+package gogo
+
+import "testing"
+
+func TestCapturedValue(t *testing.T) {
+	output := `{"vm": {"id": 12345678, "size": 1.5, "big": 123456789012345678901, "ready": true, "tags": ["a", "b"], "name": "web"}}`
+	tests := []struct {
+		field, want string
+	}{
+		{"vm.id", "12345678"},
+		{"vm.size", "1.5"},
+		{"vm.big", "123456789012345678901"},
+		{"vm.ready", "true"},
+		{"vm.tags", `["a","b"]`},
+		{"vm.tags.1", "b"},
+		{"VM.Name", "web"},
+	}
+	for _, tt := range tests {
+		got, err := capturedValue(output, tt.field)
+		if err != nil {
+			t.Errorf("capturedValue(%q): %v", tt.field, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("capturedValue(%q) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+
+	if got, err := capturedValue("  plain text\n", ""); err != nil || got != "plain text" {
+		t.Errorf("capturedValue without a field = %q, %v", got, err)
+	}
+	if _, err := capturedValue(`{"id": 1} trailing`, "id"); err == nil {
+		t.Error("capturedValue accepted text after the JSON value")
+	}
+	if _, err := capturedValue(`{"id": 1}`, "name"); err == nil {
+		t.Error("capturedValue found a missing field")
+	}
+}
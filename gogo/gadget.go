@@ -0,0 +1,321 @@
+// Package gogo manages and runs gadgets: named PowerShell commands with
+// {{variables}} that are filled in each time they run. It is the library behind
+// the GoGoGadget CLI and can be embedded in other Go programs.
+//
+// A Store loads and saves a Library of gadgets, a Resolver works out the values
+// of a gadget's variables, and a Runner runs it. None of them print anything or
+// exit: output goes to the writers given to the Runner and problems come back
+// as errors.
+package gogo
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Gadget is one saved command or workflow
+type Gadget struct {
+	Description     string                    `json:"description" yaml:"description"`
+	Type            string                    `json:"type,omitempty" yaml:"type,omitempty"`
+	Command         string                    `json:"command" yaml:"command"`
+	Steps           []WorkflowStep            `json:"steps,omitempty" yaml:"steps,omitempty"`
+	Variables       map[string]string         `json:"variables" yaml:"variables"`
+	VariableOptions map[string]VariableOption `json:"variableOptions,omitempty" yaml:"variableOptions,omitempty"`
+	// Workdir is the folder the command runs in; it may use {{variables}}
+	Workdir string `json:"workdir,omitempty" yaml:"workdir,omitempty"`
+	// Env holds extra environment variables; values may use {{variables}}
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	// Timeout stops the command after this long, e.g. "30s" or "5m"
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// Before runs ahead of the gadget; if it fails the gadget doesn't run
+	Before string `json:"before,omitempty" yaml:"before,omitempty"`
+	// After runs once the gadget ends, with {{GOGO_EXIT_CODE}}, {{GOGO_DURATION}} and {{GOGO_OUTPUT}}
+	After string `json:"after,omitempty" yaml:"after,omitempty"`
+	// Dangerous is set by GoGoGadget when the gadget runs destructive commands;
+	// the CLI asks for confirmation before running it
+	Dangerous bool `json:"dangerous,omitempty" yaml:"dangerous,omitempty"`
+	// EscapeValues doubles single quotes in values inserted into the command,
+	// whatever the policy says. Imported scripts set it, since they keep text
+	// variables inside single-quoted strings.
+	EscapeValues bool `json:"escapeValues,omitempty" yaml:"escapeValues,omitempty"`
+	// Signature is set by 'GoGoGadget sign' and covers everything above
+	Signature *Signature `json:"signature,omitempty" yaml:"signature,omitempty"`
+}
+
+// VariableOption holds extra settings for a single gadget variable
+type VariableOption struct {
+	// List marks a variable that accepts several values; the gadget runs once per value
+	List bool `json:"list,omitempty" yaml:"list,omitempty"`
+	// Type checks values before the gadget runs: int, number or bool. Empty means any text.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Default is used instead of asking when no value is given
+	Default *string `json:"default,omitempty" yaml:"default,omitempty"`
+}
+
+// Variable types
+const (
+	VariableTypeInt    = "int"
+	VariableTypeNumber = "number"
+	// VariableTypeBool values are inserted as $true or $false
+	VariableTypeBool = "bool"
+)
+
+// TypeWorkflow marks a gadget whose definition is a list of steps that each
+// run another gadget, instead of a PowerShell command
+const TypeWorkflow = "workflow"
+
+// WorkflowStep is one step of a workflow gadget
+type WorkflowStep struct {
+	// Gadget is the name of the gadget this step runs
+	Gadget string `json:"gadget" yaml:"gadget"`
+	// Variables maps the step gadget's variables to values; values may use the
+	// workflow's own {{variables}}. Unmapped variables pass through by name.
+	Variables map[string]string `json:"variables,omitempty" yaml:"variables,omitempty"`
+	// ContinueOnError keeps the workflow going when this step fails
+	ContinueOnError bool `json:"continueOnError,omitempty" yaml:"continueOnError,omitempty"`
+	// Capture names a variable that receives this step's output, for later steps
+	Capture string `json:"capture,omitempty" yaml:"capture,omitempty"`
+	// CaptureField picks a field out of JSON output instead of capturing all of it
+	CaptureField string `json:"captureField,omitempty" yaml:"captureField,omitempty"`
+}
+
+// Signature records who signed a gadget
+type Signature struct {
+	Author    string    `json:"author" yaml:"author"`
+	PublicKey string    `json:"publicKey" yaml:"publicKey"`
+	Signed    time.Time `json:"signed" yaml:"signed"`
+	// Value is the base64 ed25519 signature over the gadget's canonical form
+	Value string `json:"value" yaml:"value"`
+}
+
+// Library holds gadgets by name
+type Library map[string]Gadget
+
+// Names returns the names of the gadgets in sorted order
+func (l Library) Names() []string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultDescription describes a variable that has no description of its own
+const DefaultDescription = "Value for %s"
+
+// nameRe matches the names allowed for gadgets
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+// ValidName reports whether name can be a gadget name: letters, numbers,
+// dashes and underscores only
+func ValidName(name string) bool {
+	return nameRe.MatchString(name)
+}
+
+// IsWorkflow reports whether the gadget is a workflow
+func (g Gadget) IsWorkflow() bool {
+	return g.Type == TypeWorkflow
+}
+
+// IsListVariable reports whether varName was declared as a list variable
+func (g Gadget) IsListVariable(varName string) bool {
+	return g.VariableOptions[varName].List
+}
+
+// VariableDefault returns the default value of a variable, if it has one
+func (g Gadget) VariableDefault(varName string) (string, bool) {
+	if d := g.VariableOptions[varName].Default; d != nil {
+		return *d, true
+	}
+	return "", false
+}
+
+// VariableDescription returns the description of a variable, or a stand-in
+// when it has none
+func (g Gadget) VariableDescription(varName string) string {
+	desc := g.Variables[varName]
+	if desc == "" {
+		desc = fmt.Sprintf(DefaultDescription, varName)
+	}
+	return desc
+}
+
+// TemplateVariables returns the variables used anywhere in a command gadget:
+// the command itself, its working directory, its environment values and its hooks
+func (g Gadget) TemplateVariables() []string {
+	parts := []string{g.Command, g.Workdir, g.Before, g.After}
+	for _, k := range sortedKeys(g.Env) {
+		parts = append(parts, g.Env[k])
+	}
+	return ExtractVariables(strings.Join(parts, "\n"))
+}
+
+// builtinVariables are the variables GoGoGadget fills in itself, like
+// {{GOGO_CHANGED_FILES}}. They are never asked for and are empty when unset.
+// Only these names are reserved, so other GOGO_ variables in gadgets are
+// asked for as usual.
+var builtinVariables = []string{
+	ChangedFilesVariable,
+	GadgetNameVariable,
+	ExitCodeVariable,
+	DurationVariable,
+	OutputVariable,
+}
+
+// IsBuiltinVariable reports whether GoGoGadget provides the variable itself
+func IsBuiltinVariable(varName string) bool {
+	return containsString(builtinVariables, varName)
+}
+
+// BuiltinCollisions returns the variables a gadget declares that have the name
+// of a built-in variable, e.g. ones added before the built-in existed. They
+// get the built-in's value and are no longer asked for.
+func (g Gadget) BuiltinCollisions() []string {
+	var names []string
+	for _, name := range builtinVariables {
+		if _, ok := g.Variables[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// variableRe matches a {{variable}} in a command
+var variableRe = regexp.MustCompile(`\{\{([A-Za-z0-9_]+)\}\}`)
+
+// builtinVariableRe matches built-in variables left over after rendering
+var builtinVariableRe = regexp.MustCompile(`\{\{(` + strings.Join(builtinVariables, "|") + `)\}\}`)
+
+// ExtractVariables returns the {{variables}} used in command, in order of first
+// use, leaving out built-in variables
+func ExtractVariables(command string) []string {
+	var vars []string
+	seen := map[string]bool{}
+	for _, m := range variableRe.FindAllStringSubmatch(command, -1) {
+		if !seen[m[1]] && !IsBuiltinVariable(m[1]) {
+			vars = append(vars, m[1])
+			seen[m[1]] = true
+		}
+	}
+	return vars
+}
+
+// RenderCommand replaces every {{variable}} in command with its value.
+// Built-in variables without a value are replaced with nothing.
+func RenderCommand(command string, vars map[string]string) string {
+	for varName, value := range vars {
+		command = strings.ReplaceAll(command, "{{"+varName+"}}", value)
+	}
+	return builtinVariableRe.ReplaceAllString(command, "")
+}
+
+// VariableNames returns the variables a gadget needs, in order. For workflows
+// these are the variables used by the step mappings plus any step variables
+// that pass through unmapped. lib is used to look up the steps; g doesn't have
+// to be in it yet.
+func VariableNames(name string, g Gadget, lib Library) []string {
+	return collectVariableNames(name, g, lib, map[string]bool{})
+}
+
+func collectVariableNames(name string, g Gadget, lib Library, visiting map[string]bool) []string {
+	if !g.IsWorkflow() {
+		return g.TemplateVariables()
+	}
+	if visiting[name] {
+		return nil // Cycle: reported when the workflow runs
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	var vars []string
+	seen := map[string]bool{}
+	captured := map[string]bool{}
+	add := func(v string) {
+		if !seen[v] && !captured[v] {
+			vars = append(vars, v)
+			seen[v] = true
+		}
+	}
+	for _, step := range g.Steps {
+		stepGadget, ok := lib[step.Gadget]
+		if !ok {
+			continue
+		}
+		for _, v := range collectVariableNames(step.Gadget, stepGadget, lib, visiting) {
+			if tmpl, mapped := step.Variables[v]; mapped {
+				for _, wv := range ExtractVariables(tmpl) {
+					add(wv)
+				}
+			} else {
+				add(v)
+			}
+		}
+		if step.Capture != "" {
+			captured[step.Capture] = true
+		}
+	}
+	for _, v := range ExtractVariables(g.Before + "\n" + g.After) {
+		add(v)
+	}
+	return vars
+}
+
+// FindWorkflowCycle returns the chain of gadget names that leads back to
+// itself when starting from name, or nil if there is no cycle
+func FindWorkflowCycle(name string, lib Library) []string {
+	return findWorkflowCycle(name, lib, nil)
+}
+
+func findWorkflowCycle(name string, lib Library, path []string) []string {
+	for i, p := range path {
+		if p == name {
+			return append(append([]string{}, path[i:]...), name)
+		}
+	}
+	g, ok := lib[name]
+	if !ok || !g.IsWorkflow() {
+		return nil
+	}
+	path = append(append([]string{}, path...), name)
+	for _, step := range g.Steps {
+		if cycle := findWorkflowCycle(step.Gadget, lib, path); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// ValidateWorkflow checks that a workflow's steps exist and don't call back into it
+func ValidateWorkflow(name string, g Gadget, lib Library) error {
+	if len(g.Steps) == 0 {
+		return fmt.Errorf("workflow '%s' has no steps", name)
+	}
+	withSelf := make(Library, len(lib)+1)
+	for k, v := range lib {
+		withSelf[k] = v
+	}
+	withSelf[name] = g
+	for i, step := range g.Steps {
+		if _, ok := withSelf[step.Gadget]; !ok {
+			return fmt.Errorf("step %d uses gadget '%s', which does not exist", i+1, step.Gadget)
+		}
+	}
+	if cycle := FindWorkflowCycle(name, withSelf); cycle != nil {
+		return fmt.Errorf("workflow cycle detected: %s", strings.Join(cycle, " → "))
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,22 @@
+package gogo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuiltinVariables(t *testing.T) {
+	command := "echo {{GOGO_CHANGED_FILES}} {{GOGO_TARGET}} {{name}} {{GOGO_EXIT_CODE}}"
+	if got, want := ExtractVariables(command), []string{"GOGO_TARGET", "name"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractVariables = %v, want %v", got, want)
+	}
+	got := RenderCommand(command, map[string]string{"name": "x"})
+	if want := "echo  {{GOGO_TARGET}} x "; got != want {
+		t.Errorf("RenderCommand = %q, want %q", got, want)
+	}
+
+	g := Gadget{Variables: map[string]string{"GOGO_OUTPUT": "", "GOGO_TARGET": "", "name": ""}}
+	if got, want := g.BuiltinCollisions(), []string{OutputVariable}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BuiltinCollisions = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,83 @@
+//go:build !windows
+
+package gogo
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// configureProcessTree gives the child a process group of its own, so a timeout
+// or interrupt reaches everything it started. With foreground set and the
+// terminal ours, the child's group takes it over for the run, the way a shell
+// runs a foreground job: the gadget can still read the terminal, and Ctrl+C
+// goes to the gadget.
+func configureProcessTree(cmd *exec.Cmd, stdin io.Reader, foreground bool) {
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	if f, ok := stdin.(*os.File); ok && foreground && holdsTerminal(int(f.Fd())) {
+		attr.Foreground, attr.Ctty = true, int(f.Fd())
+	}
+	cmd.SysProcAttr = attr
+}
+
+// holdsTerminal reports whether fd is a terminal and our process group is its
+// foreground group
+func holdsTerminal(fd int) bool {
+	pgrp, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	return err == nil && pgrp == syscall.Getpgrp()
+}
+
+// reclaimTerminal gives the terminal back to our process group once a child
+// that had it has exited
+func reclaimTerminal(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil || !cmd.SysProcAttr.Foreground {
+		return
+	}
+	// We are a background group until this succeeds, and taking the terminal
+	// from the background raises SIGTTOU, which would stop us
+	if !signal.Ignored(syscall.SIGTTOU) {
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+	}
+	_ = unix.IoctlSetPointerInt(cmd.SysProcAttr.Ctty, unix.TIOCSPGRP, syscall.Getpgrp())
+}
+
+// interruptedAtTerminal reports whether the child had the terminal and was
+// ended by Ctrl+C. The terminal sends it to the child's group only, so we have
+// to pass it on ourselves (as shells do) for whatever ran the gadget to stop.
+func interruptedAtTerminal(cmd *exec.Cmd) bool {
+	if cmd.SysProcAttr == nil || !cmd.SysProcAttr.Foreground || cmd.ProcessState == nil {
+		return false
+	}
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGINT
+}
+
+// raiseInterrupt sends Ctrl+C's signal to our own process
+func raiseInterrupt() {
+	_ = syscall.Kill(os.Getpid(), syscall.SIGINT)
+}
+
+// interruptProcessTree forwards an interrupt signal to the child's process group
+func interruptProcessTree(cmd *exec.Cmd, sig os.Signal) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if s, ok := sig.(syscall.Signal); ok {
+		return syscall.Kill(-cmd.Process.Pid, s)
+	}
+	return cmd.Process.Signal(sig)
+}
+
+// killProcessTree ends the child and everything it started
+func killProcessTree(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,44 @@
+//go:build windows
+
+package gogo
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// configureProcessTree sets cmd up so its whole process tree can be signalled.
+// Windows needs nothing here: children share our console, and taskkill walks the tree.
+func configureProcessTree(cmd *exec.Cmd, stdin io.Reader, foreground bool) {}
+
+// reclaimTerminal has nothing to do on Windows, where the console is shared
+func reclaimTerminal(cmd *exec.Cmd) {}
+
+// interruptedAtTerminal is always false on Windows: console Ctrl+C reaches us
+// along with the gadget
+func interruptedAtTerminal(cmd *exec.Cmd) bool {
+	return false
+}
+
+// raiseInterrupt is never needed on Windows
+func raiseInterrupt() {}
+
+// interruptProcessTree forwards an interrupt to the child. Console Ctrl+C already
+// reaches every process attached to the console, so there is nothing to send.
+func interruptProcessTree(cmd *exec.Cmd, sig os.Signal) error {
+	return nil
+}
+
+// killProcessTree ends the child and everything it started
+func killProcessTree(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	pid := strconv.Itoa(cmd.Process.Pid)
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", pid).Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
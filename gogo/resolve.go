@@ -0,0 +1,205 @@
+package gogo
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Resolver works out the values of a gadget's variables from the values given
+// for them, their defaults and, for anything still missing, Prompt
+type Resolver struct {
+	// Prompt asks for the value of a variable that wasn't given and has no
+	// default. When nil, such a variable is an error.
+	Prompt func(varName string, g Gadget) (string, error)
+}
+
+// Resolve returns the variables of each run of the named gadget. A variable
+// with several values makes the gadget run once per value, or once per
+// combination when there are several such variables.
+func (r Resolver) Resolve(name string, lib Library, given map[string][]string) ([]map[string]string, error) {
+	g, ok := lib[name]
+	if !ok {
+		return nil, fmt.Errorf("gadget '%s' not found", name)
+	}
+	varNames := VariableNames(name, g, lib)
+	for v := range given {
+		if !containsString(varNames, v) {
+			return nil, fmt.Errorf("'%s' has no variable '%s'", name, v)
+		}
+	}
+	values, err := r.Values(varNames, g, given)
+	if err != nil {
+		return nil, err
+	}
+	return Combinations(varNames, values), nil
+}
+
+// Values returns the values of each variable in varNames. Given values are
+// split and checked with ExpandValues; a variable without any falls back to
+// its default, then to Prompt.
+func (r Resolver) Values(varNames []string, g Gadget, given map[string][]string) (map[string][]string, error) {
+	values := make(map[string][]string, len(varNames))
+	for _, varName := range varNames {
+		expanded, err := ExpandValues(varName, given[varName], g)
+		if err != nil {
+			return nil, err
+		}
+		if len(expanded) > 0 {
+			values[varName] = expanded
+			continue
+		}
+
+		value, ok := g.VariableDefault(varName)
+		if !ok {
+			if r.Prompt == nil {
+				return nil, fmt.Errorf("no value for variable '%s'", varName)
+			}
+			if value, err = r.Prompt(varName, g); err != nil {
+				return nil, err
+			}
+		}
+		if expanded, err = ExpandValues(varName, []string{value}, g); err != nil {
+			return nil, err
+		}
+		if len(expanded) == 0 {
+			expanded = []string{""}
+		}
+		values[varName] = expanded
+	}
+	return values, nil
+}
+
+// ExpandValues turns raw input into the final value list for a variable.
+// List variables split on commas and read '@file' arguments one value per line.
+// Values of typed variables are checked.
+func ExpandValues(varName string, raw []string, g Gadget) ([]string, error) {
+	vals, err := SplitValues(varName, raw, g)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range vals {
+		if vals[i], err = CheckValue(varName, v, g); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+// SplitValues turns raw input into a list of values without checking them
+func SplitValues(varName string, raw []string, g Gadget) ([]string, error) {
+	if !g.IsListVariable(varName) {
+		var vals []string
+		for _, r := range raw {
+			if r != "" {
+				vals = append(vals, r)
+			}
+		}
+		return vals, nil
+	}
+
+	var vals []string
+	for _, r := range raw {
+		if strings.HasPrefix(r, "@") && len(r) > 1 {
+			lines, err := readValuesFile(r[1:])
+			if err != nil {
+				return nil, fmt.Errorf("reading values for '%s': %w", varName, err)
+			}
+			vals = append(vals, lines...)
+			continue
+		}
+		for _, part := range strings.Split(r, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				vals = append(vals, part)
+			}
+		}
+	}
+	return vals, nil
+}
+
+// readValuesFile reads one value per line, skipping blank lines and '#' comments
+func readValuesFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vals []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		vals = append(vals, line)
+	}
+	return vals, scanner.Err()
+}
+
+// CheckValue checks a value against the variable's type and returns it in the
+// form the command expects, e.g. "yes" becomes $true for a bool
+func CheckValue(varName, value string, g Gadget) (string, error) {
+	trimmed := strings.TrimSpace(value)
+	switch g.VariableOptions[varName].Type {
+	case VariableTypeInt:
+		if _, err := strconv.ParseInt(trimmed, 10, 64); err != nil {
+			return "", fmt.Errorf("'%s' must be a whole number, not '%s'", varName, value)
+		}
+		return trimmed, nil
+	case VariableTypeNumber:
+		if _, err := strconv.ParseFloat(trimmed, 64); err != nil {
+			return "", fmt.Errorf("'%s' must be a number, not '%s'", varName, value)
+		}
+		return trimmed, nil
+	case VariableTypeBool:
+		if b, ok := PowerShellBool(trimmed); ok {
+			return b, nil
+		}
+		return "", fmt.Errorf("'%s' must be true or false, not '%s'", varName, value)
+	}
+	return value, nil
+}
+
+// PowerShellBool turns yes/no answers like "true", "y" or "0" into $true or $false
+func PowerShellBool(s string) (string, bool) {
+	switch strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "$")) {
+	case "true", "yes", "y", "1", "on":
+		return "$true", true
+	case "false", "no", "n", "0", "off":
+		return "$false", true
+	}
+	return "", false
+}
+
+// Combinations returns one variable map per run: the Cartesian product of
+// every variable's values, in variable order
+func Combinations(varNames []string, values map[string][]string) []map[string]string {
+	runs := []map[string]string{{}}
+	for _, varName := range varNames {
+		var next []map[string]string
+		for _, run := range runs {
+			for _, val := range values[varName] {
+				combo := make(map[string]string, len(run)+1)
+				for k, v := range run {
+					combo[k] = v
+				}
+				combo[varName] = val
+				next = append(next, combo)
+			}
+		}
+		runs = next
+	}
+	return runs
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,524 @@
+package gogo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Exit codes for runs that didn't end by themselves
+const (
+	// ExitTimeout is the exit code used when a gadget runs past its timeout
+	ExitTimeout = 124
+	// ExitInterrupted is the exit code used when the user interrupts a gadget (128 + SIGINT)
+	ExitInterrupted = 130
+)
+
+// ExitCodeError is a failure with a specific exit code. When Err is nil the
+// problem has already been reported and there is nothing more to say.
+type ExitCodeError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitCodeError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *ExitCodeError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code that best describes err
+func ExitCode(err error) int {
+	var codeErr *ExitCodeError
+	if errors.As(err, &codeErr) {
+		return codeErr.Code
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
+
+// ErrInterrupted is returned by runs that ended because the user interrupted them
+var ErrInterrupted = &ExitCodeError{Code: ExitInterrupted, Err: errors.New("interrupted")}
+
+// DefaultGracePeriod is how long an interrupted gadget gets to exit before it
+// (and everything it started) is killed, unless the Runner says otherwise
+const DefaultGracePeriod = 5 * time.Second
+
+// Interrupt is the cancellation cause to give a run's context when the user
+// interrupts it, e.g. with Ctrl+C. The signal is passed on to the running
+// command, which gets a grace period to clean up. Any other cancellation kills
+// the command straight away.
+type Interrupt struct {
+	Signal os.Signal
+	// force is closed to skip the grace period
+	force     chan struct{}
+	forceOnce sync.Once
+}
+
+// NewInterrupt returns the cancellation cause for an interrupt by sig
+func NewInterrupt(sig os.Signal) *Interrupt {
+	return &Interrupt{Signal: sig, force: make(chan struct{})}
+}
+
+func (i *Interrupt) Error() string {
+	return fmt.Sprintf("interrupted (%v)", i.Signal)
+}
+
+// Force kills interrupted commands without waiting for the rest of the grace
+// period, e.g. when the user presses Ctrl+C a second time
+func (i *Interrupt) Force() {
+	i.forceOnce.Do(func() { close(i.force) })
+}
+
+// InterruptCause returns the interrupt that cancelled ctx, if any
+func InterruptCause(ctx context.Context) *Interrupt {
+	var intr *Interrupt
+	if errors.As(context.Cause(ctx), &intr) {
+		return intr
+	}
+	return nil
+}
+
+// activeRuns counts running gadget processes across all Runners
+var activeRuns atomic.Int32
+
+// ActiveRuns returns how many gadget processes are running right now
+func ActiveRuns() int {
+	return int(activeRuns.Load())
+}
+
+// Built-in variables: the changed files in watch mode, and for hooks the
+// gadget's name, exit code, duration and output
+const (
+	ChangedFilesVariable = "GOGO_CHANGED_FILES"
+	GadgetNameVariable   = "GOGO_GADGET"
+	ExitCodeVariable     = "GOGO_EXIT_CODE"
+	DurationVariable     = "GOGO_DURATION"
+	OutputVariable       = "GOGO_OUTPUT"
+)
+
+// Hooks are commands run before and after every gadget, around the gadget's
+// own hooks
+type Hooks struct {
+	Before string
+	After  string
+}
+
+// Runner runs gadgets. The zero value runs them through PowerShell with no
+// input and discards their output.
+type Runner struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Timeout overrides each gadget's own timeout when set
+	Timeout time.Duration
+	// Builtins holds values for built-in variables such as GOGO_CHANGED_FILES.
+	// They are also passed to the gadget as environment variables.
+	Builtins map[string]string
+	// EscapeValues doubles single quotes in values inserted into code, for
+	// commands that keep variables inside single-quoted strings
+	EscapeValues bool
+	// Hooks wrap every run
+	Hooks Hooks
+	// Shell runs the commands; empty means DefaultShell
+	Shell string
+	// GracePeriod replaces DefaultGracePeriod when set
+	GracePeriod time.Duration
+	// Prompt asks for a workflow step variable that ends up without a value
+	// or default. When nil, such a variable is an error.
+	Prompt func(varName string, g Gadget) (string, error)
+	// Warn receives problems that don't fail the run, like a failing after
+	// hook. When nil they are written to Stderr.
+	Warn func(msg string)
+	// Foreground lets a gadget take over the terminal while it runs, the way a
+	// shell runs a foreground job, when Stdin is the terminal and this process
+	// holds it. The gadget can then read the terminal and gets Ctrl+C itself.
+	// Taking the terminal back briefly ignores SIGTTOU and then resets it to
+	// the default, so only set this in a program that doesn't handle SIGTTOU.
+	Foreground bool
+	// RaiseInterrupt sends SIGINT to this process when Ctrl+C ends a
+	// Foreground gadget, since only the gadget saw it, so the program's own
+	// SIGINT handling can stop the rest of its work. When false the run just
+	// returns ErrInterrupted.
+	RaiseInterrupt bool
+	// OnStep is called before each workflow step runs, with the step's number
+	// (counting from 1) and how many steps the workflow has
+	OnStep func(workflow string, number, total int, step WorkflowStep)
+	// OnWorkflowEnd is called with the outcome of every step when a workflow ends
+	OnWorkflowEnd func(workflow string, results []StepResult)
+
+	// capture also gets the stdout of gadget commands (not hooks), for a
+	// workflow step whose output becomes a variable
+	capture io.Writer
+}
+
+// DefaultShell returns pwsh if available, otherwise falls back to powershell.
+// GOGOGADGET_SHELL overrides both, e.g. to use a stand-in shell for testing.
+func DefaultShell() string {
+	if shellCmd := os.Getenv("GOGOGADGET_SHELL"); shellCmd != "" {
+		return shellCmd
+	}
+	shellCmd := "pwsh"
+	if _, err := exec.LookPath(shellCmd); err != nil {
+		shellCmd = "powershell"
+	}
+	return shellCmd
+}
+
+// Run runs the named gadget once with fully resolved variables, wrapped in the
+// Runner's hooks and the gadget's own. Use a Resolver to work out vars.
+func (r Runner) Run(ctx context.Context, name string, lib Library, vars map[string]string) error {
+	g, ok := lib[name]
+	if !ok {
+		return fmt.Errorf("gadget '%s' not found", name)
+	}
+	r = r.withDefaults()
+	return r.runWithHooks(ctx, name, hookSet{Before: r.Hooks.Before, After: r.Hooks.After}, vars, func(r Runner) error {
+		return r.runGadget(ctx, name, g, lib, vars)
+	})
+}
+
+func (r Runner) withDefaults() Runner {
+	if r.Stdout == nil {
+		r.Stdout = io.Discard
+	}
+	if r.Stderr == nil {
+		r.Stderr = io.Discard
+	}
+	if r.Shell == "" {
+		r.Shell = DefaultShell()
+	}
+	if r.GracePeriod == 0 {
+		r.GracePeriod = DefaultGracePeriod
+	}
+	return r
+}
+
+func (r Runner) warn(msg string) {
+	if r.Warn != nil {
+		r.Warn(msg)
+		return
+	}
+	fmt.Fprintln(r.Stderr, msg)
+}
+
+// codeValues returns the variable values to insert into a command
+func (r Runner) codeValues(vars map[string]string) map[string]string {
+	if !r.EscapeValues {
+		return vars
+	}
+	escaped := make(map[string]string, len(vars))
+	for k, v := range vars {
+		if k == ChangedFilesVariable {
+			// Already a list of quoted paths, not text to put inside quotes
+			escaped[k] = v
+			continue
+		}
+		escaped[k] = strings.ReplaceAll(v, "'", "''")
+	}
+	return escaped
+}
+
+// runGadget runs a command or workflow gadget once, wrapped in its own hooks
+func (r Runner) runGadget(ctx context.Context, name string, g Gadget, lib Library, vars map[string]string) error {
+	return r.runWithHooks(ctx, name, gadgetHooks(g, vars), vars, func(r Runner) error {
+		if g.IsWorkflow() {
+			return r.runWorkflow(ctx, name, g, lib, vars)
+		}
+		spec, err := r.gadgetExecSpec(name, g, vars)
+		if err != nil {
+			return err
+		}
+		if r.capture != nil {
+			r.Stdout = io.MultiWriter(r.Stdout, r.capture)
+		}
+		return r.runScript(ctx, spec)
+	})
+}
+
+// hookSet is a before and after hook and where they run
+type hookSet struct {
+	Before string
+	After  string
+	Dir    string
+	Env    []string
+}
+
+// gadgetHooks returns the gadget's own hooks, run in its working directory and environment
+func gadgetHooks(g Gadget, vars map[string]string) hookSet {
+	hooks := hookSet{Before: g.Before, After: g.After, Dir: RenderCommand(g.Workdir, vars)}
+	for _, k := range sortedKeys(g.Env) {
+		hooks.Env = append(hooks.Env, k+"="+RenderCommand(g.Env[k], vars))
+	}
+	return hooks
+}
+
+// runWithHooks runs the before hook, then run, then the after hook. A failing
+// before hook aborts the run. The after hook always runs unless the user
+// interrupted, and gets the exit code, duration and a file holding the output.
+func (r Runner) runWithHooks(ctx context.Context, name string, hooks hookSet, vars map[string]string, run func(Runner) error) error {
+	if hooks.Before == "" && hooks.After == "" {
+		return run(r)
+	}
+	builtins := withBuiltins(r.Builtins, map[string]string{GadgetNameVariable: name})
+
+	if hooks.Before != "" {
+		if err := r.runHook(ctx, name+" (before hook)", hooks.Before, hooks, vars, builtins); err != nil {
+			return fmt.Errorf("before hook failed, so '%s' did not run: %w", name, err)
+		}
+	}
+	if hooks.After == "" {
+		return run(r)
+	}
+
+	output, err := os.CreateTemp("", "gogo-output-*.log")
+	if err != nil {
+		return fmt.Errorf("could not create output file for the after hook: %w", err)
+	}
+	defer os.Remove(output.Name())
+	runner := r
+	runner.Stdout = io.MultiWriter(r.Stdout, output)
+	runner.Stderr = io.MultiWriter(r.Stderr, output)
+
+	start := time.Now()
+	runErr := run(runner)
+	output.Close()
+
+	if ctx.Err() != nil {
+		r.warn(fmt.Sprintf("Skipped the after hook for '%s' because the run was stopped.", name))
+		return runErr
+	}
+	exitCode := 0
+	if runErr != nil {
+		exitCode = ExitCode(runErr)
+	}
+	builtins = withBuiltins(builtins, map[string]string{
+		ExitCodeVariable: strconv.Itoa(exitCode),
+		DurationVariable: strconv.FormatFloat(time.Since(start).Seconds(), 'f', 3, 64),
+		OutputVariable:   output.Name(),
+	})
+	if err := r.runHook(ctx, name+" (after hook)", hooks.After, hooks, vars, builtins); err != nil {
+		r.warn(fmt.Sprintf("After hook for '%s' failed: %v", name, err))
+	}
+	return runErr
+}
+
+// runHook runs one hook command through the same shell as gadgets
+func (r Runner) runHook(ctx context.Context, name, command string, hooks hookSet, vars, builtins map[string]string) error {
+	spec := execSpec{
+		Name:    name,
+		Content: RenderCommand(command, r.codeValues(withBuiltins(vars, builtins))) + "\n",
+		Dir:     hooks.Dir,
+		Env:     append([]string{}, hooks.Env...),
+	}
+	for _, k := range sortedKeys(builtins) {
+		spec.Env = append(spec.Env, k+"="+builtins[k])
+	}
+	return r.runScript(ctx, spec)
+}
+
+// withBuiltins returns vars plus the built-in variables for a run
+func withBuiltins(vars, builtins map[string]string) map[string]string {
+	if len(builtins) == 0 {
+		return vars
+	}
+	merged := make(map[string]string, len(vars)+len(builtins))
+	for k, v := range vars {
+		merged[k] = v
+	}
+	for k, v := range builtins {
+		merged[k] = v
+	}
+	return merged
+}
+
+// execSpec describes one PowerShell process
+type execSpec struct {
+	Name    string
+	Content string
+	Dir     string
+	Env     []string
+	Timeout time.Duration
+}
+
+// gadgetExecSpec renders a command gadget with its variables into an execSpec
+func (r Runner) gadgetExecSpec(name string, g Gadget, vars map[string]string) (execSpec, error) {
+	vars = withBuiltins(vars, r.Builtins)
+	if g.EscapeValues {
+		r.EscapeValues = true
+	}
+	spec := execSpec{
+		Name:    name,
+		Content: fmt.Sprintf("# %s\n%s\n", g.Description, RenderCommand(g.Command, r.codeValues(vars))),
+		Dir:     RenderCommand(g.Workdir, vars),
+		Timeout: r.Timeout,
+	}
+	for _, k := range sortedKeys(g.Env) {
+		spec.Env = append(spec.Env, k+"="+RenderCommand(g.Env[k], vars))
+	}
+	for _, k := range sortedKeys(r.Builtins) {
+		spec.Env = append(spec.Env, k+"="+r.Builtins[k])
+	}
+	if spec.Timeout == 0 && g.Timeout != "" {
+		d, err := ParseTimeout(g.Timeout)
+		if err != nil {
+			return execSpec{}, fmt.Errorf("gadget '%s' has an invalid timeout: %w", name, err)
+		}
+		spec.Timeout = d
+	}
+	if spec.Dir != "" {
+		if info, err := os.Stat(spec.Dir); err != nil || !info.IsDir() {
+			return execSpec{}, fmt.Errorf("working directory '%s' does not exist", spec.Dir)
+		}
+	}
+	return spec, nil
+}
+
+// ParseTimeout accepts Go durations like "90s" or "5m", or a plain number of seconds
+func ParseTimeout(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if secs, err := strconv.Atoi(s); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a duration like 30s or 5m", s)
+	}
+	return d, nil
+}
+
+// runScript executes a PowerShell script described by spec. The process (and
+// everything it started) is killed when the timeout passes. When ctx is
+// cancelled by an Interrupt the signal is forwarded first, with a grace period
+// before the kill. The temp script is removed however the run ends.
+func (r Runner) runScript(ctx context.Context, spec execSpec) error {
+	tmpFile, err := os.CreateTemp("", spec.Name+"_*.ps1")
+	if err != nil {
+		return fmt.Errorf("error creating temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(spec.Content); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("error writing script content: %w", err)
+	}
+	tmpFile.Close()
+
+	runCtx := ctx
+	if spec.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, spec.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.Command(r.Shell, "-File", tmpFile.Name())
+	cmd.Dir = spec.Dir
+	if len(spec.Env) > 0 {
+		cmd.Env = append(os.Environ(), spec.Env...)
+	}
+	err = r.runProcess(ctx, runCtx, cmd)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return &ExitCodeError{Code: ExitTimeout, Err: fmt.Errorf("timed out after %s", spec.Timeout)}
+	}
+	return err
+}
+
+// Exec runs another program with the Runner's input and output, stopping it
+// the way gadgets are stopped: an Interrupt is forwarded with a grace period,
+// any other cancellation of ctx kills it. env is added to the program's
+// environment. It counts towards ActiveRuns while it runs.
+func (r Runner) Exec(ctx context.Context, path string, args []string, env []string) error {
+	r = r.withDefaults()
+	cmd := exec.Command(path, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return r.runProcess(ctx, ctx, cmd)
+}
+
+// runProcess starts cmd and waits for it. When runCtx is done the process (and
+// everything it started) is killed; when ctx was cancelled by an Interrupt the
+// signal is forwarded first, with a grace period before the kill.
+//
+// This doesn't use exec.CommandContext: its Cancel runs once, and WaitDelay
+// then kills only the direct child, so neither can forward an interrupt, kill
+// the whole process group when the grace period ends, or cut the grace period
+// short on a second Ctrl+C (Interrupt.Force).
+func (r Runner) runProcess(ctx, runCtx context.Context, cmd *exec.Cmd) error {
+	cmd.Stdin = r.Stdin
+	cmd.Stdout = r.Stdout
+	cmd.Stderr = r.Stderr
+	configureProcessTree(cmd, r.Stdin, r.Foreground)
+	// Don't wait forever on output pipes held open by orphaned grandchildren
+	cmd.WaitDelay = 5 * time.Second
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	activeRuns.Add(1)
+	defer activeRuns.Add(-1)
+
+	waitDone := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		reclaimTerminal(cmd)
+		waitDone <- err
+	}()
+
+	select {
+	case err := <-waitDone:
+		if interruptedAtTerminal(cmd) {
+			// Ctrl+C reached only the gadget: sweep up what it left running as
+			// for any interrupt. When asked, pass it on, giving whoever handles
+			// it a moment to cancel ctx before the caller looks at it.
+			_ = killProcessTree(cmd)
+			if r.RaiseInterrupt {
+				raiseInterrupt()
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+			return ErrInterrupted
+		}
+		return err
+	case <-runCtx.Done():
+	}
+
+	// Interrupted: pass the signal on and give the gadget a chance to clean up
+	if intr := InterruptCause(ctx); intr != nil {
+		_ = interruptProcessTree(cmd, intr.Signal)
+		select {
+		case <-waitDone:
+			// Sweep up anything the gadget left running in its process group
+			_ = killProcessTree(cmd)
+		case <-intr.force:
+			_ = killProcessTree(cmd)
+			<-waitDone
+		case <-time.After(r.GracePeriod):
+			_ = killProcessTree(cmd)
+			<-waitDone
+		}
+		return ErrInterrupted
+	}
+
+	_ = killProcessTree(cmd)
+	<-waitDone
+	return runCtx.Err()
+}
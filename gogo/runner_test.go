@@ -0,0 +1,41 @@
+package gogo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGadgetEscapeValues(t *testing.T) {
+	vars := map[string]string{"name": "O'Brien'; Remove-Item x; '"}
+	g := Gadget{Command: "Write-Output '{{name}}'"}
+
+	spec, err := Runner{}.gadgetExecSpec("test", g, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(spec.Content, "'O'Brien';") {
+		t.Errorf("values are left alone by default; got %q", spec.Content)
+	}
+
+	g.EscapeValues = true
+	spec, err = Runner{}.gadgetExecSpec("test", g, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Write-Output 'O''Brien''; Remove-Item x; '''"; !strings.Contains(spec.Content, want) {
+		t.Errorf("got %q, want it to contain %q", spec.Content, want)
+	}
+}
+
+func TestChangedFilesAreNotEscapedTwice(t *testing.T) {
+	r := Runner{Builtins: map[string]string{ChangedFilesVariable: "'a.ps1' 'it''s here.ps1'"}}
+	g := Gadget{Command: "Invoke-ScriptAnalyzer {{GOGO_CHANGED_FILES}}", EscapeValues: true}
+
+	spec, err := r.gadgetExecSpec("test", g, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Invoke-ScriptAnalyzer 'a.ps1' 'it''s here.ps1'"; !strings.Contains(spec.Content, want) {
+		t.Errorf("got %q, want it to contain %q", spec.Content, want)
+	}
+}
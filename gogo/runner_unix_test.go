@@ -0,0 +1,215 @@
+//go:build !windows
+
+package gogo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testRunner returns a Runner whose shell is a stand-in that runs the gadget's
+// script with sh, and the folder its temp scripts are written to
+func testRunner(t *testing.T) (Runner, string) {
+	t.Helper()
+	shell := filepath.Join(t.TempDir(), "fakeps")
+	if err := os.WriteFile(shell, []byte("#!/bin/sh\n# Called as: fakeps -File script\nshift\nexec sh \"$@\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOGOGADGET_SHELL", shell)
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	return Runner{GracePeriod: 200 * time.Millisecond}, tmp
+}
+
+// runInBackground runs the gadget and returns a channel for its result
+func runInBackground(ctx context.Context, r Runner, g Gadget) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run(ctx, "test", Library{"test": g}, nil)
+	}()
+	return done
+}
+
+func waitForFile(t *testing.T, path string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			return string(data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s was never written", path)
+	return ""
+}
+
+func waitForResult(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("the run did not end")
+		return nil
+	}
+}
+
+// alive reports whether the process is still running; zombies count as gone
+func alive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return !os.IsNotExist(err)
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+func waitUntilGone(t *testing.T, pid int) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for alive(pid) {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("process %d was left running", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func assertNoTempScripts(t *testing.T, tmp string) {
+	t.Helper()
+	scripts, _ := filepath.Glob(filepath.Join(tmp, "*.ps1"))
+	if len(scripts) > 0 {
+		t.Errorf("temp scripts left behind: %v", scripts)
+	}
+}
+
+func TestInterruptReachesProcessGroup(t *testing.T) {
+	r, tmp := testRunner(t)
+	dir := t.TempDir()
+	g := Gadget{
+		Command: `trap 'echo gadget >> "$MARKS"; exit 0' TERM
+sh -c 'trap "echo started-by-gadget >> \"$MARKS\"; exit 0" TERM; echo ready > "$READY"; while :; do sleep 0.05; done' &
+wait`,
+		Env: map[string]string{"MARKS": filepath.Join(dir, "marks"), "READY": filepath.Join(dir, "ready")},
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	done := runInBackground(ctx, r, g)
+	waitForFile(t, filepath.Join(dir, "ready"))
+	cancel(NewInterrupt(syscall.SIGTERM))
+
+	err := waitForResult(t, done)
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("got %v, want ErrInterrupted", err)
+	}
+	if code := ExitCode(err); code != ExitInterrupted {
+		t.Errorf("exit code %d, want %d", code, ExitInterrupted)
+	}
+	marks := waitForFile(t, filepath.Join(dir, "marks"))
+	for _, want := range []string{"gadget", "started-by-gadget"} {
+		if !strings.Contains(marks, want) {
+			t.Errorf("the signal did not reach the %s process; marks: %q", want, marks)
+		}
+	}
+	assertNoTempScripts(t, tmp)
+}
+
+func TestInterruptKillsAfterGracePeriod(t *testing.T) {
+	r, tmp := testRunner(t)
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "pid")
+	// Ignoring the signal is passed on to everything the gadget starts
+	g := Gadget{
+		Command: `trap '' TERM
+sleep 30 &
+echo $! > "$PIDFILE"
+wait`,
+		Env: map[string]string{"PIDFILE": pidFile},
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	done := runInBackground(ctx, r, g)
+	pid, _ := strconv.Atoi(strings.TrimSpace(waitForFile(t, pidFile)))
+	start := time.Now()
+	cancel(NewInterrupt(syscall.SIGTERM))
+
+	err := waitForResult(t, done)
+	if elapsed := time.Since(start); elapsed < r.GracePeriod {
+		t.Errorf("killed after %s, before the %s grace period", elapsed, r.GracePeriod)
+	}
+	if code := ExitCode(err); code != ExitInterrupted {
+		t.Errorf("got %v (exit code %d), want exit code %d", err, code, ExitInterrupted)
+	}
+	waitUntilGone(t, pid)
+	assertNoTempScripts(t, tmp)
+}
+
+func TestForceSkipsGracePeriod(t *testing.T) {
+	r, tmp := testRunner(t)
+	r.GracePeriod = time.Minute
+	ready := filepath.Join(t.TempDir(), "ready")
+	g := Gadget{
+		Command: `trap '' TERM
+echo ready > "$READY"
+sleep 30`,
+		Env: map[string]string{"READY": ready},
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	done := runInBackground(ctx, r, g)
+	waitForFile(t, ready)
+	intr := NewInterrupt(syscall.SIGTERM)
+	cancel(intr)
+	time.Sleep(100 * time.Millisecond)
+	intr.Force()
+
+	if code := ExitCode(waitForResult(t, done)); code != ExitInterrupted {
+		t.Errorf("exit code %d, want %d", code, ExitInterrupted)
+	}
+	assertNoTempScripts(t, tmp)
+}
+
+func TestTimeoutKillsProcessGroup(t *testing.T) {
+	r, tmp := testRunner(t)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	g := Gadget{
+		Command: `sleep 30 &
+echo $! > "$PIDFILE"
+wait`,
+		Env:     map[string]string{"PIDFILE": pidFile},
+		Timeout: "300ms",
+	}
+
+	err := r.Run(context.Background(), "test", Library{"test": g}, nil)
+	if code := ExitCode(err); code != ExitTimeout {
+		t.Errorf("got %v (exit code %d), want exit code %d", err, code, ExitTimeout)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(waitForFile(t, pidFile)))
+	waitUntilGone(t, pid)
+	assertNoTempScripts(t, tmp)
+}
+
+func TestRunRemovesTempScript(t *testing.T) {
+	r, tmp := testRunner(t)
+	for _, command := range []string{"exit 0", "exit 3"} {
+		err := r.Run(context.Background(), "test", Library{"test": {Command: command}}, nil)
+		if command == "exit 3" && ExitCode(err) != 3 {
+			t.Errorf("%q: got %v, want exit code 3", command, err)
+		}
+	}
+	assertNoTempScripts(t, tmp)
+}
@@ -0,0 +1,312 @@
+package gogo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Store loads and saves a library of gadgets
+type Store interface {
+	Load() (Library, error)
+	Save(Library) error
+}
+
+// Formats gadgets can be written in
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// FormatOf works out the format of a gadget file from its extension
+func FormatOf(path string) (string, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, true
+	case ".yaml", ".yml":
+		return FormatYAML, true
+	case ".toml":
+		return FormatTOML, true
+	}
+	return "", false
+}
+
+// FileStore keeps the whole library in one JSON, YAML or TOML file, chosen by
+// the file's extension. A file that doesn't exist yet is an empty library.
+type FileStore struct {
+	Path string
+}
+
+func (s FileStore) format() (string, error) {
+	format, ok := FormatOf(s.Path)
+	if !ok {
+		return "", fmt.Errorf("%s isn't a .json, .yaml or .toml file", s.Path)
+	}
+	return format, nil
+}
+
+// Load reads the library
+func (s FileStore) Load() (Library, error) {
+	format, err := s.format()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return Library{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data, format)
+}
+
+// Save writes the library, replacing the file
+func (s FileStore) Save(lib Library) error {
+	format, err := s.format()
+	if err != nil {
+		return err
+	}
+	data, err := Encode(lib, format)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.Path, data, 0644)
+}
+
+// DirStore keeps one YAML file per gadget in a folder, named after the gadget.
+// It suits version control: a change to one gadget touches one file.
+type DirStore struct {
+	Dir string
+}
+
+// DirStoreExt is the extension of the gadget files in a DirStore
+const DirStoreExt = ".yaml"
+
+// Load reads every gadget file in the folder. Files whose names can't be
+// gadget names are skipped.
+func (s DirStore) Load() (Library, error) {
+	lib := Library{}
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*"+DirStoreExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), DirStoreExt)
+		if !ValidName(name) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		g, err := DecodeGadget(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		lib[name] = g
+	}
+	return lib, nil
+}
+
+// Save writes one file per gadget, leaving unchanged files alone and removing
+// the files of gadgets that are no longer in lib
+func (s DirStore) Save(lib Library) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	for name, g := range lib {
+		path := filepath.Join(s.Dir, name+DirStoreExt)
+		text := GadgetText(g)
+		if old, err := os.ReadFile(path); err == nil && string(old) == text {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			return err
+		}
+	}
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*"+DirStoreExt))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), DirStoreExt)
+		if _, ok := lib[name]; !ok {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GadgetText renders one gadget as the YAML of its DirStore file. Dangerous is
+// left out because it's worked out again when gadgets are loaded.
+func GadgetText(g Gadget) string {
+	g.Dangerous = false
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(g); err != nil {
+		return ""
+	}
+	enc.Close()
+	return buf.String()
+}
+
+// DecodeGadget reads one gadget written by GadgetText
+func DecodeGadget(data []byte) (Gadget, error) {
+	var g Gadget
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&g); err != nil {
+		return g, err
+	}
+	if g.Variables == nil {
+		g.Variables = map[string]string{}
+	}
+	return g, nil
+}
+
+// Encode writes gadgets in the given format. Multi-line commands stay
+// readable: YAML uses block scalars and TOML uses multi-line literal strings,
+// so backslashes and quotes appear exactly as typed.
+func Encode(lib Library, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatJSON:
+		return json.MarshalIndent(lib, "", "  ")
+	case FormatYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(lib); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		// Going through JSON keeps the same field names as the other formats
+		data, err := json.Marshal(lib)
+		if err != nil {
+			return nil, err
+		}
+		var generic map[string]interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return nil, err
+		}
+		if err := toml.NewEncoder(&buf).Encode(tomlLiterals(generic)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format '%s'; use %s, %s or %s", format, FormatJSON, FormatYAML, FormatTOML)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode reads gadgets written in the given format. YAML and TOML are usually
+// edited by hand, so unknown fields are reported instead of dropped.
+func Decode(data []byte, format string) (Library, error) {
+	lib := Library{}
+	switch format {
+	case FormatJSON:
+		if err := json.Unmarshal(data, &lib); err != nil {
+			return nil, err
+		}
+	case FormatYAML:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&lib); err != nil && err != io.EOF {
+			return nil, err
+		}
+	case FormatTOML:
+		var generic map[string]interface{}
+		if _, err := toml.Decode(string(data), &generic); err != nil {
+			return nil, err
+		}
+		j, err := json.Marshal(generic)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(j))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&lib); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format '%s'; use %s, %s or %s", format, FormatJSON, FormatYAML, FormatTOML)
+	}
+	if lib == nil { // an empty YAML file or a JSON null
+		lib = Library{}
+	}
+	for name, g := range lib {
+		if g.Variables == nil { // TOML leaves out empty tables
+			g.Variables = map[string]string{}
+			lib[name] = g
+		}
+	}
+	return lib, nil
+}
+
+// tomlText is a string written as a TOML literal, so backslashes and quotes
+// appear exactly as typed
+type tomlText string
+
+func (t tomlText) MarshalTOML() ([]byte, error) {
+	if strings.Contains(string(t), "\n") {
+		return []byte("'''\n" + string(t) + "'''"), nil
+	}
+	return []byte("'" + string(t) + "'"), nil
+}
+
+// tomlLiterals swaps strings for tomlText wherever a literal can hold them and
+// reads better: multi-line strings and those with backslashes or quotes
+func tomlLiterals(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = tomlLiterals(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = tomlLiterals(e)
+		}
+	case string:
+		if !tomlLiteralSafe(v) {
+			return v
+		}
+		if strings.Contains(v, "\n") || (strings.ContainsAny(v, `\"`) && !strings.Contains(v, "'")) {
+			return tomlText(v)
+		}
+	}
+	return v
+}
+
+// tomlLiteralSafe reports whether s can be written as a literal: no control
+// characters other than tabs and line breaks, and nothing that would end a
+// multi-line literal early
+func tomlLiteralSafe(s string) bool {
+	if strings.Contains(s, "'''") || strings.HasSuffix(s, "'") {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '\t' || r == '\n':
+		case r == '\r':
+			if !strings.HasPrefix(s[i+1:], "\n") {
+				return false
+			}
+		case r < 0x20 || r == 0x7f:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+package gogo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// StepStatus describes how a workflow step ended
+type StepStatus string
+
+const (
+	StepSucceeded StepStatus = "ok"
+	StepFailed    StepStatus = "failed"
+	StepContinued StepStatus = "failed (continued)"
+	StepSkipped   StepStatus = "skipped"
+)
+
+// StepResult records the outcome and timing of one workflow step
+type StepResult struct {
+	Step     WorkflowStep
+	Status   StepStatus
+	Duration time.Duration
+	Err      error
+}
+
+// runWorkflow runs each step of a workflow in order with the workflow's variables,
+// stopping at the first failing step unless it is marked continue-on-error.
+// Steps with a capture add their output to the variables of the steps after them.
+func (r Runner) runWorkflow(ctx context.Context, name string, g Gadget, lib Library, vars map[string]string) error {
+	if cycle := FindWorkflowCycle(name, lib); cycle != nil {
+		return fmt.Errorf("workflow cycle detected: %s", strings.Join(cycle, " → "))
+	}
+
+	// Copy so captured values stay local to this run
+	runVars := make(map[string]string, len(vars))
+	for k, v := range vars {
+		runVars[k] = v
+	}
+
+	results := make([]StepResult, len(g.Steps))
+	var runErr error
+	for i, step := range g.Steps {
+		results[i].Step = step
+		if runErr != nil {
+			results[i].Status = StepSkipped
+			continue
+		}
+
+		if r.OnStep != nil {
+			r.OnStep(name, i+1, len(g.Steps), step)
+		}
+		start := time.Now()
+		stepRunner := r
+		var capture *bytes.Buffer
+		if step.Capture != "" {
+			capture = &bytes.Buffer{}
+			stepRunner.capture = capture
+			if r.capture != nil {
+				// A step of a step that is itself captured feeds both
+				stepRunner.capture = io.MultiWriter(r.capture, capture)
+			}
+		}
+		err := stepRunner.runWorkflowStep(ctx, step, lib, runVars)
+		if err == nil && capture != nil {
+			var value string
+			if value, err = capturedValue(capture.String(), step.CaptureField); err == nil {
+				runVars[step.Capture] = value
+			}
+		}
+		results[i].Duration = time.Since(start)
+		results[i].Err = err
+
+		switch {
+		case err == nil:
+			results[i].Status = StepSucceeded
+		case InterruptCause(ctx) != nil:
+			// Never carry on past an interrupt, even for continue-on-error steps
+			results[i].Status = StepFailed
+			runErr = ErrInterrupted
+		case step.ContinueOnError:
+			results[i].Status = StepContinued
+		default:
+			results[i].Status = StepFailed
+			runErr = fmt.Errorf("step %d (%s) failed: %w", i+1, step.Gadget, err)
+		}
+	}
+
+	if r.OnWorkflowEnd != nil {
+		r.OnWorkflowEnd(name, results)
+	}
+	return runErr
+}
+
+// runWorkflowStep resolves a step's variables and runs its gadget. Values are
+// checked and split like values given on the command line, so a list variable
+// runs the step once per value. A variable with no value at all (an empty one
+// counts as a value) falls back to the step gadget's default, then to Prompt.
+func (r Runner) runWorkflowStep(ctx context.Context, step WorkflowStep, lib Library, vars map[string]string) error {
+	stepGadget, ok := lib[step.Gadget]
+	if !ok {
+		return fmt.Errorf("gadget '%s' not found", step.Gadget)
+	}
+
+	varNames := VariableNames(step.Gadget, stepGadget, lib)
+	values := make(map[string][]string, len(varNames))
+	for _, v := range varNames {
+		val, present := vars[v]
+		if tmpl, mapped := step.Variables[v]; mapped {
+			val, present = RenderCommand(tmpl, withBuiltins(vars, r.Builtins)), true
+		}
+		if !present {
+			resolved, err := Resolver{Prompt: r.Prompt}.Values([]string{v}, stepGadget, nil)
+			if err != nil {
+				return err
+			}
+			values[v] = resolved[v]
+			continue
+		}
+		expanded, err := ExpandValues(v, []string{val}, stepGadget)
+		if err != nil {
+			return err
+		}
+		if len(expanded) == 0 {
+			expanded = []string{""}
+		}
+		values[v] = expanded
+	}
+
+	for _, stepVars := range Combinations(varNames, values) {
+		if err := r.runGadget(ctx, step.Gadget, stepGadget, lib, stepVars); err != nil {
+			return err
+		}
+	}
+	return nil
+}
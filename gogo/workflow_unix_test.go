@@ -0,0 +1,187 @@
+//go:build !windows
+
+package gogo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordingGadget appends its variables' values, one run per line, to out
+func recordingGadget(out string, vars ...string) Gadget {
+	var refs []string
+	for _, v := range vars {
+		refs = append(refs, v+"='{{"+v+"}}'")
+	}
+	return Gadget{
+		Command: "echo " + strings.Join(refs, " ") + ` >> "$OUT"`,
+		Env:     map[string]string{"OUT": out},
+	}
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestWorkflowStepValuesAreResolved(t *testing.T) {
+	r, _ := testRunner(t)
+	out := filepath.Join(t.TempDir(), "out")
+	step := recordingGadget(out, "flag", "host", "note", "level")
+	zero := "0"
+	step.VariableOptions = map[string]VariableOption{
+		"flag":  {Type: VariableTypeBool},
+		"host":  {List: true},
+		"level": {Type: VariableTypeInt, Default: &zero},
+	}
+	lib := Library{
+		"step": step,
+		"wf": {
+			Type: TypeWorkflow,
+			Steps: []WorkflowStep{{Gadget: "step", Variables: map[string]string{
+				"flag": "yes",
+				"host": "{{hosts}}",
+			}}},
+		},
+	}
+	r.Prompt = func(v string, g Gadget) (string, error) {
+		t.Errorf("asked for %s", v)
+		return "", nil
+	}
+
+	// note is given but empty, and level isn't given at all
+	err := r.Run(context.Background(), "wf", lib, map[string]string{"hosts": "a, b", "note": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"flag=$true host=a note= level=0",
+		"flag=$true host=b note= level=0",
+	}
+	if got := readLines(t, out); !reflect.DeepEqual(got, want) {
+		t.Errorf("runs %q, want %q", got, want)
+	}
+}
+
+func TestWorkflowStepValueChecked(t *testing.T) {
+	r, _ := testRunner(t)
+	step := recordingGadget(filepath.Join(t.TempDir(), "out"), "count")
+	step.VariableOptions = map[string]VariableOption{"count": {Type: VariableTypeInt}}
+	lib := Library{
+		"step": step,
+		"wf":   {Type: TypeWorkflow, Steps: []WorkflowStep{{Gadget: "step", Variables: map[string]string{"count": "many"}}}},
+	}
+	err := r.Run(context.Background(), "wf", lib, nil)
+	if err == nil || !strings.Contains(err.Error(), "'count' must be a whole number") {
+		t.Errorf("got %v, want the value to be refused", err)
+	}
+}
+
+func TestWorkflowStepMissingValue(t *testing.T) {
+	r, _ := testRunner(t)
+	out := filepath.Join(t.TempDir(), "out")
+	lib := Library{
+		"fail": {Command: "exit 1"},
+		"show": recordingGadget(out, "result"),
+		// The failing step never captures result, so the next step has no value
+		"wf": {Type: TypeWorkflow, Steps: []WorkflowStep{
+			{Gadget: "fail", Capture: "result", ContinueOnError: true},
+			{Gadget: "show"},
+		}},
+	}
+
+	err := r.Run(context.Background(), "wf", lib, nil)
+	if err == nil || !strings.Contains(err.Error(), "no value for variable 'result'") {
+		t.Errorf("without Prompt: got %v, want a missing value error", err)
+	}
+
+	r.Prompt = func(v string, g Gadget) (string, error) { return "asked", nil }
+	if err := r.Run(context.Background(), "wf", lib, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLines(t, out); !reflect.DeepEqual(got, []string{"result=asked"}) {
+		t.Errorf("runs %q, want the prompted value", got)
+	}
+}
+
+func TestWorkflowCaptureOnlyTheCommand(t *testing.T) {
+	r, _ := testRunner(t)
+	out := filepath.Join(t.TempDir(), "out")
+	lib := Library{
+		"produce": {
+			Command: `echo '{"id": 12345678901}'`,
+			Before:  "echo before hook",
+			After:   "echo after hook",
+		},
+		// Running produce through another workflow adds that workflow's own output
+		"inner": {Type: TypeWorkflow, Steps: []WorkflowStep{{Gadget: "produce"}}},
+		"show":  recordingGadget(out, "result"),
+		"wf": {Type: TypeWorkflow, Steps: []WorkflowStep{
+			{Gadget: "inner", Capture: "id", CaptureField: "id"},
+			{Gadget: "show", Variables: map[string]string{"result": "{{id}}"}},
+		}},
+	}
+	var stdout strings.Builder
+	r.Stdout = &stdout
+
+	if err := r.Run(context.Background(), "wf", lib, nil); err != nil {
+		t.Fatalf("%v; output:\n%s", err, stdout.String())
+	}
+	if got := readLines(t, out); !reflect.DeepEqual(got, []string{"result=12345678901"}) {
+		t.Errorf("runs %q, want the captured id", got)
+	}
+	// The hooks still ran and were shown, just not captured
+	for _, want := range []string{"before hook", "after hook", `{"id": 12345678901}`} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output doesn't show %q:\n%s", want, stdout.String())
+		}
+	}
+}
+
+func TestWorkflowReportsStepsToTheCaller(t *testing.T) {
+	r, _ := testRunner(t)
+	lib := Library{
+		"ok":   {Command: "echo fine"},
+		"fail": {Command: "exit 4"},
+		"wf": {Type: TypeWorkflow, Steps: []WorkflowStep{
+			{Gadget: "ok"},
+			{Gadget: "fail"},
+			{Gadget: "ok"},
+		}},
+	}
+	var stdout strings.Builder
+	var started []string
+	var results []StepResult
+	r.Stdout = &stdout
+	r.OnStep = func(workflow string, number, total int, step WorkflowStep) {
+		started = append(started, fmt.Sprintf("%s %d/%d %s", workflow, number, total, step.Gadget))
+	}
+	r.OnWorkflowEnd = func(workflow string, res []StepResult) { results = res }
+
+	if err := r.Run(context.Background(), "wf", lib, nil); ExitCode(err) != 4 {
+		t.Errorf("got %v, want exit code 4", err)
+	}
+	if want := []string{"wf 1/3 ok", "wf 2/3 fail"}; !reflect.DeepEqual(started, want) {
+		t.Errorf("started %q, want %q", started, want)
+	}
+	var statuses []StepStatus
+	for _, res := range results {
+		statuses = append(statuses, res.Status)
+	}
+	if want := []StepStatus{StepSucceeded, StepFailed, StepSkipped}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses %v, want %v", statuses, want)
+	}
+	// Only the gadgets' own output reaches Stdout
+	if stdout.String() != "fine\n" {
+		t.Errorf("stdout %q, want only the first step's output", stdout.String())
+	}
+}
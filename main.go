@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gogo/scripts"
 	"os"
@@ -67,16 +69,53 @@ Use 'GoGoGadget add' to create a new shortcut, 'GoGoGadget list' to see all, or
 		},
 	}
 
+	// Errors are printed below, once, in GoGoGadget's own style
+	rootCmd.SilenceErrors = true
+
 	rootCmd.AddCommand(scripts.NewAddCommand())
 	rootCmd.AddCommand(scripts.NewListCommand())
 	rootCmd.AddCommand(scripts.NewDeleteCommand())
 	rootCmd.AddCommand(scripts.NewAnalyzeCommand())
+	rootCmd.AddCommand(scripts.NewSuggestCommand())
 	rootCmd.AddCommand(scripts.NewVariablesCommand())
+	rootCmd.AddCommand(scripts.NewJobsCommand())
+	rootCmd.AddCommand(scripts.NewScheduleCommand())
+	rootCmd.AddCommand(scripts.NewDaemonCommand())
+	rootCmd.AddCommand(scripts.NewHistoryCommand())
+	rootCmd.AddCommand(scripts.NewPolicyCommand())
+	rootCmd.AddCommand(scripts.NewSignCommand())
+	rootCmd.AddCommand(scripts.NewVerifyCommand())
+	rootCmd.AddCommand(scripts.NewTrustCommand())
+	rootCmd.AddCommand(scripts.NewExportCommand())
+	rootCmd.AddCommand(scripts.NewImportCommand())
+	rootCmd.AddCommand(scripts.NewDiffCommand())
+	rootCmd.AddCommand(scripts.NewMergeCommand())
+	rootCmd.AddCommand(scripts.NewLibraryCommand())
+	rootCmd.AddCommand(scripts.NewRepoCommand())
+	rootCmd.AddCommand(scripts.NewPackCommand())
+	rootCmd.AddCommand(scripts.NewServeCommand())
+	rootCmd.AddCommand(scripts.NewMCPCommand())
+	rootCmd.AddCommand(scripts.NewPluginCommand())
+	rootCmd.AddCommand(scripts.NewUICommand())
 	scripts.AddScriptCommands(rootCmd)
 	scripts.AddEditCommand(rootCmd)
+	// Plugins come last so built-in commands and gadgets keep their names
+	scripts.AddPluginCommands(rootCmd)
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(colorable.NewColorableStderr(), "\x1b[31m❌ Error: \x1b[0m", err)
-		os.Exit(1)
+	// Ctrl+C is passed on to running gadgets so they (and their temp files) are cleaned up
+	ctx, stop := scripts.NotifyInterrupts(context.Background())
+	err := scripts.InterruptResult(ctx, rootCmd.ExecuteContext(ctx))
+	stop()
+	if err != nil {
+		code := 1
+		var exitErr *scripts.ExitCodeError
+		if errors.As(err, &exitErr) {
+			code = exitErr.Code
+		}
+		// Errors without a message have already been reported
+		if exitErr == nil || exitErr.Err != nil {
+			fmt.Fprintln(colorable.NewColorableStderr(), "\x1b[31m❌ Error: \x1b[0m", err)
+		}
+		os.Exit(code)
 	}
 }
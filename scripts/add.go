@@ -3,6 +3,7 @@ package scripts
 import (
 	"bufio"
 	"fmt"
+	"gogo/gogo"
 	"os"
 	"regexp"
 	"strings"
@@ -13,6 +14,8 @@ import (
 
 func NewAddCommand() *cobra.Command {
 	var scriptName, command, desc string
+	var listVars, steps, envVars []string
+	var workdir, timeout, before, after string
 
 	cmd := &cobra.Command{
 		Use:   "add",
@@ -20,7 +23,7 @@ func NewAddCommand() *cobra.Command {
 		PreRun: func(cmd *cobra.Command, args []string) {
 			// If --command is provided, dynamically add flags for variables
 			c, _ := cmd.Flags().GetString("command")
-			for _, v := range extractVariables(c) {
+			for _, v := range gogo.ExtractVariables(c) {
 				if cmd.Flags().Lookup(v) == nil {
 					cmd.Flags().String(v, "", fmt.Sprintf("Description for variable '%s'", v))
 				}
@@ -35,9 +38,20 @@ func NewAddCommand() *cobra.Command {
 			colorText.Cyan("Add a new GoGoGadget gadget (user-defined command):")
 			fmt.Fprintln(out)
 
+			// Workflows are built from steps instead of a command
+			var workflowSteps []gogo.WorkflowStep
+			for _, spec := range steps {
+				step, err := parseWorkflowStep(spec)
+				if err != nil {
+					colorText.Red("❌ " + err.Error())
+					return
+				}
+				workflowSteps = append(workflowSteps, step)
+			}
+
 			// Get command
 			command, _ = cmd.Flags().GetString("command")
-			if command == "" {
+			if command == "" && len(workflowSteps) == 0 {
 				fmt.Fprint(out, "\x1b[36m📝 Enter the PowerShell command this gadget will run (you can use \x1b[1;35m{{variable}}\x1b[0m\x1b[36m for variables you want to fill in each time): \x1b[0m")
 				c, _ := reader.ReadString('\n')
 				command = strings.TrimSpace(c)
@@ -45,7 +59,6 @@ func NewAddCommand() *cobra.Command {
 
 			// Get gadget name
 			scriptName, _ = cmd.Flags().GetString("scriptname")
-			nameRe := regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
 			for {
 				if scriptName == "" {
 					fmt.Fprint(out, "\x1b[36m🔖 Enter gadget name: \x1b[0m")
@@ -53,7 +66,7 @@ func NewAddCommand() *cobra.Command {
 					scriptName = strings.TrimSpace(n)
 				}
 				// Validate: no spaces, no punctuation
-				if !nameRe.MatchString(scriptName) {
+				if !gogo.ValidName(scriptName) {
 					colorText.Yellow("⚠️  Gadget names cannot contain spaces or punctuation. Use only letters, numbers, dashes, or underscores. Please enter a new name.")
 					scriptName = ""
 					continue
@@ -69,8 +82,33 @@ func NewAddCommand() *cobra.Command {
 				desc = strings.TrimSpace(d)
 			}
 
+			config := gogo.Gadget{
+				Description: desc,
+				Command:     command,
+				Workdir:     workdir,
+				Before:      before,
+				After:       after,
+			}
+			if err := applyRunSettings(&config, envVars, timeout); err != nil {
+				colorText.Red("❌ " + err.Error())
+				return
+			}
+			if len(workflowSteps) > 0 {
+				if command != "" {
+					colorText.Red("❌ A gadget has either a command or workflow steps, not both.")
+					return
+				}
+				config.Type = gogo.TypeWorkflow
+				config.Steps = workflowSteps
+				if err := gogo.ValidateWorkflow(scriptName, config, scripts); err != nil {
+					colorText.Red("❌ " + err.Error())
+					return
+				}
+			}
+			varNames := gogo.VariableNames(scriptName, config, scripts)
+
 			variables := map[string]string{}
-			for _, v := range extractVariables(command) {
+			for _, v := range varNames {
 				val, _ := cmd.Flags().GetString(v)
 				if val == "" {
 					fmt.Fprintf(out, "\x1b[33m✏️  Describe variable '%s': \x1b[0m", v)
@@ -80,21 +118,23 @@ func NewAddCommand() *cobra.Command {
 				variables[v] = val
 			}
 
-			if scriptName == "" || command == "" {
+			if scriptName == "" || (command == "" && !config.IsWorkflow()) {
 				fmt.Fprintln(colorable.NewColorableStderr(), "\x1b[31m❌ Gadget name and command are required.\x1b[0m")
 				return
 			}
-			scripts[scriptName] = ScriptConfig{
-				Description: desc,
-				Command:     command,
-				Variables:   variables,
+			config.Variables = variables
+			if err := setListVariables(&config, varNames, listVars, true); err != nil {
+				colorText.Red("❌ " + err.Error())
+				return
 			}
+			scripts[scriptName] = config
 			if err := saveScripts(scripts); err != nil {
 				fmt.Fprintln(colorable.NewColorableStderr(), "\x1b[31m❌ Error saving gadget:\x1b[0m", err)
 				return
 			}
 			fmt.Fprintln(out)
 			colorText.Green("✅ Gadget added!")
+			warnIfDangerous(scriptName)
 			fmt.Fprintln(out)
 		},
 	}
@@ -102,20 +142,69 @@ func NewAddCommand() *cobra.Command {
 	cmd.Flags().StringVar(&scriptName, "scriptname", "", "Name of the gadget")
 	cmd.Flags().StringVar(&command, "command", "", "PowerShell command (use {{VARNAME}} for variables)")
 	cmd.Flags().StringVar(&desc, "desc", "", "Gadget description")
+	cmd.Flags().StringSliceVar(&listVars, "list", nil, "Variables that accept several values (the gadget runs once per value)")
+	cmd.Flags().StringVar(&workdir, "workdir", "", "Folder the command runs in (can use {{variables}})")
+	cmd.Flags().StringArrayVar(&envVars, "env", nil, "Extra environment variable as KEY=VALUE (repeatable, values can use {{variables}})")
+	cmd.Flags().StringVar(&timeout, "timeout", "", "Stop the command after this long, e.g. 30s or 5m")
+	cmd.Flags().StringVar(&before, "before", "", "Command to run before the gadget; if it fails the gadget doesn't run")
+	cmd.Flags().StringVar(&after, "after", "", "Command to run after the gadget (can use {{GOGO_EXIT_CODE}}, {{GOGO_DURATION}} and {{GOGO_OUTPUT}})")
+	cmd.Flags().StringArrayVar(&steps, "step", nil, "Make a workflow: a gadget to run as the next step, e.g. \"restart-vm name={{vm}} --continue-on-error\" (repeatable)")
 
 	return cmd
 }
 
-func extractVariables(command string) []string {
-	var vars []string
-	seen := map[string]bool{}
-	re := regexp.MustCompile(`\{\{([A-Za-z0-9_]+)\}\}`)
-	matches := re.FindAllStringSubmatch(command, -1)
-	for _, m := range matches {
-		if !seen[m[1]] {
-			vars = append(vars, m[1])
-			seen[m[1]] = true
+// variableNameRe matches the names allowed inside {{...}}
+var variableNameRe = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// setListVariables marks (or unmarks) the named variables as list variables.
+// gadgetVars holds the variables the gadget actually uses.
+func setListVariables(config *gogo.Gadget, gadgetVars []string, varNames []string, list bool) error {
+	known := map[string]bool{}
+	for _, v := range gadgetVars {
+		known[v] = true
+	}
+	for _, v := range varNames {
+		if !known[v] {
+			return fmt.Errorf("variable '%s' is not used by the gadget", v)
+		}
+		if config.VariableOptions == nil {
+			config.VariableOptions = map[string]gogo.VariableOption{}
+		}
+		opt := config.VariableOptions[v]
+		opt.List = list
+		config.VariableOptions[v] = opt
+		if opt == (gogo.VariableOption{}) {
+			delete(config.VariableOptions, v)
+		}
+	}
+	return nil
+}
+
+// applyRunSettings merges KEY=VALUE environment assignments into the gadget
+// (an empty value removes the key) and sets its timeout if one is given
+func applyRunSettings(config *gogo.Gadget, envVars []string, timeout string) error {
+	for _, kv := range envVars {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("environment variable must look like KEY=VALUE, got '%s'", kv)
+		}
+		if v == "" {
+			delete(config.Env, k)
+			continue
+		}
+		if config.Env == nil {
+			config.Env = map[string]string{}
+		}
+		config.Env[k] = v
+	}
+	if len(config.Env) == 0 {
+		config.Env = nil
+	}
+	if timeout != "" {
+		if _, err := gogo.ParseTimeout(timeout); err != nil {
+			return err
 		}
 	}
-	return vars
+	config.Timeout = timeout
+	return nil
 }
@@ -86,15 +86,78 @@ func Analyze(command ...string) error {
 	spinner := GetSpinner("Analyzing command...")
 	spinner.Start()
 
+	suggestions, paramStr, err := suggestVariables(cmdStr)
+	if err != nil {
+		spinner.Stop()
+		return err
+	}
+
+	fmt.Fprintln(out) // Blank line after spinner
+	spinner.Stop()
+	fmt.Fprintln(out) // Ensure a blank line before the output
+
+	// Print original command
+	fmt.Fprintf(out, "\x1b[1;32mOriginal command:\x1b[0m\n")
+	if err := quick.Highlight(out, cmdStr, "powershell", "terminal16m", "native"); err != nil {
+		return fmt.Errorf("failed to highlight command: %w", err)
+	}
+	fmt.Fprintln(out)
+
+	if len(suggestions) > 0 {
+		fmt.Fprintln(out) // Blank line between commands
+		fmt.Fprintf(out, "\x1b[1;32mSuggested parameterized version:\x1b[0m\n")
+		if err := quick.Highlight(out, paramStr, "powershell", "terminal16m", "native"); err != nil {
+			return fmt.Errorf("failed to highlight parameterized command: %w", err)
+		}
+		fmt.Fprintln(out)
+	}
+
+	if len(suggestions) > 0 {
+		fmt.Fprintln(out) // Blank line before suggestions
+		fmt.Fprintln(out, "Suggested variables:")
+		for _, s := range suggestions {
+			fmt.Fprintf(out, "  \x1b[1;33m%s\x1b[0m\x1b[1;37m ← was \x1b[0m\x1b[1;36m%s\x1b[0m\n", s.VarName, s.Original)
+		}
+	} else {
+		fmt.Fprintf(out, "\n\x1b[1;33mNo suggestions found.\x1b[0m\n")
+	}
+
+	if findings := analyzeDanger(cmdStr); len(findings) > 0 {
+		fmt.Fprintln(out)
+		warnText("⚠️ This command looks dangerous. As a gadget it will need confirmation to run:")
+		printDangers("", findings)
+	}
+
+	// Prompt to save as a command
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Fprint(out, "\nWould you like to save this parameterization as a gadget? Y/N: ")
+	resp, _ := reader.ReadString('\n')
+	resp = strings.TrimSpace(strings.ToLower(resp))
+	if resp == "y" || resp == "yes" {
+		// Call the add process (reuse NewAddCommand logic)
+		// Simulate: GoGoGadget add --command <paramStr>
+		addCmd := NewAddCommand()
+		addCmd.Flags().Set("command", paramStr)
+		addCmd.Run(addCmd, []string{})
+	}
+
+	return nil
+}
+
+// variableSuggestion is a part of a command that looks like user input
+type variableSuggestion struct{ VarName, Original string }
+
+// suggestVariables guesses which parts of a PowerShell command are user input,
+// such as paths, strings and numbers, and returns them along with the command
+// rewritten to use {{variables}} in their place
+func suggestVariables(cmdStr string) ([]variableSuggestion, string, error) {
 	lexer := lexers.Get("powershell")
 	if lexer == nil {
-		spinner.Stop()
-		return fmt.Errorf("could not get PowerShell lexer")
+		return nil, "", fmt.Errorf("could not get PowerShell lexer")
 	}
 	iterator, err := lexer.Tokenise(nil, cmdStr)
 	if err != nil {
-		spinner.Stop()
-		return fmt.Errorf("failed to tokenize command: %w", err)
+		return nil, "", fmt.Errorf("failed to tokenize command: %w", err)
 	}
 
 	// Collect all tokens into a slice
@@ -104,7 +167,7 @@ func Analyze(command ...string) error {
 	}
 
 	// Suggest variables for string tokens using the same tokens slice
-	var suggestions []struct{ VarName, Original string }
+	var suggestions []variableSuggestion
 	varCounters := map[string]int{"string": 0, "number": 0, "variable": 0, "path": 0}
 	checker := GetPowerShellCommandChecker()
 
@@ -122,7 +185,7 @@ func Analyze(command ...string) error {
 				if varCounters["path"] > 1 {
 					varName = fmt.Sprintf("path%d", varCounters["path"])
 				}
-				suggestions = append(suggestions, struct{ VarName, Original string }{varName, joined})
+				suggestions = append(suggestions, variableSuggestion{varName, joined})
 			} else {
 				// Not a path: suggest each Name token in the buffer
 				for _, t := range pathBuffer {
@@ -133,7 +196,7 @@ func Analyze(command ...string) error {
 							if varCounters["string"] > 1 {
 								varName = fmt.Sprintf("string%d", varCounters["string"])
 							}
-							suggestions = append(suggestions, struct{ VarName, Original string }{varName, t.Value})
+							suggestions = append(suggestions, variableSuggestion{varName, t.Value})
 						}
 					}
 				}
@@ -161,7 +224,7 @@ func Analyze(command ...string) error {
 			if varCounters["string"] > 1 {
 				varName = fmt.Sprintf("string%d", varCounters["string"])
 			}
-			suggestions = append(suggestions, struct{ VarName, Original string }{varName, token.Value})
+			suggestions = append(suggestions, variableSuggestion{varName, token.Value})
 			continue
 		}
 		if token.Type == chroma.LiteralNumber {
@@ -170,7 +233,7 @@ func Analyze(command ...string) error {
 			if varCounters["number"] > 1 {
 				varName = fmt.Sprintf("number%d", varCounters["number"])
 			}
-			suggestions = append(suggestions, struct{ VarName, Original string }{varName, token.Value})
+			suggestions = append(suggestions, variableSuggestion{varName, token.Value})
 			continue
 		}
 		if token.Type == chroma.NameVariable {
@@ -179,66 +242,17 @@ func Analyze(command ...string) error {
 			if varCounters["variable"] > 1 {
 				varName = fmt.Sprintf("variable%d", varCounters["variable"])
 			}
-			suggestions = append(suggestions, struct{ VarName, Original string }{varName, token.Value})
+			suggestions = append(suggestions, variableSuggestion{varName, token.Value})
 			continue
 		}
 	}
 	flushPathBuffer()
 
-	fmt.Fprintln(out) // Blank line after spinner
-	spinner.Stop()
-	fmt.Fprintln(out) // Ensure a blank line before the output
-
-	// Parameterization (no spinner needed)
-	var paramStr = cmdStr
-	var suggestionReplacements []struct{ Original, Replacement string }
-	if len(suggestions) > 0 {
-		for _, s := range suggestions {
-			paramStr = strings.Replace(paramStr, s.Original, "{{"+s.VarName+"}}", 1)
-			suggestionReplacements = append(suggestionReplacements, struct{ Original, Replacement string }{s.Original, "{{" + s.VarName + "}}"})
-		}
-	}
-
-	// Print original command
-	fmt.Fprintf(out, "\x1b[1;32mOriginal command:\x1b[0m\n")
-	if err := quick.Highlight(out, cmdStr, "powershell", "terminal16m", "native"); err != nil {
-		return fmt.Errorf("failed to highlight command: %w", err)
-	}
-	fmt.Fprintln(out)
-
-	if len(suggestionReplacements) > 0 {
-		fmt.Fprintln(out) // Blank line between commands
-		fmt.Fprintf(out, "\x1b[1;32mSuggested parameterized version:\x1b[0m\n")
-		if err := quick.Highlight(out, paramStr, "powershell", "terminal16m", "native"); err != nil {
-			return fmt.Errorf("failed to highlight parameterized command: %w", err)
-		}
-		fmt.Fprintln(out)
+	paramStr := cmdStr
+	for _, s := range suggestions {
+		paramStr = strings.Replace(paramStr, s.Original, "{{"+s.VarName+"}}", 1)
 	}
-
-	if len(suggestions) > 0 {
-		fmt.Fprintln(out) // Blank line before suggestions
-		fmt.Fprintln(out, "Suggested variables:")
-		for _, s := range suggestions {
-			fmt.Fprintf(out, "  \x1b[1;33m%s\x1b[0m\x1b[1;37m ← was \x1b[0m\x1b[1;36m%s\x1b[0m\n", s.VarName, s.Original)
-		}
-	} else {
-		fmt.Fprintf(out, "\n\x1b[1;33mNo suggestions found.\x1b[0m\n")
-	}
-
-	// Prompt to save as a command
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Fprint(out, "\nWould you like to save this parameterization as a gadget? Y/N: ")
-	resp, _ := reader.ReadString('\n')
-	resp = strings.TrimSpace(strings.ToLower(resp))
-	if resp == "y" || resp == "yes" {
-		// Call the add process (reuse NewAddCommand logic)
-		// Simulate: GoGoGadget add --command <paramStr>
-		addCmd := NewAddCommand()
-		addCmd.Flags().Set("command", paramStr)
-		addCmd.Run(addCmd, []string{})
-	}
-
-	return nil
+	return suggestions, paramStr, nil
 }
 
 // Helper to detect likely Windows/Unix paths
@@ -0,0 +1,490 @@
+package scripts
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/chroma/quick"
+	"github.com/mattn/go-colorable"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// diffLine is one line of a line-by-line diff: ' ' kept, '-' removed, '+' added
+type diffLine struct {
+	Op   byte
+	Text string
+}
+
+// diffSplit splits text into lines for lineDiff; empty text has no lines
+func diffSplit(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// lineDiff compares two texts line by line using the longest common subsequence
+func lineDiff(a, b string) []diffLine {
+	al, bl := diffSplit(a), diffSplit(b)
+	// lcs[i][j] is the length of the common subsequence of al[i:] and bl[j:]
+	lcs := make([][]int, len(al)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bl)+1)
+	}
+	for i := len(al) - 1; i >= 0; i-- {
+		for j := len(bl) - 1; j >= 0; j-- {
+			if al[i] == bl[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(al) && j < len(bl) {
+		switch {
+		case al[i] == bl[j]:
+			lines = append(lines, diffLine{' ', al[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', al[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', bl[j]})
+			j++
+		}
+	}
+	for ; i < len(al); i++ {
+		lines = append(lines, diffLine{'-', al[i]})
+	}
+	for ; j < len(bl); j++ {
+		lines = append(lines, diffLine{'+', bl[j]})
+	}
+	return lines
+}
+
+// printLineDiff shows the changed lines of a diff with a line of context
+// around each change; unchanged stretches are shown as "...". highlight, when
+// set, colors the text of each line while the -/+ markers keep their colors.
+func printLineDiff(lines []diffLine, indent string, highlight func(string) string) {
+	const context = 1
+	show := make([]bool, len(lines))
+	for i, l := range lines {
+		if l.Op == ' ' {
+			continue
+		}
+		for k := max(0, i-context); k <= min(len(lines)-1, i+context); k++ {
+			show[k] = true
+		}
+	}
+	out := colorable.NewColorableStdout()
+	skipped := false
+	for i, l := range lines {
+		if !show[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			fmt.Fprintln(out, indent+"...")
+			skipped = false
+		}
+		if highlight != nil {
+			marker := "  "
+			switch l.Op {
+			case '-':
+				marker = "\x1b[31m- \x1b[0m"
+			case '+':
+				marker = "\x1b[32m+ \x1b[0m"
+			}
+			fmt.Fprintln(out, indent+marker+highlight(l.Text))
+			continue
+		}
+		switch l.Op {
+		case '-':
+			errorText(indent + "- " + l.Text)
+		case '+':
+			colorText.Green(indent + "+ " + l.Text)
+		default:
+			fmt.Fprintln(out, indent+"  "+l.Text)
+		}
+	}
+}
+
+// highlightPowerShell colors one line of PowerShell for the terminal
+func highlightPowerShell(line string) string {
+	var buf bytes.Buffer
+	if err := quick.Highlight(&buf, line, "powershell", "terminal16m", "native"); err != nil {
+		return line
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// gadgetChange is a gadget that differs between two sets of gadgets
+type gadgetChange struct {
+	Name     string
+	Old, New *gogo.Gadget // nil when the gadget is only on the other side
+}
+
+// Kinds of gadget change
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+func (c gadgetChange) kind() string {
+	switch {
+	case c.Old == nil:
+		return changeAdded
+	case c.New == nil:
+		return changeRemoved
+	}
+	return changeChanged
+}
+
+// diffGadgets lists the gadgets added, removed or changed going from before to after
+func diffGadgets(before, after gogo.Library) []gadgetChange {
+	names := map[string]bool{}
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+	var changes []gadgetChange
+	for _, name := range sortedKeysOf(names) {
+		o, inOld := before[name]
+		n, inNew := after[name]
+		switch {
+		case !inOld:
+			changes = append(changes, gadgetChange{Name: name, New: &n})
+		case !inNew:
+			changes = append(changes, gadgetChange{Name: name, Old: &o})
+		case gogo.GadgetText(o) != gogo.GadgetText(n):
+			changes = append(changes, gadgetChange{Name: name, Old: &o, New: &n})
+		}
+	}
+	return changes
+}
+
+// diffFieldOrder is the order fields are shown in; any others follow alphabetically
+var diffFieldOrder = []string{"description", "type", "command", "steps", "variables", "variableOptions", "workdir", "env", "timeout", "before", "after", "signature"}
+
+// printGadgetChange shows one change; oldLabel and newLabel name the two sides
+func printGadgetChange(c gadgetChange, oldLabel, newLabel string) {
+	switch c.kind() {
+	case changeAdded:
+		colorText.Green(fmt.Sprintf("+ %s (only in %s)", c.Name, newLabel))
+		if c.New.Description != "" {
+			fmt.Printf("    %s\n", c.New.Description)
+		}
+		return
+	case changeRemoved:
+		errorText(fmt.Sprintf("- %s (only in %s)", c.Name, oldLabel))
+		return
+	}
+	colorText.Yellow(fmt.Sprintf("~ %s (changed)", c.Name))
+	before, after := gadgetFields(c.Old), gadgetFields(c.New)
+	seen := map[string]bool{}
+	var fields []string
+	for _, f := range diffFieldOrder {
+		seen[f] = true
+		fields = append(fields, f)
+	}
+	var rest []string
+	for _, m := range []map[string]json.RawMessage{before, after} {
+		for f := range m {
+			if !seen[f] {
+				seen[f] = true
+				rest = append(rest, f)
+			}
+		}
+	}
+	sort.Strings(rest)
+	for _, f := range append(fields, rest...) {
+		if string(before[f]) != string(after[f]) {
+			printFieldDiff(f, before[f], after[f])
+		}
+	}
+}
+
+// printFieldDiff shows how one field of a gadget changed. Commands get a
+// highlighted line diff and variables and environment variables are compared
+// one by one.
+func printFieldDiff(field string, before, after json.RawMessage) {
+	fmt.Printf("    %s:\n", field)
+	switch field {
+	case "command", "before", "after":
+		var o, n string
+		_ = json.Unmarshal(before, &o)
+		_ = json.Unmarshal(after, &n)
+		printLineDiff(lineDiff(o, n), "      ", highlightPowerShell)
+	case "variables", "env":
+		var o, n map[string]string
+		_ = json.Unmarshal(before, &o)
+		_ = json.Unmarshal(after, &n)
+		keys := map[string]bool{}
+		for k := range o {
+			keys[k] = true
+		}
+		for k := range n {
+			keys[k] = true
+		}
+		for _, k := range sortedKeysOf(keys) {
+			ov, inOld := o[k]
+			nv, inNew := n[k]
+			switch {
+			case !inOld:
+				colorText.Green(fmt.Sprintf("      + %s: %s", k, nv))
+			case !inNew:
+				errorText(fmt.Sprintf("      - %s: %s", k, ov))
+			case ov != nv:
+				colorText.Yellow(fmt.Sprintf("      ~ %s: %s → %s", k, ov, nv))
+			}
+		}
+	default:
+		if len(before) > 0 {
+			errorText("      - " + fieldValue(field, before))
+		}
+		if len(after) > 0 {
+			colorText.Green("      + " + fieldValue(field, after))
+		}
+	}
+}
+
+// fieldValue shows a field's value briefly: text as typed, a signature by
+// its author and anything else as JSON
+func fieldValue(field string, raw json.RawMessage) string {
+	if field == "signature" {
+		var sig gogo.Signature
+		if json.Unmarshal(raw, &sig) == nil {
+			return "signed by " + sig.Author
+		}
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// printDiffSummary counts the changes by kind
+func printDiffSummary(changes []gadgetChange) {
+	counts := map[string]int{}
+	for _, c := range changes {
+		counts[c.kind()]++
+	}
+	infoText(fmt.Sprintf("%d added, %d removed, %d changed", counts[changeAdded], counts[changeRemoved], counts[changeChanged]))
+}
+
+// NewDiffCommand returns the 'diff' command for comparing gadget files
+func NewDiffCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <file> [other-file]",
+		Short: "Show how a gadget file differs from your gadgets, or from another file",
+		Long: `Compare a JSON, YAML or TOML gadget file with your gadgets, or two files with
+each other. Added, removed and changed gadgets are listed, with the fields that
+changed and a line diff of commands.
+
+Like other diff tools, it exits with 1 when there are differences.`,
+		Example: `  GoGoGadget diff colleague.yaml
+  GoGoGadget diff old.yaml new.yaml`,
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var before, after gogo.Library
+			var err error
+			oldLabel, newLabel := "your gadgets", filepath.Base(args[0])
+			if len(args) == 1 {
+				if before, err = loadScripts(); err != nil {
+					return err
+				}
+				if after, err = readGadgetFile(args[0]); err != nil {
+					return err
+				}
+			} else {
+				oldLabel, newLabel = filepath.Base(args[0]), filepath.Base(args[1])
+				if before, err = readGadgetFile(args[0]); err != nil {
+					return err
+				}
+				if after, err = readGadgetFile(args[1]); err != nil {
+					return err
+				}
+			}
+			changes := diffGadgets(before, after)
+			if len(changes) == 0 {
+				successText("✅ No differences.")
+				return nil
+			}
+			for _, c := range changes {
+				printGadgetChange(c, oldLabel, newLabel)
+			}
+			printDiffSummary(changes)
+			return &ExitCodeError{Code: 1}
+		},
+	}
+	return cmd
+}
+
+// NewMergeCommand returns the 'merge' command for taking changes from a gadget file
+func NewMergeCommand() *cobra.Command {
+	var add, update, remove bool
+	var only []string
+	cmd := &cobra.Command{
+		Use:   "merge <file>",
+		Short: "Pick changes from a gadget file and apply them to your gadgets",
+		Long: `Apply changes from a JSON, YAML or TOML gadget file to your gadgets. In a
+terminal each change is shown and you choose whether to take it.
+
+--add takes the gadgets you don't have, --update takes the gadgets that
+changed and --remove deletes your gadgets that aren't in the file. --gadget
+limits the merge to the named gadgets.`,
+		Example: `  GoGoGadget merge colleague.yaml
+  GoGoGadget merge colleague.yaml --add --update --gadget restart-vm`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			incoming, err := readGadgetFile(args[0])
+			if err != nil {
+				return err
+			}
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			changes := diffGadgets(scripts, incoming)
+			if len(only) > 0 {
+				var selected []gadgetChange
+				for _, c := range changes {
+					if containsString(only, c.Name) {
+						selected = append(selected, c)
+					}
+				}
+				for _, name := range only {
+					if !containsString(changeNames(selected), name) {
+						warnText(fmt.Sprintf("⚠️ '%s' has no changes to merge.", name))
+					}
+				}
+				changes = selected
+			}
+			if len(changes) == 0 {
+				successText("✅ Nothing to merge.")
+				return nil
+			}
+
+			label := filepath.Base(args[0])
+			var picked []gadgetChange
+			if add || update || remove {
+				for _, c := range changes {
+					switch c.kind() {
+					case changeAdded:
+						if add {
+							picked = append(picked, c)
+						}
+					case changeChanged:
+						if update {
+							picked = append(picked, c)
+						}
+					case changeRemoved:
+						if remove {
+							picked = append(picked, c)
+						}
+					}
+				}
+			} else {
+				if !term.IsTerminal(int(os.Stdin.Fd())) {
+					return fmt.Errorf("choose what to merge with --add, --update or --remove, or run merge in a terminal")
+				}
+				reader := bufio.NewReader(os.Stdin)
+				for _, c := range changes {
+					printGadgetChange(c, "your gadgets", label)
+					question := "Take this change?"
+					switch c.kind() {
+					case changeAdded:
+						question = fmt.Sprintf("Add '%s'?", c.Name)
+					case changeRemoved:
+						question = fmt.Sprintf("Delete your '%s'?", c.Name)
+					}
+					for answered := false; !answered; {
+						fmt.Printf("%s Y/N (q to stop): ", question)
+						answer, _ := reader.ReadString('\n')
+						answered = true
+						switch strings.ToLower(strings.TrimSpace(answer)) {
+						case "y", "yes":
+							picked = append(picked, c)
+						case "n", "no":
+						case "q":
+							warnText("⚠️ Stopped. Nothing was merged.")
+							return &ExitCodeError{Code: 1}
+						default:
+							answered = false
+						}
+					}
+				}
+			}
+			if len(picked) == 0 {
+				infoText("Nothing was merged.")
+				return nil
+			}
+
+			for _, c := range picked {
+				if c.kind() == changeRemoved {
+					delete(scripts, c.Name)
+					continue
+				}
+				config := *c.New
+				config.Dangerous = false // worked out again when saved
+				scripts[c.Name] = config
+			}
+			if err := saveScripts(scripts); err != nil {
+				return err
+			}
+			for _, c := range picked {
+				switch c.kind() {
+				case changeAdded:
+					colorText.Green(fmt.Sprintf("  + %s (added)", c.Name))
+				case changeRemoved:
+					errorText(fmt.Sprintf("  - %s (deleted)", c.Name))
+				default:
+					colorText.Yellow(fmt.Sprintf("  ~ %s (updated)", c.Name))
+				}
+			}
+			successText(fmt.Sprintf("✅ Merged %d changes from %s", len(picked), label))
+			var names []string
+			for _, c := range picked {
+				if c.kind() != changeRemoved {
+					if err := warnImportedGadget(c.Name, scripts[c.Name], scripts); err != nil {
+						return err
+					}
+					names = append(names, c.Name)
+				}
+			}
+			warnUnsigned(names, scripts)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&add, "add", false, "Add the gadgets you don't have")
+	cmd.Flags().BoolVar(&update, "update", false, "Take the gadgets that changed")
+	cmd.Flags().BoolVar(&remove, "remove", false, "Delete your gadgets that aren't in the file")
+	cmd.Flags().StringArrayVar(&only, "gadget", nil, "Only merge this gadget (repeatable)")
+	return cmd
+}
+
+// changeNames returns the names of the changed gadgets
+func changeNames(changes []gadgetChange) []string {
+	names := make([]string, len(changes))
+	for i, c := range changes {
+		names[i] = c.Name
+	}
+	return names
+}
@@ -3,6 +3,7 @@ package scripts
 import (
 	"bufio"
 	"fmt"
+	"gogo/gogo"
 	"os"
 	"strings"
 
@@ -14,6 +15,8 @@ func AddEditCommand(root *cobra.Command) {
 	var newNameFlag string
 	var newDescFlag string
 	var newCmdFlag string
+	var listFlag, noListFlag, stepFlag, envFlag []string
+	var workdirFlag, timeoutFlag, beforeFlag, afterFlag string
 	var editCmd = &cobra.Command{
 		Use:   "edit [gadget name]",
 		Short: "Edit an existing gadget",
@@ -30,8 +33,27 @@ func AddEditCommand(root *cobra.Command) {
 				colorText.Red(fmt.Sprintf("❌ Gadget '%s' not found.", name))
 				return
 			}
+			defer func() {
+				dropStaleSignature(name)
+				warnIfDangerous(name)
+			}()
 
 			// If flags are set, edit directly and exit
+			if cmd.Flags().Changed("list") || cmd.Flags().Changed("no-list") {
+				varNames := gogo.VariableNames(name, script, scripts)
+				if err := setListVariables(&script, varNames, listFlag, true); err != nil {
+					colorText.Red("❌ " + err.Error())
+					return
+				}
+				if err := setListVariables(&script, varNames, noListFlag, false); err != nil {
+					colorText.Red("❌ " + err.Error())
+					return
+				}
+				scripts[name] = script
+				_ = saveScripts(scripts)
+				colorText.Green("✅ Gadget list variables updated.")
+				return
+			}
 			if cmd.Flags().Changed("name") {
 				newName := newNameFlag
 				if newName != "" && newName != name {
@@ -56,6 +78,51 @@ func AddEditCommand(root *cobra.Command) {
 					return
 				}
 			}
+			if cmd.Flags().Changed("workdir") || cmd.Flags().Changed("env") || cmd.Flags().Changed("timeout") ||
+				cmd.Flags().Changed("before") || cmd.Flags().Changed("after") {
+				if cmd.Flags().Changed("workdir") {
+					script.Workdir = workdirFlag
+				}
+				if cmd.Flags().Changed("before") {
+					script.Before = beforeFlag
+				}
+				if cmd.Flags().Changed("after") {
+					script.After = afterFlag
+				}
+				if !cmd.Flags().Changed("timeout") {
+					timeoutFlag = script.Timeout
+				}
+				if err := applyRunSettings(&script, envFlag, timeoutFlag); err != nil {
+					colorText.Red("❌ " + err.Error())
+					return
+				}
+				scripts[name] = script
+				_ = saveScripts(scripts)
+				colorText.Green("✅ Gadget run settings updated.")
+				return
+			}
+			if cmd.Flags().Changed("step") {
+				var steps []gogo.WorkflowStep
+				for _, spec := range stepFlag {
+					step, err := parseWorkflowStep(spec)
+					if err != nil {
+						colorText.Red("❌ " + err.Error())
+						return
+					}
+					steps = append(steps, step)
+				}
+				script.Type = gogo.TypeWorkflow
+				script.Command = ""
+				script.Steps = steps
+				if err := gogo.ValidateWorkflow(name, script, scripts); err != nil {
+					colorText.Red("❌ " + err.Error())
+					return
+				}
+				scripts[name] = script
+				_ = saveScripts(scripts)
+				colorText.Green("✅ Workflow steps updated.")
+				return
+			}
 			if cmd.Flags().Changed("description") {
 				newDesc := newDescFlag
 				if newDesc != "" {
@@ -106,7 +173,14 @@ func AddEditCommand(root *cobra.Command) {
 				fmt.Printf("\nEditing gadget: %s\n", name)
 				fmt.Printf("1. Name: %s\n", name)
 				fmt.Printf("2. Description: %s\n", script.Description)
-				fmt.Printf("3. Command: %s\n", script.Command)
+				if script.IsWorkflow() {
+					fmt.Println("3. Steps (edit with --step):")
+					for i, step := range script.Steps {
+						fmt.Printf("   %d) %s\n", i+1, formatWorkflowStep(step))
+					}
+				} else {
+					fmt.Printf("3. Command: %s\n", script.Command)
+				}
 				fmt.Println("4. Variables:")
 				idx := 5
 				varKeys := []string{}
@@ -135,6 +209,10 @@ func AddEditCommand(root *cobra.Command) {
 					script.Description = strings.TrimSpace(desc)
 					scripts[name] = script
 				case "3":
+					if script.IsWorkflow() {
+						colorText.Yellow("Workflow steps are edited with 'GoGoGadget edit " + name + " --step ...'.")
+						continue
+					}
 					fmt.Printf("Current: %s\nEnter new PowerShell command this gadget will run: ", script.Command)
 					cmdStr, _ := reader.ReadString('\n')
 					cmdStr = strings.TrimSpace(cmdStr)
@@ -166,5 +244,13 @@ func AddEditCommand(root *cobra.Command) {
 	editCmd.Flags().StringVar(&newNameFlag, "name", "", "Edit the gadget's name directly")
 	editCmd.Flags().StringVar(&newDescFlag, "description", "", "Edit the gadget's description directly")
 	editCmd.Flags().StringVar(&newCmdFlag, "command", "", "Edit the gadget's command directly")
+	editCmd.Flags().StringVar(&workdirFlag, "workdir", "", "Set the folder the command runs in (empty to clear)")
+	editCmd.Flags().StringArrayVar(&envFlag, "env", nil, "Set an environment variable as KEY=VALUE, or remove one with KEY= (repeatable)")
+	editCmd.Flags().StringVar(&timeoutFlag, "timeout", "", "Set the gadget's timeout, e.g. 30s or 5m (empty to clear)")
+	editCmd.Flags().StringVar(&beforeFlag, "before", "", "Set the command run before the gadget (empty to clear)")
+	editCmd.Flags().StringVar(&afterFlag, "after", "", "Set the command run after the gadget (empty to clear)")
+	editCmd.Flags().StringArrayVar(&stepFlag, "step", nil, "Replace the workflow's steps (repeatable, in order)")
+	editCmd.Flags().StringSliceVar(&listFlag, "list", nil, "Mark variables as lists (the gadget runs once per value)")
+	editCmd.Flags().StringSliceVar(&noListFlag, "no-list", nil, "Mark variables as single values again")
 	root.AddCommand(editCmd)
 }
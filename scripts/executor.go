@@ -0,0 +1,16 @@
+package scripts
+
+import (
+	"gogo/gogo"
+	"os"
+)
+
+// ExitCodeError ends GoGoGadget with a specific exit code. When Err is nil the
+// problem has already been reported to the user and nothing more is printed.
+type ExitCodeError = gogo.ExitCodeError
+
+// defaultRunner returns a runner connected to the terminal. Gadgets get the
+// terminal while they run, and Ctrl+C comes back to NotifyInterrupts.
+func defaultRunner() gogo.Runner {
+	return gogo.Runner{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr, Foreground: true, RaiseInterrupt: true}
+}
@@ -0,0 +1,757 @@
+package scripts
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/alecthomas/chroma"
+	"github.com/spf13/cobra"
+)
+
+// Export formats
+const (
+	ExportFormatPS1    = "ps1"
+	ExportFormatModule = "module"
+)
+
+// psReservedNames are PowerShell automatic variables a parameter can't be named after
+var psReservedNames = map[string]bool{
+	"args": true, "input": true, "host": true, "error": true, "home": true, "pwd": true, "this": true,
+	"true": true, "false": true, "null": true, "matches": true, "profile": true, "pid": true,
+	"psitem": true, "lastexitcode": true, "myinvocation": true, "executioncontext": true,
+	"shellid": true, "psboundparameters": true, "pscmdlet": true, "event": true, "sender": true,
+	"foreach": true, "switch": true, "ofs": true, "stacktrace": true, "psscriptroot": true,
+	"pscommandpath": true, "_": true,
+}
+
+// psApprovedVerbs maps approved PowerShell verbs (lowercase) to their spelling
+var psApprovedVerbs = map[string]string{}
+
+func init() {
+	for _, v := range strings.Fields(`Add Clear Close Copy Enter Exit Find Format Get Hide Join Lock Move New Open
+		Optimize Pop Push Redo Remove Rename Reset Resize Search Select Set Show Skip Split Step Switch Undo
+		Unlock Watch Connect Disconnect Read Receive Send Write Backup Checkpoint Compare Compress Convert
+		ConvertFrom ConvertTo Dismount Edit Expand Export Group Import Initialize Limit Merge Mount Out
+		Publish Restore Save Sync Unpublish Update Approve Assert Build Complete Confirm Deny Deploy Disable
+		Enable Install Invoke Register Request Restart Resume Start Stop Submit Suspend Uninstall Unregister
+		Wait Debug Measure Ping Repair Resolve Test Trace Block Grant Protect Revoke Unblock Unprotect Use`) {
+		psApprovedVerbs[strings.ToLower(v)] = v
+	}
+}
+
+// psVarName returns the PowerShell variable name for a gadget variable
+func psVarName(v string) string {
+	if psReservedNames[strings.ToLower(v)] {
+		return v + "Value"
+	}
+	return v
+}
+
+// psFunctionName suggests a Verb-Noun name for a gadget: "restart-vm" becomes
+// Restart-Vm, and names that don't start with an approved verb get Invoke-
+func psFunctionName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' || r == ' ' })
+	for i, p := range parts {
+		runes := []rune(p)
+		runes[0] = unicode.ToUpper(runes[0])
+		parts[i] = string(runes)
+	}
+	if len(parts) == 0 {
+		return "Invoke-Gadget"
+	}
+	if verb, ok := psApprovedVerbs[strings.ToLower(parts[0])]; ok && len(parts) > 1 {
+		return verb + "-" + strings.Join(parts[1:], "")
+	}
+	return "Invoke-" + strings.Join(parts, "")
+}
+
+// psSingleQuoted quotes s as a PowerShell literal string
+func psSingleQuoted(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// psLookup returns the PowerShell name for a gadget variable. Variables that
+// aren't parameters, like built-in ones, keep their own name.
+func psLookup(names map[string]string, v string) string {
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return v
+}
+
+// psTemplateString turns a GoGoGadget value template like "C:\{{dir}}" into a
+// PowerShell expression: $dir for a lone variable, otherwise a double-quoted string
+func psTemplateString(tmpl string, names map[string]string) string {
+	if m := templateVariableRe.FindStringSubmatch(tmpl); m != nil && m[0] == tmpl {
+		return "$" + psLookup(names, m[1])
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	last := 0
+	for _, loc := range templateVariableRe.FindAllStringSubmatchIndex(tmpl, -1) {
+		lit := tmpl[last:loc[0]]
+		lit = strings.NewReplacer("`", "``", `"`, "`\"", "$", "`$").Replace(lit)
+		b.WriteString(lit)
+		b.WriteString("${" + psLookup(names, tmpl[loc[2]:loc[3]]) + "}")
+		last = loc[1]
+	}
+	b.WriteString(strings.NewReplacer("`", "``", `"`, "`\"", "$", "`$").Replace(tmpl[last:]))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// psParamPrefixRe matches a parameter name written with its value, like -Force:
+var psParamPrefixRe = regexp.MustCompile(`^-[A-Za-z_][A-Za-z0-9_]*:`)
+
+// rewritePlaceholders turns a gadget command into plain PowerShell by replacing
+// each {{variable}} with a PowerShell variable, keeping the meaning it had where it
+// stood: $var on its own or after -Name:, ${var} inside double quotes,
+// ('text' + $var) inside single quotes and "text${var}" when it was part of a
+// longer word
+func rewritePlaceholders(command string, names map[string]string) string {
+	toVar := func(braced bool) func(string) string {
+		return func(p string) string {
+			name := psLookup(names, placeholderRe.FindStringSubmatch(p)[1])
+			if braced {
+				return "${" + name + "}"
+			}
+			return "$" + name
+		}
+	}
+
+	var out, word strings.Builder
+	flushWord := func() {
+		w := word.String()
+		word.Reset()
+		// -Name:{{v}} binds the value to the parameter; quoting the whole
+		// word would make it a positional argument instead
+		if prefix := psParamPrefixRe.FindString(w); prefix != "" && prefix != w {
+			out.WriteString(prefix)
+			w = w[len(prefix):]
+		}
+		switch m := placeholderRe.FindStringSubmatch(w); {
+		case m == nil:
+			out.WriteString(w)
+		case m[0] == w:
+			out.WriteString(toVar(false)(w))
+		default:
+			w = strings.ReplaceAll(w, `"`, "`\"")
+			out.WriteString(`"` + placeholderRe.ReplaceAllStringFunc(w, toVar(true)) + `"`)
+		}
+	}
+
+	for _, token := range tokenizePowerShell(command) {
+		switch {
+		case token.Type == chroma.Text || token.Type.InCategory(chroma.Comment):
+			flushWord()
+			out.WriteString(placeholderRe.ReplaceAllStringFunc(token.Value, toVar(false)))
+		case token.Type == chroma.LiteralStringSingle:
+			flushWord()
+			out.WriteString(rewriteSingleQuoted(token.Value, toVar(false)))
+		case token.Type.InCategory(chroma.LiteralString):
+			flushWord()
+			out.WriteString(placeholderRe.ReplaceAllStringFunc(token.Value, toVar(true)))
+		case token.Type == chroma.Punctuation && strings.ContainsAny(token.Value, ";|&(){},="):
+			flushWord()
+			out.WriteString(token.Value)
+		default:
+			word.WriteString(token.Value)
+		}
+	}
+	flushWord()
+	return out.String()
+}
+
+// rewriteSingleQuoted splits a single-quoted string around its placeholders and
+// joins the pieces back together with +
+func rewriteSingleQuoted(s string, toVar func(string) string) string {
+	if !placeholderRe.MatchString(s) {
+		return s
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(s, "'"), "'")
+	var pieces []string
+	last := 0
+	for _, loc := range placeholderRe.FindAllStringIndex(inner, -1) {
+		if lit := inner[last:loc[0]]; lit != "" {
+			pieces = append(pieces, "'"+lit+"'")
+		}
+		pieces = append(pieces, toVar(inner[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	if lit := inner[last:]; lit != "" {
+		pieces = append(pieces, "'"+lit+"'")
+	}
+	if len(pieces) == 1 {
+		return pieces[0]
+	}
+	return "(" + strings.Join(pieces, " + ") + ")"
+}
+
+// indent prefixes every non-empty line of s with depth levels of four spaces
+func indent(s string, depth int) string {
+	prefix := strings.Repeat("    ", depth)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// psParam is one parameter of an exported script or function
+type psParam struct {
+	Var     string // the gadget variable
+	Name    string // the PowerShell parameter name
+	Help    string
+	List    bool
+	Type    string  // the variable's type, see gogo.VariableOption
+	Default *string // the variable's default, if it has one
+}
+
+// psVariableNames returns the variables of an exported gadget. Hooks aren't
+// exported, so variables only they use are left out.
+func psVariableNames(name string, config gogo.Gadget, scripts gogo.Library) []string {
+	lib := make(gogo.Library, len(scripts))
+	for n, g := range scripts {
+		g.Before, g.After = "", ""
+		lib[n] = g
+	}
+	config.Before, config.After = "", ""
+	return gogo.VariableNames(name, config, lib)
+}
+
+// psParams returns the parameters for a gadget's variables
+func psParams(name string, config gogo.Gadget, scripts gogo.Library) []psParam {
+	var params []psParam
+	for _, v := range psVariableNames(name, config, scripts) {
+		params = append(params, psParam{
+			Var:     v,
+			Name:    psVarName(v),
+			Help:    config.VariableDescription(v),
+			List:    config.IsListVariable(v),
+			Type:    config.VariableOptions[v].Type,
+			Default: config.VariableOptions[v].Default,
+		})
+	}
+	return params
+}
+
+// psHelp returns comment-based help for a gadget
+func psHelp(name string, config gogo.Gadget, params []psParam, example string) string {
+	var b strings.Builder
+	b.WriteString("<#\n.SYNOPSIS\n")
+	b.WriteString(indent(config.Description, 1) + "\n")
+	b.WriteString(fmt.Sprintf("\n.DESCRIPTION\n    Exported from the GoGoGadget gadget '%s'.\n", name))
+	for _, p := range params {
+		b.WriteString(fmt.Sprintf("\n.PARAMETER %s\n%s\n", p.Name, indent(p.Help, 1)))
+	}
+	b.WriteString("\n.EXAMPLE\n    " + example)
+	for _, p := range params {
+		if psParamType(p) == "[switch]" {
+			b.WriteString(" -" + p.Name)
+			continue
+		}
+		b.WriteString(fmt.Sprintf(" -%s <%s>", p.Name, p.Var))
+	}
+	b.WriteString("\n#>\n")
+	return b.String()
+}
+
+// psParamBlock returns [CmdletBinding()] and the param() block
+func psParamBlock(params []psParam) string {
+	var b strings.Builder
+	b.WriteString("[CmdletBinding()]\nparam(")
+	for i, p := range params {
+		typ := psParamType(p)
+		switch {
+		case typ == "[switch]":
+			b.WriteString(fmt.Sprintf("\n    [Parameter(HelpMessage = %s)]\n    %s$%s", psSingleQuoted(p.Help), typ, p.Name))
+			if def, _ := gogo.PowerShellBool(derefString(p.Default)); def == "$true" {
+				b.WriteString(" = $true")
+			}
+		case p.Default != nil:
+			b.WriteString(fmt.Sprintf("\n    [Parameter(HelpMessage = %s)]\n    %s$%s = %s", psSingleQuoted(p.Help), typ, p.Name, psDefaultValue(p)))
+		default:
+			b.WriteString(fmt.Sprintf("\n    [Parameter(Mandatory, HelpMessage = %s)]\n    %s$%s", psSingleQuoted(p.Help), typ, p.Name))
+		}
+		if i < len(params)-1 {
+			b.WriteString(",")
+		}
+	}
+	if len(params) > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString(")\n")
+	return b.String()
+}
+
+// psParamType returns the PowerShell type of a parameter
+func psParamType(p psParam) string {
+	typ := "string"
+	switch p.Type {
+	case gogo.VariableTypeInt:
+		typ = "long"
+	case gogo.VariableTypeNumber:
+		typ = "double"
+	case gogo.VariableTypeBool:
+		if !p.List {
+			return "[switch]"
+		}
+		typ = "bool"
+	}
+	if p.List {
+		return "[" + typ + "[]]"
+	}
+	return "[" + typ + "]"
+}
+
+// psDefaultValue returns a parameter's default as a PowerShell literal. List
+// defaults hold comma-separated values.
+func psDefaultValue(p psParam) string {
+	values := []string{*p.Default}
+	if p.List {
+		values = strings.Split(*p.Default, ",")
+	}
+	for i, v := range values {
+		v = strings.TrimSpace(v)
+		switch p.Type {
+		case gogo.VariableTypeBool:
+			if b, ok := gogo.PowerShellBool(v); ok {
+				v = b
+			}
+			values[i] = v
+		case gogo.VariableTypeInt, gogo.VariableTypeNumber:
+			values[i] = v
+		default:
+			values[i] = psSingleQuoted(v)
+		}
+	}
+	if p.List {
+		return "@(" + strings.Join(values, ", ") + ")"
+	}
+	return values[0]
+}
+
+// derefString returns *s, or "" when s is nil
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// psBody returns the statements that do what the gadget does
+func psBody(name string, config gogo.Gadget, scripts gogo.Library, params []psParam, functions map[string]string) string {
+	names := map[string]string{}
+	for _, p := range params {
+		names[p.Var] = p.Name
+	}
+	if config.IsWorkflow() {
+		return psWorkflowBody(config, scripts, names, functions)
+	}
+
+	// Loops over list variables run the command once per value, like GoGoGadget does
+	inner := names
+	var loops []string
+	for _, p := range params {
+		if p.List {
+			if len(loops) == 0 {
+				inner = map[string]string{}
+				for k, v := range names {
+					inner[k] = v
+				}
+			}
+			inner[p.Var] = p.Name + "Item"
+			loops = append(loops, fmt.Sprintf("foreach ($%sItem in $%s) {", p.Name, p.Name))
+		}
+	}
+	body := rewritePlaceholders(strings.TrimSpace(config.Command), inner)
+	for i := len(loops) - 1; i >= 0; i-- {
+		body = loops[i] + "\n" + indent(body, 1) + "\n}"
+	}
+
+	if config.Workdir == "" && len(config.Env) == 0 {
+		return body + "\n"
+	}
+	var setup, cleanup strings.Builder
+	if len(config.Env) > 0 {
+		setup.WriteString("$savedEnv = @{}\n")
+		for _, k := range sortedKeys(config.Env) {
+			setup.WriteString(fmt.Sprintf("$savedEnv[%s] = [Environment]::GetEnvironmentVariable(%s)\n", psSingleQuoted(k), psSingleQuoted(k)))
+			setup.WriteString(fmt.Sprintf("[Environment]::SetEnvironmentVariable(%s, %s)\n", psSingleQuoted(k), psTemplateString(config.Env[k], names)))
+		}
+		cleanup.WriteString("foreach ($envName in $savedEnv.Keys) { [Environment]::SetEnvironmentVariable($envName, $savedEnv[$envName]) }\n")
+	}
+	if config.Workdir != "" {
+		setup.WriteString(fmt.Sprintf("Push-Location -LiteralPath %s\n", psTemplateString(config.Workdir, names)))
+		cleanup.WriteString("Pop-Location\n")
+	}
+	return setup.String() + "try {\n" + indent(body, 1) + "\n} finally {\n" + indent(strings.TrimSuffix(cleanup.String(), "\n"), 1) + "\n}\n"
+}
+
+// psWorkflowBody calls the function of each step's gadget in order
+func psWorkflowBody(config gogo.Gadget, scripts gogo.Library, names, functions map[string]string) string {
+	names = copyStringMap(names)
+	var b strings.Builder
+	for i, step := range config.Steps {
+		stepConfig, ok := scripts[step.Gadget]
+		if !ok {
+			b.WriteString(fmt.Sprintf("throw \"Step %d: gadget '%s' was not found when this was exported\"\n", i+1, step.Gadget))
+			continue
+		}
+		call := psLookupFunction(functions, step.Gadget)
+		for _, p := range psParams(step.Gadget, stepConfig, scripts) {
+			value := "$" + psLookup(names, p.Var)
+			if tmpl, mapped := step.Variables[p.Var]; mapped {
+				value = psTemplateString(tmpl, names)
+			}
+			if psParamType(p) == "[switch]" {
+				call += fmt.Sprintf(" -%s:%s", p.Name, value) // a switch takes no separate value
+			} else {
+				call += fmt.Sprintf(" -%s %s", p.Name, value)
+			}
+		}
+		if step.Capture != "" {
+			names[step.Capture] = psVarName(step.Capture)
+			if step.CaptureField != "" {
+				call = fmt.Sprintf("$%s = (%s | Out-String | ConvertFrom-Json)%s", names[step.Capture], call, psFieldPath(step.CaptureField))
+			} else {
+				call = fmt.Sprintf("$%s = (%s | Out-String).Trim()", names[step.Capture], call)
+			}
+		}
+		b.WriteString(fmt.Sprintf("# Step %d: %s\n", i+1, step.Gadget))
+		if step.ContinueOnError {
+			b.WriteString(fmt.Sprintf("try {\n    %s\n} catch {\n    Write-Warning \"Step %d (%s) failed: $_\"\n}\n", call, i+1, step.Gadget))
+		} else {
+			b.WriteString(call + "\n")
+		}
+	}
+	return b.String()
+}
+
+// psFieldPath turns a capture field like "items.0.Name" into ".items[0].Name"
+func psFieldPath(field string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(field, ".") {
+		if part != "" && strings.Trim(part, "0123456789") == "" {
+			b.WriteString("[" + part + "]")
+		} else {
+			b.WriteString("." + part)
+		}
+	}
+	return b.String()
+}
+
+// copyStringMap returns a copy of m
+func copyStringMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// psStepGadgets returns the gadgets a workflow calls, directly or through other
+// workflows, in the order they are first used
+func psStepGadgets(name string, config gogo.Gadget, scripts gogo.Library) []string {
+	var order []string
+	seen := map[string]bool{name: true}
+	var walk func(gogo.Gadget)
+	walk = func(c gogo.Gadget) {
+		for _, step := range c.Steps {
+			stepConfig, ok := scripts[step.Gadget]
+			if !ok || seen[step.Gadget] {
+				continue
+			}
+			seen[step.Gadget] = true
+			walk(stepConfig)
+			order = append(order, step.Gadget)
+		}
+	}
+	walk(config)
+	return order
+}
+
+// psFunctionNames picks a function name for each gadget. PowerShell names are
+// case-insensitive, so when two gadgets end up with the same name the later one
+// (in the order given) gets a number, e.g. Invoke-Backup2. Names of commands the
+// gadgets run are skipped too: a function named Restart-VM would hide the cmdlet
+// from a gadget that calls it.
+func psFunctionNames(names []string, scripts gogo.Library) map[string]string {
+	functions := make(map[string]string, len(names))
+	taken := map[string]bool{}
+	for _, name := range names {
+		config := scripts[name]
+		for _, command := range []string{config.Before, config.Command, config.After} {
+			for _, call := range parseCommandCalls(command) {
+				taken[strings.ToLower(call.Name)] = true
+			}
+		}
+	}
+	for _, name := range names {
+		base := psFunctionName(name)
+		fn := base
+		for i := 2; taken[strings.ToLower(fn)]; i++ {
+			fn = fmt.Sprintf("%s%d", base, i)
+		}
+		taken[strings.ToLower(fn)] = true
+		functions[name] = fn
+	}
+	return functions
+}
+
+// psLookupFunction returns the function name picked for a gadget
+func psLookupFunction(functions map[string]string, name string) string {
+	if fn, ok := functions[name]; ok {
+		return fn
+	}
+	return psFunctionName(name)
+}
+
+// psFunction returns a gadget as a PowerShell advanced function
+func psFunction(name string, config gogo.Gadget, scripts gogo.Library, functions map[string]string) string {
+	fn := psLookupFunction(functions, name)
+	params := psParams(name, config, scripts)
+	inner := psHelp(name, config, params, fn) + psParamBlock(params) + "\n" + psBody(name, config, scripts, params, functions)
+	return "function " + fn + " {\n" + indent(strings.TrimSuffix(inner, "\n"), 1) + "\n}\n"
+}
+
+// exportWarnings lists what a gadget does in GoGoGadget that the export can't
+func exportWarnings(name string, config gogo.Gadget) []string {
+	var warnings []string
+	if config.Timeout != "" {
+		warnings = append(warnings, fmt.Sprintf("'%s' has a timeout of %s, which isn't exported", name, config.Timeout))
+	}
+	if config.Before != "" || config.After != "" {
+		warnings = append(warnings, fmt.Sprintf("the before/after hooks of '%s' aren't exported", name))
+	}
+	for _, v := range extractBuiltinVariables(config.Command) {
+		warnings = append(warnings, fmt.Sprintf("{{%s}} in '%s' is only set by GoGoGadget and will be empty", v, name))
+	}
+	return warnings
+}
+
+// extractBuiltinVariables returns the built-in variables a command uses
+func extractBuiltinVariables(command string) []string {
+	var vars []string
+	for _, m := range templateVariableRe.FindAllStringSubmatch(command, -1) {
+		if gogo.IsBuiltinVariable(m[1]) && !containsString(vars, m[1]) {
+			vars = append(vars, m[1])
+		}
+	}
+	return vars
+}
+
+// exportPS1 returns a gadget as a standalone script. Workflows carry the
+// functions of their step gadgets along with them.
+func exportPS1(name string, config gogo.Gadget, scripts gogo.Library) (string, []string) {
+	params := psParams(name, config, scripts)
+	warnings := exportWarnings(name, config)
+
+	steps := psStepGadgets(name, config, scripts)
+	functions := psFunctionNames(steps, scripts)
+
+	var b strings.Builder
+	b.WriteString(psHelp(name, config, params, ".\\"+name+".ps1"))
+	b.WriteString(psParamBlock(params))
+	for _, step := range steps {
+		b.WriteString("\n" + psFunction(step, scripts[step], scripts, functions))
+		warnings = append(warnings, exportWarnings(step, scripts[step])...)
+	}
+	b.WriteString("\n" + psBody(name, config, scripts, params, functions))
+	return b.String(), warnings
+}
+
+// DefaultModuleName is the module name used when --module-name isn't given
+const DefaultModuleName = "GoGoGadgets"
+
+// moduleGUID derives a module's GUID from its name, so re-exporting keeps the
+// same GUID instead of making a new one each time. It is a name-based (version 5) UUID.
+func moduleGUID(moduleName string) string {
+	sum := sha1.Sum([]byte("gogogadget-module\n" + moduleName))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// psStringList returns a PowerShell array of single-quoted strings, one per line
+func psStringList(items []string, level int) string {
+	if len(items) == 0 {
+		return "@()"
+	}
+	var b strings.Builder
+	b.WriteString("@(\n")
+	for i, item := range items {
+		b.WriteString(strings.Repeat("    ", level+1) + psSingleQuoted(item))
+		if i < len(items)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(strings.Repeat("    ", level) + ")")
+	return b.String()
+}
+
+// exportModule returns every gadget as a function in a script module (.psm1) and
+// its manifest (.psd1). Gadgets are written in name order and nothing depends on
+// the time of export, so the same library always gives the same files.
+func exportModule(moduleName, version string, scripts gogo.Library) (psm1, psd1 string, warnings []string) {
+	names := make([]string, 0, len(scripts))
+	for name := range scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	functions := psFunctionNames(names, scripts)
+
+	exported := make([]string, 0, len(names))
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("# %s.psm1 was exported from GoGoGadget. Edit the gadgets and export again\n", moduleName))
+	b.WriteString("# rather than changing this file by hand.\n")
+	for _, name := range names {
+		config := scripts[name]
+		b.WriteString("\n" + psFunction(name, config, scripts, functions))
+		warnings = append(warnings, exportWarnings(name, config)...)
+		exported = append(exported, functions[name])
+	}
+	sort.Strings(exported)
+	b.WriteString("\nExport-ModuleMember -Function " + psStringList(exported, 0) + "\n")
+
+	var m strings.Builder
+	m.WriteString("@{\n")
+	m.WriteString(fmt.Sprintf("    RootModule        = %s\n", psSingleQuoted(moduleName+".psm1")))
+	m.WriteString(fmt.Sprintf("    ModuleVersion     = %s\n", psSingleQuoted(version)))
+	m.WriteString(fmt.Sprintf("    GUID              = %s\n", psSingleQuoted(moduleGUID(moduleName))))
+	m.WriteString(fmt.Sprintf("    Description       = %s\n", psSingleQuoted("Gadgets exported from GoGoGadget")))
+	m.WriteString("    PowerShellVersion = '5.1'\n")
+	m.WriteString("    FunctionsToExport = " + psStringList(exported, 1) + "\n")
+	m.WriteString("    CmdletsToExport   = @()\n")
+	m.WriteString("    VariablesToExport = @()\n")
+	m.WriteString("    AliasesToExport   = @()\n")
+	m.WriteString("}\n")
+	return b.String(), m.String(), warnings
+}
+
+// NewExportCommand returns the 'export' command
+func NewExportCommand() *cobra.Command {
+	var format, output, moduleName, moduleVersion string
+	cmd := &cobra.Command{
+		Use:   "export [gadget]",
+		Short: "Export gadgets as PowerShell scripts, a module, or JSON, YAML or TOML",
+		Long: `Export a gadget as a PowerShell script that runs without GoGoGadget. Variables
+become parameters with help taken from their descriptions.
+
+With --format module every gadget becomes a function in a PowerShell module
+(a .psm1 and .psd1 in the output folder) that can be loaded with Import-Module.
+Exporting the same gadgets again gives the same files.
+
+With --format json, yaml or toml the gadget (and the gadgets its workflow
+runs), or every gadget when none is named, is written as a file that
+'GoGoGadget import' reads back.`,
+		Example: `  GoGoGadget export backup --format ps1 -o backup.ps1
+  GoGoGadget export --format module -o .\GoGoGadgets
+  GoGoGadget export --format yaml -o gadgets.yaml`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			switch format {
+			case gogo.FormatJSON, gogo.FormatYAML, gogo.FormatTOML:
+				return exportGadgetFile(scripts, args, format, output)
+			case ExportFormatModule:
+				if len(args) > 0 {
+					return fmt.Errorf("a module holds every gadget; leave out the gadget name")
+				}
+				return writeModule(scripts, moduleName, moduleVersion, output)
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("name the gadget to export, or use --format %s for all of them", ExportFormatModule)
+			}
+
+			name := args[0]
+			config, ok := scripts[name]
+			if !ok {
+				return fmt.Errorf("gadget '%s' not found", name)
+			}
+
+			var content string
+			var warnings []string
+			switch format {
+			case ExportFormatPS1:
+				content, warnings = exportPS1(name, config, scripts)
+				if output == "" {
+					output = name + ".ps1"
+				}
+			default:
+				return fmt.Errorf("unknown format '%s'; use %s, %s, %s, %s or %s", format, ExportFormatPS1, ExportFormatModule, gogo.FormatJSON, gogo.FormatYAML, gogo.FormatTOML)
+			}
+
+			printExportWarnings(warnings)
+			if output == "-" {
+				fmt.Print(content)
+				return nil
+			}
+			if err := os.WriteFile(output, []byte(content), 0644); err != nil {
+				return err
+			}
+			successText(fmt.Sprintf("✅ Exported '%s' to %s", name, output))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", ExportFormatPS1, "Export format: ps1, module, json, yaml or toml")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File to write (default: <gadget>.<format>; - for the terminal), or folder for a module (default: the module name)")
+	cmd.Flags().StringVar(&moduleName, "module-name", DefaultModuleName, "Name of the module (--format module)")
+	cmd.Flags().StringVar(&moduleVersion, "module-version", "1.0.0", "Version written to the module manifest (--format module)")
+	return cmd
+}
+
+// printExportWarnings shows what an export left out, sorted so repeated exports match
+func printExportWarnings(warnings []string) {
+	sort.Strings(warnings)
+	for _, w := range warnings {
+		warnText("⚠️ " + w)
+	}
+}
+
+// moduleVersionRe matches the versions PowerShell accepts in a manifest, e.g. 1.2 or 1.2.0.4
+var moduleVersionRe = regexp.MustCompile(`^\d+(\.\d+){1,3}$`)
+
+// writeModule exports every gadget as a module into dir
+func writeModule(scripts gogo.Library, moduleName, version, dir string) error {
+	if len(scripts) == 0 {
+		return fmt.Errorf("there are no gadgets to export")
+	}
+	if moduleName == "" || strings.ContainsAny(moduleName, `/\:*?"<>|`) {
+		return fmt.Errorf("'%s' can't be used as a module name", moduleName)
+	}
+	if !moduleVersionRe.MatchString(version) {
+		return fmt.Errorf("'%s' isn't a module version; use numbers like 1.2.0", version)
+	}
+	if dir == "" {
+		dir = moduleName
+	}
+	psm1, psd1, warnings := exportModule(moduleName, version, scripts)
+	printExportWarnings(warnings)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, moduleName+".psm1"), []byte(psm1), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, moduleName+".psd1"), []byte(psd1), 0644); err != nil {
+		return err
+	}
+	successText(fmt.Sprintf("✅ Exported %d gadgets to the module %s in %s", len(scripts), moduleName, dir))
+	return nil
+}
@@ -0,0 +1,102 @@
+package scripts
+
+import (
+	"gogo/gogo"
+	"strings"
+	"testing"
+)
+
+func TestRewritePlaceholders(t *testing.T) {
+	names := map[string]string{"dir": "dir", "force": "force", "name": "name", "args": "argsValue"}
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"Get-Item {{dir}}", "Get-Item $dir"},
+		{"Get-Item '{{dir}}'", "Get-Item $dir"},
+		{`Remove-Item -Path '{{dir}}\*' -Force:{{force}}`, `Remove-Item -Path ($dir + '\*') -Force:$force`},
+		{`Get-Item -Path:C:\{{dir}}`, `Get-Item -Path:"C:\${dir}"`},
+		{`Write-Output "Hello {{name}}!"`, `Write-Output "Hello ${name}!"`},
+		{`Write-Output 'it''s {{name}}'`, `Write-Output ('it''s ' + $name)`},
+		{`Copy-Item C:\{{dir}}\x .`, `Copy-Item "C:\${dir}\x" .`},
+		{"Write-Output {{args}}", "Write-Output $argsValue"},
+	}
+	for _, tt := range tests {
+		if got := rewritePlaceholders(tt.command, names); got != tt.want {
+			t.Errorf("rewritePlaceholders(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+// exportTestLibrary has a gadget with a switch, a list and a hook, and a
+// workflow that runs it
+func exportTestLibrary() gogo.Library {
+	yes := "true"
+	return gogo.Library{
+		"clean": {
+			Description: "Clean folders",
+			Command:     `Remove-Item -Path '{{dir}}\*' -Force:{{force}} -Recurse`,
+			Variables:   map[string]string{"dir": "Folders to clean", "force": "Skip prompts", "note": "Message"},
+			VariableOptions: map[string]gogo.VariableOption{
+				"dir":   {List: true},
+				"force": {Type: gogo.VariableTypeBool},
+			},
+			After: "Write-Output '{{note}}'",
+		},
+		"nightly": {
+			Description: "Nightly cleanup",
+			Type:        gogo.TypeWorkflow,
+			Steps:       []gogo.WorkflowStep{{Gadget: "clean", Variables: map[string]string{"force": "{{always}}"}}},
+			Variables:   map[string]string{"dir": "", "always": ""},
+			VariableOptions: map[string]gogo.VariableOption{
+				"always": {Type: gogo.VariableTypeBool, Default: &yes},
+			},
+		},
+	}
+}
+
+func TestExportPS1(t *testing.T) {
+	lib := exportTestLibrary()
+	tests := []struct {
+		gadget  string
+		want    []string
+		notWant []string
+	}{
+		{
+			gadget: "clean",
+			want: []string{
+				"[string[]]$dir",
+				"[switch]$force",
+				"foreach ($dirItem in $dir) {",
+				`Remove-Item -Path ($dirItem + '\*') -Force:$force -Recurse`,
+			},
+			// The hook isn't exported, so neither is the variable only it uses
+			notWant: []string{"$note", "-Force:\"", "-Force:${"},
+		},
+		{
+			gadget: "nightly",
+			want: []string{
+				"[switch]$always = $true",
+				"function Invoke-Clean {",
+				"Invoke-Clean -dir $dir -force:$always",
+			},
+			notWant: []string{"-force $always", "$note"},
+		},
+	}
+	for _, tt := range tests {
+		script, warnings := exportPS1(tt.gadget, lib[tt.gadget], lib)
+		for _, want := range tt.want {
+			if !strings.Contains(script, want) {
+				t.Errorf("%s: the script doesn't contain %q:\n%s", tt.gadget, want, script)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(script, notWant) {
+				t.Errorf("%s: the script contains %q:\n%s", tt.gadget, notWant, script)
+			}
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0], "hooks of 'clean'") {
+			t.Errorf("%s: warnings %v, want only the one about hooks", tt.gadget, warnings)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package scripts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"gogo/gogo"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-colorable"
+	"github.com/spf13/cobra"
+)
+
+// collectVariableValues gathers the values for each variable from flags, positional
+// args and prompts. A variable supplied more than once (or declared as a list) can
+// end up with several values, and the gadget then runs once per value.
+func collectVariableValues(cmd *cobra.Command, args []string, varNames []string, config gogo.Gadget) (map[string][]string, error) {
+	given := make(map[string][]string)
+
+	// Flags first, then provided args matched to variables by order
+	for i, varName := range varNames {
+		var raw []string
+		if flag := cmd.Flags().Lookup(varName); flag != nil && flag.Value.Type() == "stringArray" {
+			raw, _ = cmd.Flags().GetStringArray(varName)
+		}
+		if len(raw) == 0 && i < len(args) && args[i] != "" {
+			raw = []string{args[i]}
+		}
+		given[varName] = raw
+	}
+
+	// Defaults and prompts fill in the rest
+	return gogo.Resolver{Prompt: promptForVariable}.Values(varNames, config, given)
+}
+
+// labelVariables returns the variables that differ between runs, used to label output
+func labelVariables(varNames []string, values map[string][]string) []string {
+	var labels []string
+	for _, varName := range varNames {
+		if len(values[varName]) > 1 {
+			labels = append(labels, varName)
+		}
+	}
+	return labels
+}
+
+// runLabel formats the varying variables of a run, e.g. "host=a,port=80"
+func runLabel(labelVars []string, vars map[string]string) string {
+	parts := make([]string, 0, len(labelVars))
+	for _, varName := range labelVars {
+		parts = append(parts, varName+"="+vars[varName])
+	}
+	return strings.Join(parts, ",")
+}
+
+// fanOutResult records how one run of a fan-out went
+type fanOutResult struct {
+	Label string
+	Err   error
+}
+
+// runFunc runs a gadget once with fully resolved variables
+type runFunc func(ctx context.Context, vars map[string]string, opts gogo.Runner) error
+
+// runFanOut runs a gadget once per variable combination, at most parallel at a time,
+// prefixing each run's output with its label and printing a summary at the end.
+// It returns an error if any run failed.
+func runFanOut(ctx context.Context, name string, runs []map[string]string, labelVars []string, parallel int, opts gogo.Runner, run runFunc) error {
+	if parallel < 1 {
+		parallel = 1
+	}
+	out := colorable.NewColorableStdout()
+	errOut := colorable.NewColorableStderr()
+	var outMu sync.Mutex
+
+	colorText.Cyan(fmt.Sprintf("Running '%s' %d times (up to %d at once)...", name, len(runs), parallel))
+
+	results := make([]fanOutResult, len(runs))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, vars := range runs {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			// Interrupted: don't start the remaining runs
+			results[i] = fanOutResult{Label: runLabel(labelVars, vars), Err: gogo.ErrInterrupted}
+			<-sem
+			continue
+		}
+		wg.Add(1)
+		go func(i int, vars map[string]string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			label := runLabel(labelVars, vars)
+			prefix := fmt.Sprintf("\x1b[1;35m[%s]\x1b[0m ", label)
+			stdout := newPrefixWriter(out, prefix, &outMu)
+			stderr := newPrefixWriter(errOut, prefix, &outMu)
+			runOpts := opts
+			runOpts.Stdin, runOpts.Stdout, runOpts.Stderr = nil, stdout, stderr
+			err := run(ctx, vars, runOpts)
+			stdout.Flush()
+			stderr.Flush()
+			results[i] = fanOutResult{Label: label, Err: err}
+		}(i, vars)
+	}
+	wg.Wait()
+
+	if err := printFanOutSummary(results); err != nil {
+		if gogo.InterruptCause(ctx) != nil {
+			return gogo.ErrInterrupted
+		}
+		return err
+	}
+	return nil
+}
+
+// printFanOutSummary lists each run's outcome and returns an error if any failed
+func printFanOutSummary(results []fanOutResult) error {
+	var failed []fanOutResult
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+
+	fmt.Fprintln(colorable.NewColorableStdout())
+	colorText.Cyan(fmt.Sprintf("Summary: %d succeeded, %d failed", len(results)-len(failed), len(failed)))
+	for _, r := range results {
+		if r.Err == nil {
+			successText(fmt.Sprintf("  ✅ [%s]", r.Label))
+		}
+	}
+	for _, r := range failed {
+		errorText(fmt.Sprintf("  ❌ [%s]: %v", r.Label, r.Err))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d runs failed", len(failed), len(results))
+	}
+	return nil
+}
+
+// prefixWriter writes each complete line to w with a prefix, holding partial
+// lines back until they are finished so parallel runs don't interleave mid-line
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	mu     *sync.Mutex
+	buf    bytes.Buffer
+}
+
+func newPrefixWriter(w io.Writer, prefix string, mu *sync.Mutex) *prefixWriter {
+	return &prefixWriter{w: w, prefix: prefix, mu: mu}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf.Write(b)
+	for {
+		line, err := p.buf.ReadBytes('\n')
+		if err != nil {
+			// Incomplete line: keep it for the next write
+			p.buf.Reset()
+			p.buf.Write(line)
+			break
+		}
+		p.writeLine(line)
+	}
+	return len(b), nil
+}
+
+// Flush writes any trailing partial line
+func (p *prefixWriter) Flush() {
+	if p.buf.Len() > 0 {
+		line := append(p.buf.Bytes(), '\n')
+		p.buf.Reset()
+		p.writeLine(line)
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprint(p.w, p.prefix)
+	p.w.Write(line)
+}
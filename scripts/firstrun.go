@@ -15,24 +15,39 @@ import (
 // Settings represents the user settings stored in settings.json
 type Settings struct {
 	FirstRun bool `json:"firstRun"`
+	// Before and After are hooks run around every gadget, on top of the gadget's own
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+	// Repo is the git working copy the library is kept in, set by 'GoGoGadget repo'
+	Repo string `json:"repo,omitempty"`
 }
 
 // getSettingsPath returns the user-writable path for settings.json
 func getSettingsPath() string {
-	dir, err := os.UserConfigDir()
-	if err != nil {
-		// fallback to home dir
-		dir, _ = os.UserHomeDir()
+	return filepath.Join(getConfigDir(), "settings.json")
+}
+
+// loadSettings reads settings.json, falling back to defaults if it is missing or unreadable
+func loadSettings() Settings {
+	settings := Settings{FirstRun: true}
+	data, err := os.ReadFile(getSettingsPath())
+	if err == nil && len(data) > 0 {
+		_ = json.Unmarshal(data, &settings)
 	}
-	dir = filepath.Join(dir, "GoGoGadget")
-	_ = os.MkdirAll(dir, 0755)
-	return filepath.Join(dir, "settings.json")
+	return settings
+}
+
+// saveSettings writes settings.json
+func saveSettings(settings Settings) error {
+	return writeFileAtomic(getSettingsPath(), settings)
 }
 
-// updateSettingsFile updates the settings.json file to mark firstRun as false
+// updateSettingsFile updates the settings.json file to mark firstRun as false,
+// keeping any other settings
 func updateSettingsFile() {
 	settingsPath := getSettingsPath()
-	settings := Settings{FirstRun: false}
+	settings := loadSettings()
+	settings.FirstRun = false
 	data, err := json.MarshalIndent(settings, "", "  ")
 	if err != nil {
 		fmt.Println("Error marshaling settings:", err)
@@ -86,10 +101,10 @@ You are running GoGoGadget for the first time! This is exciting! You need to kno
 
 	// Show the first sentence of point 1 in bright red
 	fmt.Print("1. ")
-	fmt.Print("\x1b[1;91mGoGoGadget does NOT have any checks for your PowerShell commands.\x1b[0m")
+	fmt.Print("\x1b[1;91mGoGoGadget only has basic checks for your PowerShell commands.\x1b[0m")
 
 	// Define the rest of the message as a string literal
-	restOfMsg := ` It will run them as-is, with variables replaced exactly as you specify. Make sure you test your commands before saving them with GoGoGadget!
+	restOfMsg := ` It asks before running gadgets that look destructive (like deleting folders or formatting disks), but otherwise runs them as-is, with variables replaced exactly as you specify. Make sure you test your commands before saving them with GoGoGadget!
 2. Your gadgets are stored in a json file in your $LOCALAPPDATA directory (check yours with \x1b[1;100m\x1b[97m$env:LOCALAPPDATA\x1b[0m). You can edit this file directly if you want without fear of breaking anything, but there are robust built in tools to edit the shortcuts as well. GUI is planned for a future release.
 
 Print this message again with 'GoGoGadget first-run' if you need to see it again.
@@ -123,10 +138,10 @@ You are running GoGoGadget for the first time! This is exciting! You need to kno
 
 			// Show the first sentence of point 1 in bright red
 			fmt.Print("1. ")
-			fmt.Print("\x1b[1;91mGoGoGadget does NOT have any checks for your PowerShell commands.\x1b[0m")
+			fmt.Print("\x1b[1;91mGoGoGadget only has basic checks for your PowerShell commands.\x1b[0m")
 
 			// Define the rest of the message as a string literal
-			restOfMsg := ` It will run them as-is, with variables replaced exactly as you specify. Make sure you test your commands before saving them with GoGoGadget!
+			restOfMsg := ` It asks before running gadgets that look destructive (like deleting folders or formatting disks), but otherwise runs them as-is, with variables replaced exactly as you specify. Make sure you test your commands before saving them with GoGoGadget!
 2. Your gadgets are stored in a json file in the app directory (wherever you installed GoGoGadget). You can edit this file directly if you want without fear of breaking anything, but there are robust built in tools to edit the shortcuts as well. GUI is planned for a future release.
 
 Print this message again with 'GoGoGadget first-run' if you need to see it again.
@@ -0,0 +1,148 @@
+package scripts
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mattn/go-colorable"
+	"github.com/spf13/cobra"
+)
+
+// Run sources recorded in the history
+const (
+	RunSourceCLI            = "cli"
+	RunSourceJob            = "job"
+	RunSourceAPI            = "api"
+	RunSourceMCP            = "mcp"
+	RunSourceUI             = "ui"
+	RunSourceSchedulePrefix = "schedule:"
+)
+
+// HistoryEntry records one finished gadget run
+type HistoryEntry struct {
+	Gadget    string            `json:"gadget"`
+	Source    string            `json:"source"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Started   time.Time         `json:"started"`
+	Duration  float64           `json:"durationSeconds"`
+	Status    string            `json:"status"`
+	ExitCode  int               `json:"exitCode"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// getHistoryPath returns the path of the run history, one JSON entry per line
+func getHistoryPath() string {
+	return filepath.Join(getConfigDir(), "history.jsonl")
+}
+
+// newHistoryEntry describes a run that started at start and ended with err
+func newHistoryEntry(source, gadget string, vars map[string]string, start time.Time, err error) HistoryEntry {
+	entry := HistoryEntry{
+		Gadget:    gadget,
+		Source:    source,
+		Variables: vars,
+		Started:   start,
+		Duration:  time.Since(start).Seconds(),
+		Status:    JobSucceeded,
+	}
+	if err != nil {
+		entry.Status = JobFailed
+		entry.ExitCode = gogo.ExitCode(err)
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// appendHistory adds an entry to the run history
+func appendHistory(entry HistoryEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(getHistoryPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// recordRun adds a finished run to the history. A history that can't be written
+// shouldn't fail the run, so problems are only reported.
+func recordRun(source, gadget string, vars map[string]string, start time.Time, err error) {
+	if herr := appendHistory(newHistoryEntry(source, gadget, vars, start, err)); herr != nil {
+		warnText(fmt.Sprintf("⚠️ Could not record run history: %v", herr))
+	}
+}
+
+// loadHistory reads the run history, oldest first, skipping unreadable lines
+func loadHistory() ([]HistoryEntry, error) {
+	f, err := os.Open(getHistoryPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e HistoryEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// NewHistoryCommand returns the 'history' command showing recent gadget runs
+func NewHistoryCommand() *cobra.Command {
+	var limit int
+	cmd := &cobra.Command{
+		Use:          "history [gadget]",
+		Short:        "Show recent gadget runs, including scheduled ones",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := loadHistory()
+			if err != nil {
+				return err
+			}
+			if len(args) == 1 {
+				var filtered []HistoryEntry
+				for _, e := range entries {
+					if e.Gadget == args[0] {
+						filtered = append(filtered, e)
+					}
+				}
+				entries = filtered
+			}
+			if len(entries) == 0 {
+				colorText.Cyan("No runs recorded yet.")
+				return nil
+			}
+			if limit > 0 && len(entries) > limit {
+				entries = entries[len(entries)-limit:]
+			}
+			out := colorable.NewColorableStdout()
+			fmt.Fprintf(out, "\x1b[36m%-19s  %-20s  %-24s  %-10s  %-9s  %s\x1b[0m\n", "Started", "Gadget", "Source", "Status", "Duration", "Exit")
+			for _, e := range entries {
+				fmt.Fprintf(out, "%-19s  \x1b[1;35m%-20s\x1b[0m  %-24s  %s%-10s\x1b[0m  %-9s  %d\n",
+					e.Started.Format("2006-01-02 15:04:05"), e.Gadget, e.Source, jobStatusColor(e.Status), e.Status,
+					(time.Duration(e.Duration * float64(time.Second))).Round(time.Millisecond), e.ExitCode)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Number of most recent runs to show (0 for all)")
+	return cmd
+}
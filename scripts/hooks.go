@@ -0,0 +1,41 @@
+package scripts
+
+import (
+	"context"
+	"gogo/gogo"
+)
+
+// globalHooks returns the hooks from settings.json that wrap every gadget run
+func globalHooks() gogo.Hooks {
+	settings := loadSettings()
+	return gogo.Hooks{Before: settings.Before, After: settings.After}
+}
+
+// runGadgetWithHooks checks a gadget against the policy and runs it wrapped in
+// the global hooks from settings.json. Use it wherever a user-facing run starts.
+// Unless the runner says otherwise, prompts and warnings go to the terminal,
+// and workflows show each step and a summary in the runner's Stdout.
+func runGadgetWithHooks(ctx context.Context, name string, config gogo.Gadget, scripts gogo.Library, vars map[string]string, runner gogo.Runner) error {
+	policies, err := checkPolicy(name, config, scripts)
+	if err != nil {
+		return err
+	}
+	runner.EscapeValues = escapeValues(policies)
+	runner.Hooks = globalHooks()
+	if runner.Prompt == nil {
+		runner.Prompt = promptForVariable
+	}
+	if runner.Warn == nil {
+		runner.Warn = func(msg string) { warnText("⚠️ " + msg) }
+	}
+	if runner.OnStep == nil && runner.OnWorkflowEnd == nil && runner.Stdout != nil {
+		out := runner.Stdout
+		runner.OnStep = func(workflow string, number, total int, step gogo.WorkflowStep) {
+			printWorkflowStep(out, number, total, step)
+		}
+		runner.OnWorkflowEnd = func(workflow string, results []gogo.StepResult) {
+			printWorkflowSummary(out, workflow, results)
+		}
+	}
+	return runner.Run(ctx, name, scripts, vars)
+}
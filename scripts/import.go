@@ -0,0 +1,870 @@
+package scripts
+
+import (
+	"errors"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// psScriptParam is one parameter declared in a script's param() block
+type psScriptParam struct {
+	Name        string
+	Type        string // as written, e.g. "string[]"; empty when untyped
+	Default     string // the default expression, e.g. 'C:\Temp'
+	HasDefault  bool
+	Mandatory   bool
+	HelpMessage string
+	Comment     string // a comment written just above the parameter
+}
+
+// psScriptHelp is the part of a script's comment-based help that becomes gadget text
+type psScriptHelp struct {
+	Synopsis    string
+	Description string
+	Parameters  map[string]string // by lowercase parameter name
+}
+
+// psScript is a PowerShell script split into its help, parameters and body
+type psScript struct {
+	Help   psScriptHelp
+	Params []psScriptParam
+	Header string // #Requires and using lines, which have to stay first
+	Body   string
+}
+
+// psHelpKeywordRe finds the help keywords that mark a comment as comment-based help
+var psHelpKeywordRe = regexp.MustCompile(`(?mi)^\s*\.(SYNOPSIS|DESCRIPTION|PARAMETER)\b`)
+
+// psNameChar reports whether c can be part of a variable name
+func psNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// psSkipQuoted returns the index just past the single- or double-quoted string
+// that starts at src[i], or len(src) if it never ends
+func psSkipQuoted(src string, i int) int {
+	quote := src[i]
+	for i++; i < len(src); i++ {
+		switch {
+		case quote == '"' && src[i] == '`':
+			i++
+		case src[i] == quote && i+1 < len(src) && src[i+1] == quote:
+			i++ // '' or "" stands for one quote
+		case src[i] == quote:
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// psSkipHereString returns the index just past the here-string (@' '@ or @" "@)
+// that starts at src[i], or -1 if src[i] doesn't start one
+func psSkipHereString(src string, i int) int {
+	if !strings.HasPrefix(src[i:], "@'") && !strings.HasPrefix(src[i:], `@"`) {
+		return -1
+	}
+	rest := strings.TrimLeft(src[i+2:], " \t")
+	if !strings.HasPrefix(rest, "\n") && !strings.HasPrefix(rest, "\r\n") {
+		return -1
+	}
+	end := strings.Index(src[i+2:], "\n"+string(src[i+1])+"@")
+	if end < 0 {
+		return len(src)
+	}
+	return i + 2 + end + 3
+}
+
+// psSkipComment returns the index just past the comment that starts at src[i]:
+// to the end of the line for #, or past #> for <#
+func psSkipComment(src string, i int) int {
+	if strings.HasPrefix(src[i:], "<#") {
+		end := strings.Index(src[i+2:], "#>")
+		if end < 0 {
+			return len(src)
+		}
+		return i + 2 + end + 2
+	}
+	end := strings.IndexByte(src[i:], '\n')
+	if end < 0 {
+		return len(src)
+	}
+	return i + end
+}
+
+// psClosing returns the index of the bracket that closes the one at src[open],
+// skipping strings and comments, or -1 if it isn't closed
+func psClosing(src string, open int) int {
+	depth := 0
+	for i := open; i < len(src); {
+		switch c := src[i]; {
+		case c == '`':
+			i += 2
+			continue
+		case c == '\'' || c == '"':
+			i = psSkipQuoted(src, i)
+			continue
+		case c == '@' && psSkipHereString(src, i) >= 0:
+			i = psSkipHereString(src, i)
+			continue
+		case c == '#' || strings.HasPrefix(src[i:], "<#"):
+			i = psSkipComment(src, i)
+			continue
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+		i++
+	}
+	return -1
+}
+
+// psSplitTopLevel splits src on commas that aren't inside brackets or strings
+func psSplitTopLevel(src string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(src); {
+		switch c := src[i]; {
+		case c == '`':
+			i += 2
+			continue
+		case c == '\'' || c == '"':
+			i = psSkipQuoted(src, i)
+			continue
+		case c == '@' && psSkipHereString(src, i) >= 0:
+			i = psSkipHereString(src, i)
+			continue
+		case c == '#' || strings.HasPrefix(src[i:], "<#"):
+			i = psSkipComment(src, i)
+			continue
+		case c == '(' || c == '[' || c == '{':
+			if end := psClosing(src, i); end >= 0 {
+				i = end + 1
+				continue
+			}
+		case c == ',':
+			parts = append(parts, src[start:i])
+			start = i + 1
+		}
+		i++
+	}
+	return append(parts, src[start:])
+}
+
+// commentText returns the text of a <# #> comment or a run of # lines
+func commentText(comment string) string {
+	if strings.HasPrefix(comment, "<#") {
+		return strings.TrimSuffix(strings.TrimPrefix(comment, "<#"), "#>")
+	}
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(strings.TrimSpace(line), "#")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parsePSHelp reads .SYNOPSIS, .DESCRIPTION and .PARAMETER out of comment-based help
+func parsePSHelp(text string) psScriptHelp {
+	help := psScriptHelp{Parameters: map[string]string{}}
+	var section, param string
+	var lines []string
+	flush := func() {
+		content := strings.TrimSpace(strings.Join(lines, "\n"))
+		switch section {
+		case "SYNOPSIS":
+			help.Synopsis = content
+		case "DESCRIPTION":
+			help.Description = content
+		case "PARAMETER":
+			help.Parameters[strings.ToLower(param)] = content
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ".") && len(trimmed) > 1 && psNameChar(trimmed[1]) {
+			fields := strings.Fields(trimmed[1:])
+			flush()
+			section = strings.ToUpper(fields[0])
+			param = ""
+			if len(fields) > 1 {
+				param = fields[1]
+			}
+			continue
+		}
+		lines = append(lines, trimmed)
+	}
+	flush()
+	return help
+}
+
+// oneLine joins the first paragraph of text into a single line
+func oneLine(text string) string {
+	paragraph, _, _ := strings.Cut(strings.TrimSpace(text), "\n\n")
+	return strings.Join(strings.Fields(paragraph), " ")
+}
+
+// parsePSScript splits a script into its comment-based help, its param() block
+// and the code after it. Attributes like [CmdletBinding()] are dropped; #Requires
+// and using lines are kept as the header.
+func parsePSScript(src string) (psScript, error) {
+	src = strings.ReplaceAll(strings.TrimPrefix(src, "\ufeff"), "\r\n", "\n")
+	script := psScript{Help: psScriptHelp{Parameters: map[string]string{}}}
+	var kept []string
+
+	i := 0
+	for i < len(src) {
+		switch {
+		case strings.ContainsRune(" \t\n", rune(src[i])):
+			i++
+		case strings.HasPrefix(strings.ToLower(src[i:]), "#requires"):
+			end := psSkipComment(src, i)
+			kept = append(kept, src[i:end])
+			i = end
+		case src[i] == '#' || strings.HasPrefix(src[i:], "<#"):
+			start, end := i, psSkipComment(src, i)
+			if src[i] == '#' {
+				// A run of # lines is read as one comment
+				for {
+					next := end
+					for next < len(src) && strings.ContainsRune(" \t\n", rune(src[next])) {
+						next++
+					}
+					if next >= len(src) || src[next] != '#' || strings.HasPrefix(strings.ToLower(src[next:]), "#requires") {
+						break
+					}
+					end = psSkipComment(src, next)
+				}
+			}
+			if text := commentText(src[start:end]); psHelpKeywordRe.MatchString(text) && script.Help.Synopsis == "" && script.Help.Description == "" {
+				script.Help = parsePSHelp(text)
+			}
+			i = end
+		case src[i] == '[':
+			end := psClosing(src, i)
+			if end < 0 {
+				return script, fmt.Errorf("unclosed [ in the script header")
+			}
+			i = end + 1
+		case strings.HasPrefix(strings.ToLower(src[i:]), "using "):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			kept = append(kept, src[i:i+end])
+			i += end
+		case strings.HasPrefix(strings.ToLower(src[i:]), "param") && strings.HasPrefix(strings.TrimLeft(src[i+5:], " \t\n"), "("):
+			open := strings.IndexByte(src[i:], '(') + i
+			end := psClosing(src, open)
+			if end < 0 {
+				return script, fmt.Errorf("the param( block is never closed")
+			}
+			params, err := parsePSParams(src[open+1 : end])
+			if err != nil {
+				return script, err
+			}
+			script.Params = params
+			script.Body = strings.Trim(src[end+1:], "\n")
+			return withKeptLines(script, kept), nil
+		default:
+			script.Body = strings.Trim(src[i:], "\n")
+			return withKeptLines(script, kept), nil
+		}
+	}
+	return withKeptLines(script, kept), nil
+}
+
+// withKeptLines sets the script's header to the #Requires and using lines
+func withKeptLines(script psScript, kept []string) psScript {
+	script.Header = strings.Join(kept, "\n")
+	script.Body = strings.TrimSpace(script.Body)
+	return script
+}
+
+// parsePSParams reads the parameters declared inside param( )
+func parsePSParams(block string) ([]psScriptParam, error) {
+	var params []psScriptParam
+	for _, part := range psSplitTopLevel(block) {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		p, err := parsePSParam(part)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// parsePSParam reads one parameter: its comments, attributes, type, name and default
+func parsePSParam(src string) (psScriptParam, error) {
+	var p psScriptParam
+	for i := 0; i < len(src); {
+		switch {
+		case strings.ContainsRune(" \t\n", rune(src[i])):
+			i++
+		case src[i] == '#' || strings.HasPrefix(src[i:], "<#"):
+			end := psSkipComment(src, i)
+			p.Comment = strings.TrimSpace(p.Comment + "\n" + strings.TrimSpace(commentText(src[i:end])))
+			i = end
+		case src[i] == '[':
+			end := psClosing(src, i)
+			if end < 0 {
+				return p, fmt.Errorf("unclosed [ in parameter %s", strings.TrimSpace(src))
+			}
+			parsePSAttribute(src[i+1:end], &p)
+			i = end + 1
+		case src[i] == '$':
+			j := i + 1
+			for j < len(src) && psNameChar(src[j]) {
+				j++
+			}
+			p.Name = src[i+1 : j]
+			rest := strings.TrimSpace(src[j:])
+			if strings.HasPrefix(rest, "=") {
+				p.Default = strings.TrimSpace(rest[1:])
+				p.HasDefault = true
+			} else if rest != "" {
+				return p, fmt.Errorf("could not read parameter $%s: unexpected '%s'", p.Name, rest)
+			}
+			if p.Name == "" {
+				return p, fmt.Errorf("could not read parameter %s", strings.TrimSpace(src))
+			}
+			return p, nil
+		default:
+			return p, fmt.Errorf("could not read parameter %s", strings.TrimSpace(src))
+		}
+	}
+	return p, fmt.Errorf("a parameter has no $name: %s", strings.TrimSpace(src))
+}
+
+// parsePSAttribute reads [Parameter(...)] settings or a [type] into p. Other
+// attributes, like [ValidateSet()], are ignored.
+func parsePSAttribute(attr string, p *psScriptParam) {
+	attr = strings.TrimSpace(attr)
+	open := strings.IndexByte(attr, '(')
+	if open < 0 {
+		p.Type = attr
+		return
+	}
+	if !strings.EqualFold(strings.TrimSpace(attr[:open]), "Parameter") {
+		return
+	}
+	args := strings.TrimSuffix(attr[open+1:], ")")
+	for _, arg := range psSplitTopLevel(args) {
+		key, value, hasValue := strings.Cut(arg, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch strings.ToLower(key) {
+		case "mandatory":
+			b, _ := gogo.PowerShellBool(value)
+			p.Mandatory = !hasValue || b == "$true"
+		case "helpmessage":
+			if text, ok := psLiteral(value); ok {
+				p.HelpMessage = text
+			}
+		}
+	}
+}
+
+// psNumberRe matches number literals
+var psNumberRe = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// psLiteral returns the value of a constant expression: a quoted string without
+// variables, a number, $true, $false or $null
+func psLiteral(expr string) (string, bool) {
+	expr = strings.TrimSpace(expr)
+	switch {
+	case len(expr) >= 2 && expr[0] == '\'' && psSkipQuoted(expr, 0) == len(expr):
+		return strings.ReplaceAll(expr[1:len(expr)-1], "''", "'"), true
+	case len(expr) >= 2 && expr[0] == '"' && psSkipQuoted(expr, 0) == len(expr) && !strings.ContainsAny(expr, "$`"):
+		return strings.ReplaceAll(expr[1:len(expr)-1], `""`, `"`), true
+	case psNumberRe.MatchString(expr):
+		return expr, true
+	}
+	switch strings.ToLower(expr) {
+	case "$true", "$false":
+		return strings.ToLower(expr), true
+	case "$null":
+		return "", true
+	}
+	return "", false
+}
+
+// psDefaultLiteral returns the value of a parameter default. For list parameters
+// an array of constants, like @('a', 'b'), becomes "a,b".
+func psDefaultLiteral(expr string, list bool) (string, bool) {
+	if value, ok := psLiteral(expr); ok || !list {
+		return value, ok
+	}
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@(") && strings.HasSuffix(expr, ")") {
+		expr = expr[2 : len(expr)-1]
+	}
+	var values []string
+	for _, item := range psSplitTopLevel(expr) {
+		value, ok := psLiteral(item)
+		if !ok || strings.Contains(value, ",") {
+			return "", false
+		}
+		values = append(values, value)
+	}
+	return strings.Join(values, ","), true
+}
+
+// psVariableRef is a $variable in PowerShell code
+type psVariableRef struct {
+	Start, End int
+	Name       string
+	InString   bool // inside a double-quoted string rather than code
+}
+
+// findPSVariables returns every plain $variable or ${variable} in src, including
+// those inside double-quoted strings. Variables with a scope, like $env:PATH, are skipped.
+func findPSVariables(src string) []psVariableRef {
+	var refs []psVariableRef
+
+	readVariable := func(i int, inString bool) int {
+		j := i + 1
+		var name string
+		if j < len(src) && src[j] == '{' {
+			end := strings.IndexByte(src[j:], '}')
+			if end < 0 {
+				return len(src)
+			}
+			name, j = src[j+1:j+end], j+end+1
+		} else {
+			for j < len(src) && psNameChar(src[j]) {
+				j++
+			}
+			name = src[i+1 : j]
+			if j+1 < len(src) && src[j] == ':' && psNameChar(src[j+1]) {
+				scope := strings.ToLower(name)
+				start := j + 1
+				for j++; j < len(src) && psNameChar(src[j]); j++ {
+				}
+				if scope != "using" {
+					return j // $env:NAME and the like
+				}
+				name = src[start:j] // $using:name reads the script's own variable
+			}
+		}
+		if name == "" {
+			return i + 1
+		}
+		if !strings.Contains(name, ":") {
+			refs = append(refs, psVariableRef{Start: i, End: j, Name: name, InString: inString})
+		}
+		return j
+	}
+
+	var scanCode func(i int, inner bool) int
+	var scanString func(i int, end string) int
+	scanCode = func(i int, inner bool) int {
+		depth := 0
+		for i < len(src) {
+			c := src[i]
+			switch {
+			case c == '`':
+				i += 2
+			case c == '#' || strings.HasPrefix(src[i:], "<#"):
+				i = psSkipComment(src, i)
+			case c == '\'':
+				i = psSkipQuoted(src, i)
+			case c == '@' && psSkipHereString(src, i) >= 0:
+				if src[i+1] == '\'' {
+					i = psSkipHereString(src, i)
+				} else {
+					i = scanString(i+2, "\n\"@")
+				}
+			case c == '"':
+				i = scanString(i+1, `"`)
+			case c == '$' && i+1 < len(src) && src[i+1] == '(':
+				depth++
+				i += 2
+			case c == '$':
+				i = readVariable(i, false)
+			case c == '(' || c == '{' || c == '[':
+				depth++
+				i++
+			case c == ')' || c == '}' || c == ']':
+				if inner && depth == 0 {
+					return i + 1
+				}
+				depth--
+				i++
+			default:
+				i++
+			}
+		}
+		return i
+	}
+	scanString = func(i int, end string) int {
+		for i < len(src) {
+			switch {
+			case src[i] == '`':
+				i += 2
+			case end == `"` && strings.HasPrefix(src[i:], `""`):
+				i += 2
+			case strings.HasPrefix(src[i:], end):
+				return i + len(end)
+			case strings.HasPrefix(src[i:], "$("):
+				i = scanCode(i+2, true)
+			case src[i] == '$':
+				i = readVariable(i, true)
+			default:
+				i++
+			}
+		}
+		return i
+	}
+	scanCode(0, false)
+	return refs
+}
+
+// psAssignmentRe matches what follows a variable that is being assigned to
+var psAssignmentRe = regexp.MustCompile(`^[ \t]*([-+*/%]?=[^=]|\+\+|--)`)
+
+// psUnsupportedVariables are automatic variables that behave differently when
+// GoGoGadget runs the command, and why
+var psUnsupportedVariables = map[string]string{
+	"psscriptroot":      "points at a temporary folder",
+	"pscommandpath":     "points at a temporary file",
+	"myinvocation":      "describes a temporary file",
+	"psboundparameters": "is empty because values are filled in directly",
+	"args":              "is empty because GoGoGadget passes no extra arguments",
+}
+
+// psVariableType maps a PowerShell parameter type to a variable type and whether
+// it takes a list; known is false for types that can only be imported as text
+func psVariableType(psType string) (typ string, list, known bool) {
+	t := strings.ToLower(strings.TrimSpace(psType))
+	t = strings.TrimPrefix(t, "system.")
+	if strings.HasSuffix(t, "[]") {
+		list = true
+		t = strings.TrimSuffix(t, "[]")
+	}
+	switch t {
+	case "", "string", "object", "psobject":
+		return "", list, true
+	case "int", "int16", "int32", "int64", "long", "byte", "sbyte", "uint16", "uint32", "uint64", "short":
+		return gogo.VariableTypeInt, list, true
+	case "double", "float", "single", "decimal":
+		return gogo.VariableTypeNumber, list, true
+	case "bool", "boolean", "switch", "management.automation.switchparameter":
+		return gogo.VariableTypeBool, list, true
+	}
+	return "", list, false
+}
+
+// importPS1 turns a script into a gadget. Parameters become variables and each
+// $parameter in the body becomes {{parameter}}: quoted as '{{parameter}}' for
+// text, so the value stays a single argument. Text parameters used inside
+// double-quoted strings, and parameters the script assigns to, stay PowerShell
+// variables set from '{{parameter}}' up front. The gadget escapes its values,
+// so a quote in one can't end the string. It also returns what didn't carry over.
+func importPS1(fileName, src string) (gogo.Gadget, []string, error) {
+	script, err := parsePSScript(src)
+	if err != nil {
+		return gogo.Gadget{}, nil, err
+	}
+	var warnings []string
+	config := gogo.Gadget{
+		Description: oneLine(script.Help.Synopsis),
+		Variables:   map[string]string{},
+	}
+	if config.Description == "" {
+		config.Description = oneLine(script.Help.Description)
+	}
+	if config.Description == "" {
+		config.Description = "Imported from " + fileName
+	}
+
+	params := map[string]psScriptParam{}
+	options := map[string]gogo.VariableOption{}
+	for _, p := range script.Params {
+		if !variableNameRe.MatchString(p.Name) {
+			return config, nil, fmt.Errorf("parameter $%s can't be a variable name; use letters, numbers and underscores", p.Name)
+		}
+		params[strings.ToLower(p.Name)] = p
+
+		typ, list, known := psVariableType(p.Type)
+		if !known {
+			warnings = append(warnings, fmt.Sprintf("-%s is a [%s]; it's imported as text", p.Name, p.Type))
+		}
+		if list {
+			warnings = append(warnings, fmt.Sprintf("-%s takes several values; GoGoGadget runs the gadget once per value", p.Name))
+		}
+		opt := gogo.VariableOption{Type: typ, List: list}
+		switch {
+		case p.HasDefault:
+			if value, ok := psDefaultLiteral(p.Default, list); ok {
+				if typ == gogo.VariableTypeBool {
+					value, _ = gogo.PowerShellBool(value)
+				}
+				opt.Default = &value
+			} else {
+				warnings = append(warnings, fmt.Sprintf("the default of -%s (%s) is worked out when the script runs, so you'll be asked for a value instead", p.Name, p.Default))
+			}
+		case !p.Mandatory:
+			// Like PowerShell, a parameter that isn't given is empty
+			value := ""
+			switch typ {
+			case gogo.VariableTypeInt, gogo.VariableTypeNumber:
+				value = "0"
+			case gogo.VariableTypeBool:
+				value = "$false"
+			}
+			opt.Default = &value
+		}
+		options[p.Name] = opt
+
+		desc := script.Help.Parameters[strings.ToLower(p.Name)]
+		if desc == "" {
+			desc = p.HelpMessage
+		}
+		if desc == "" {
+			desc = p.Comment
+		}
+		config.Variables[p.Name] = oneLine(desc)
+	}
+
+	refs := findPSVariables(script.Body)
+	// kept holds the parameters that stay PowerShell variables: a value can't
+	// be quoted inside a double-quoted string, and an assignment needs a variable
+	kept := map[string]bool{}
+	used := map[string]bool{}
+	for _, ref := range refs {
+		lower := strings.ToLower(ref.Name)
+		if p, ok := params[lower]; ok {
+			used[p.Name] = true
+			if ref.InString && options[p.Name].Type == "" {
+				kept[p.Name] = true
+			}
+			if !ref.InString && psAssignmentRe.MatchString(script.Body[ref.End:]) {
+				kept[p.Name] = true
+			}
+		} else if why, ok := psUnsupportedVariables[lower]; ok {
+			warnings = append(warnings, fmt.Sprintf("the script uses $%s, which %s when GoGoGadget runs it", ref.Name, why))
+		}
+	}
+
+	var body strings.Builder
+	var setup []string
+	last := 0
+	for _, ref := range refs {
+		p, ok := params[strings.ToLower(ref.Name)]
+		if !ok || kept[p.Name] {
+			continue
+		}
+		end := ref.End
+		if options[p.Name].Type == gogo.VariableTypeBool && strings.HasPrefix(strings.ToLower(script.Body[end:]), ".ispresent") {
+			end += len(".IsPresent") // $Force.IsPresent is just $true or $false once filled in
+		}
+		body.WriteString(script.Body[last:ref.Start])
+		body.WriteString(importedReference(p.Name, options[p.Name]))
+		last = end
+	}
+	body.WriteString(script.Body[last:])
+
+	for _, p := range script.Params {
+		if kept[p.Name] {
+			setup = append(setup, fmt.Sprintf("$%s = %s", p.Name, importedReference(p.Name, options[p.Name])))
+		}
+	}
+	command := body.String()
+	if len(setup) > 0 {
+		command = strings.Join(setup, "\n") + "\n\n" + command
+	}
+	if script.Header != "" {
+		command = script.Header + "\n\n" + command
+	}
+	config.Command = strings.TrimSpace(command)
+
+	for _, p := range script.Params {
+		if !used[p.Name] {
+			warnings = append(warnings, fmt.Sprintf("-%s isn't used by the script, so it was left out", p.Name))
+			delete(config.Variables, p.Name)
+			delete(options, p.Name)
+		}
+	}
+	for name, opt := range options {
+		if opt == (gogo.VariableOption{}) {
+			delete(options, name)
+		}
+	}
+	if len(options) > 0 {
+		config.VariableOptions = options
+	}
+	for name := range config.Variables {
+		if options[name].Type == "" {
+			config.EscapeValues = true
+		}
+	}
+	return config, dedupeStrings(warnings), nil
+}
+
+// importedReference returns what stands in for a parameter in an imported command
+func importedReference(name string, opt gogo.VariableOption) string {
+	if opt.Type != "" {
+		return "{{" + name + "}}"
+	}
+	return "'{{" + name + "}}'"
+}
+
+// dedupeStrings returns list without repeats, keeping the first of each
+func dedupeStrings(list []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, s := range list {
+		if !seen[s] {
+			out = append(out, s)
+			seen[s] = true
+		}
+	}
+	return out
+}
+
+// gadgetNameFromFile turns a file name like "Restart VM.ps1" into a gadget name
+func gadgetNameFromFile(path string) string {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	name := strings.Map(func(r rune) rune {
+		if r < 128 && (psNameChar(byte(r)) || r == '-') {
+			return r
+		}
+		return '-'
+	}, base)
+	return strings.Trim(name, "-")
+}
+
+// NewImportCommand returns the 'import' command
+func NewImportCommand() *cobra.Command {
+	var name, onConflict string
+	var force, dryRun, yes bool
+	cmd := &cobra.Command{
+		Use:   "import <script.ps1|gadgets.yaml>",
+		Short: "Turn a PowerShell script into a gadget, or import gadgets from a file",
+		Long: `Turn a PowerShell script into a gadget. The script's param() block becomes the
+gadget's variables, with types, defaults and descriptions taken from the
+parameters and the script's comment-based help. .SYNOPSIS becomes the
+gadget's description.
+
+JSON, YAML and TOML files written by 'GoGoGadget export' are imported as they
+are. A preview shows what will be added and a diff for every gadget that will
+be replaced. --on-conflict decides what happens when you already have a
+different gadget with the same name: skip it, overwrite yours, or rename the
+imported one.`,
+		Example: `  GoGoGadget import .\\Restart-Service.ps1 --name restart-service
+  GoGoGadget import gadgets.yaml --on-conflict rename`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := args[0]
+			if _, ok := gogo.FormatOf(path); ok {
+				if name != "" || force {
+					return fmt.Errorf("--name and --force are for .ps1 scripts; use --on-conflict for %s", filepath.Base(path))
+				}
+				return importGadgetFile(path, onConflict, dryRun, yes)
+			}
+			if !strings.EqualFold(filepath.Ext(path), ".ps1") {
+				return fmt.Errorf("only .ps1 scripts and .json, .yaml or .toml gadget files can be imported")
+			}
+			if cmd.Flags().Changed("on-conflict") || dryRun {
+				return fmt.Errorf("--on-conflict and --dry-run are for gadget files; use --name or --force for a .ps1 script")
+			}
+			src, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if name == "" {
+				name = gadgetNameFromFile(path)
+			}
+			if !gogo.ValidName(name) {
+				return fmt.Errorf("'%s' can't be a gadget name; pick one with --name using letters, numbers, dashes or underscores", name)
+			}
+
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			if _, exists := scripts[name]; exists && !force {
+				return fmt.Errorf("a gadget named '%s' already exists; choose another with --name or replace it with --force", name)
+			}
+			config, warnings, err := importPS1(filepath.Base(path), string(src))
+			if err != nil {
+				return fmt.Errorf("could not import %s: %w", path, err)
+			}
+			scripts[name] = config
+			if err := saveScripts(scripts); err != nil {
+				return err
+			}
+
+			successText(fmt.Sprintf("✅ Imported %s as '%s'", filepath.Base(path), name))
+			for _, v := range sortedKeys(config.Variables) {
+				detail := config.VariableDescription(v)
+				if typ := config.VariableOptions[v].Type; typ != "" {
+					detail += " (" + typ + ")"
+				}
+				if def, ok := config.VariableDefault(v); ok {
+					detail += fmt.Sprintf(" (default %q)", def)
+				}
+				infoText(fmt.Sprintf("   %s: %s", v, detail))
+			}
+			for _, w := range warnings {
+				warnText("⚠️ " + w)
+			}
+			return warnImportedGadget(name, config, scripts)
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", "", "Name of the new gadget (default: the file name)")
+	cmd.Flags().BoolVar(&force, "force", false, "Replace a gadget with the same name")
+	cmd.Flags().StringVar(&onConflict, "on-conflict", ConflictSkip, "When a gadget with the same name exists: skip, overwrite or rename")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show what would be imported")
+	cmd.Flags().BoolVar(&yes, "yes", false, "Import without asking")
+	return cmd
+}
+
+// warnImportedGadget points out an imported gadget that is dangerous, that the
+// policy won't let run, or whose signature doesn't hold up
+func warnImportedGadget(name string, config gogo.Gadget, scripts gogo.Library) error {
+	warnIfDangerous(name)
+	policies, err := checkPolicy(name, config, scripts)
+	if err != nil {
+		var policyErr *PolicyError
+		if !errors.As(err, &policyErr) {
+			return err
+		}
+		warnText("⛔ " + err.Error())
+		warnText("   The gadget was saved, but the policy won't let it run.")
+		return nil
+	}
+	if config.Signature != nil {
+		if err := verifyGadgetSignature(name, config, policies); err != nil {
+			warnText(fmt.Sprintf("⚠️ %s: %v", name, err))
+		}
+	}
+	return nil
+}
+
+// warnUnsigned points out imported gadgets without a signature, since there
+// is no telling who wrote them or whether they were changed on the way
+func warnUnsigned(names []string, scripts gogo.Library) {
+	var unsigned []string
+	for _, name := range names {
+		if config, ok := scripts[name]; ok && config.Signature == nil {
+			unsigned = append(unsigned, name)
+		}
+	}
+	if len(unsigned) > 0 {
+		warnText(fmt.Sprintf("⚠️ Not signed: %s. Check what they run before you use them.", strings.Join(unsigned, ", ")))
+	}
+}
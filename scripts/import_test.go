@@ -0,0 +1,44 @@
+package scripts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportPS1QuotesTextParameters(t *testing.T) {
+	src := `param(
+  [Parameter(Mandatory)][string]$Name,
+  [string]$Path,
+  [int]$Times = 2
+)
+Write-Output "Hello $Name"
+Get-Item $Path
+1..$Times
+`
+	config, _, err := importPS1("greet.ps1", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		// Used in a double-quoted string: kept as a variable, set from a quoted value
+		"$Name = '{{Name}}'",
+		`Write-Output "Hello $Name"`,
+		"Get-Item '{{Path}}'",
+		"1..{{Times}}",
+	} {
+		if !strings.Contains(config.Command, want) {
+			t.Errorf("command %q doesn't contain %q", config.Command, want)
+		}
+	}
+	if !config.EscapeValues {
+		t.Error("a gadget with quoted text parameters must escape its values")
+	}
+
+	config, _, err = importPS1("count.ps1", "param([int]$Times)\n1..$Times\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.EscapeValues {
+		t.Error("a gadget without text parameters doesn't need its values escaped")
+	}
+}
@@ -0,0 +1,497 @@
+package scripts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gogo/gogo"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mattn/go-colorable"
+	"github.com/spf13/cobra"
+)
+
+// Job statuses
+const (
+	JobStarting  = "starting"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobKilled    = "killed"
+	// JobLost marks a job whose process died without recording how it ended
+	JobLost = "lost"
+)
+
+// jobStartTimeout is how long a job may stay "starting" before it counts as lost
+const jobStartTimeout = time.Minute
+
+// Job is a gadget run in the background, stored as job.json in its own folder
+// under the jobs directory next to its output.log
+type Job struct {
+	ID        string            `json:"id"`
+	Gadget    string            `json:"gadget"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Timeout   string            `json:"timeout,omitempty"`
+	PID       int               `json:"pid,omitempty"`
+	Status    string            `json:"status"`
+	ExitCode  *int              `json:"exitCode,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Started   time.Time         `json:"started"`
+	Finished  *time.Time        `json:"finished,omitempty"`
+}
+
+// finished reports whether the job has reached a final status
+func (j *Job) finished() bool {
+	switch j.Status {
+	case JobSucceeded, JobFailed, JobKilled, JobLost:
+		return true
+	}
+	return false
+}
+
+// getJobsDir returns the folder that holds one subfolder per background job
+func getJobsDir() string {
+	dir := filepath.Join(getConfigDir(), "jobs")
+	_ = os.MkdirAll(dir, 0755)
+	return dir
+}
+
+func jobDir(id string) string {
+	return filepath.Join(getJobsDir(), id)
+}
+
+func jobLogPath(id string) string {
+	return filepath.Join(jobDir(id), "output.log")
+}
+
+// newJobID returns a short ID that sorts by start time
+func newJobID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// createJobDir makes the folder of a new job and returns the job's ID. Jobs
+// started in the same second could pick the same ID, so a taken folder is
+// never reused: another ID is tried instead.
+func createJobDir() (string, error) {
+	for attempt := 0; ; attempt++ {
+		id := newJobID()
+		err := os.Mkdir(jobDir(id), 0755)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, os.ErrExist) || attempt == 10 {
+			return "", fmt.Errorf("creating a folder for the job: %w", err)
+		}
+	}
+}
+
+// loadJob reads a job's record
+func loadJob(id string) (*Job, error) {
+	data, err := os.ReadFile(filepath.Join(jobDir(id), "job.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("job '%s' not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("job '%s' is unreadable: %w", id, err)
+	}
+	return &job, nil
+}
+
+// saveJob writes a job's record, replacing it in one step so readers never see half a file
+func saveJob(job *Job) error {
+	return writeFileAtomic(filepath.Join(jobDir(job.ID), "job.json"), job)
+}
+
+// writeFileAtomic writes v as indented JSON via a temp file and rename
+func writeFileAtomic(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// reconcileJob marks jobs whose process is gone without a final status as lost
+func reconcileJob(job *Job) {
+	if job.finished() {
+		return
+	}
+	dead := false
+	switch {
+	case job.PID != 0:
+		dead = !processAlive(job.PID)
+	case job.Status == JobStarting:
+		dead = time.Since(job.Started) > jobStartTimeout
+	}
+	if !dead {
+		return
+	}
+	// Read again in case the job finished while we were checking
+	if latest, err := loadJob(job.ID); err == nil && latest.finished() {
+		*job = *latest
+		return
+	}
+	now := time.Now()
+	job.Status = JobLost
+	job.Finished = &now
+	job.Error = "the job's process ended without recording a result"
+	_ = saveJob(job)
+}
+
+// listJobs returns every job, oldest first, reconciled against running processes
+func listJobs() ([]*Job, error) {
+	entries, err := os.ReadDir(getJobsDir())
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*Job
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		job, err := loadJob(e.Name())
+		if err != nil {
+			continue
+		}
+		reconcileJob(job)
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started.Before(jobs[j].Started) })
+	return jobs, nil
+}
+
+// startBackgroundJob records a job and launches a detached GoGoGadget process to run it
+func startBackgroundJob(gadget string, vars map[string]string, timeout time.Duration) (*Job, error) {
+	id, err := createJobDir()
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{
+		ID:        id,
+		Gadget:    gadget,
+		Variables: vars,
+		Status:    JobStarting,
+		Started:   time.Now(),
+	}
+	if timeout > 0 {
+		job.Timeout = timeout.String()
+	}
+	if err := saveJob(job); err != nil {
+		return nil, err
+	}
+
+	logFile, err := os.Create(jobLogPath(job.ID))
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(exe, "jobs", "run-job", job.ID)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detachProcess(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting background job: %w", err)
+	}
+	// The job records its own PID and result from here on
+	_ = cmd.Process.Release()
+	return job, nil
+}
+
+// startBackgroundJobs starts one job per run and tells the user how to follow them
+func startBackgroundJobs(gadget string, runs []map[string]string, timeout time.Duration) error {
+	for _, vars := range runs {
+		job, err := startBackgroundJob(gadget, vars, timeout)
+		if err != nil {
+			return err
+		}
+		successText(fmt.Sprintf("🚀 Started job %s for '%s'.", job.ID, gadget))
+		infoText(fmt.Sprintf("   Follow it with 'GoGoGadget jobs logs %s -f' or wait with 'GoGoGadget jobs wait %s'.", job.ID, job.ID))
+	}
+	return nil
+}
+
+// runJob is the body of the detached job process: it runs the gadget through the
+// normal executor with output going to the job's log, then records the result
+func runJob(cmd *cobra.Command, id string) error {
+	job, err := loadJob(id)
+	if err != nil {
+		return err
+	}
+	job.PID = os.Getpid()
+	job.Status = JobRunning
+	if err := saveJob(job); err != nil {
+		return err
+	}
+
+	opts := gogo.Runner{Stdout: os.Stdout, Stderr: os.Stderr, Prompt: noPrompt}
+	if job.Timeout != "" {
+		opts.Timeout, _ = gogo.ParseTimeout(job.Timeout)
+	}
+
+	start := time.Now()
+	runErr := func() error {
+		scripts, err := loadScripts()
+		if err != nil {
+			return err
+		}
+		config, ok := scripts[job.Gadget]
+		if !ok {
+			return fmt.Errorf("gadget '%s' not found", job.Gadget)
+		}
+		return runGadgetWithHooks(cmd.Context(), job.Gadget, config, scripts, job.Variables, opts)
+	}()
+
+	recordRun(RunSourceJob, job.Gadget, job.Variables, start, runErr)
+
+	now := time.Now()
+	job.Finished = &now
+	code := 0
+	switch {
+	case runErr == nil:
+		job.Status = JobSucceeded
+	case gogo.InterruptCause(cmd.Context()) != nil:
+		job.Status = JobKilled
+		code = gogo.ExitInterrupted
+	default:
+		job.Status = JobFailed
+		code = gogo.ExitCode(runErr)
+	}
+	if runErr != nil {
+		job.Error = runErr.Error()
+	}
+	job.ExitCode = &code
+	return saveJob(job)
+}
+
+// waitForJob polls until the job reaches a final status or ctx is done
+func waitForJob(ctx context.Context, id string) (*Job, error) {
+	for {
+		job, err := loadJob(id)
+		if err != nil {
+			return nil, err
+		}
+		reconcileJob(job)
+		if job.finished() {
+			return job, nil
+		}
+		if err := sleepContext(ctx, 250*time.Millisecond); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// followJobLog copies the job's log to w, and with follow keeps copying new
+// output until the job has finished or ctx is done
+func followJobLog(ctx context.Context, id string, w io.Writer, follow bool) error {
+	f, err := os.Open(jobLogPath(id))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for {
+		if _, err := io.Copy(w, f); err != nil {
+			return err
+		}
+		if !follow {
+			return nil
+		}
+		job, err := loadJob(id)
+		if err != nil {
+			return err
+		}
+		reconcileJob(job)
+		if job.finished() {
+			// Pick up anything written just before it finished
+			_, err := io.Copy(w, f)
+			return err
+		}
+		if err := sleepContext(ctx, 250*time.Millisecond); err != nil {
+			return err
+		}
+	}
+}
+
+// killJob stops a running job and everything it started
+func killJob(id string) (*Job, error) {
+	job, err := loadJob(id)
+	if err != nil {
+		return nil, err
+	}
+	reconcileJob(job)
+	if job.finished() {
+		return job, fmt.Errorf("job '%s' already %s", id, job.Status)
+	}
+	if job.PID == 0 {
+		return job, fmt.Errorf("job '%s' has not started yet", id)
+	}
+	if err := terminateProcess(job.PID); err != nil {
+		return job, fmt.Errorf("stopping job '%s': %w", id, err)
+	}
+
+	// Give the job a chance to record its own result before recording it here
+	deadline := time.Now().Add(gogo.DefaultGracePeriod + 2*time.Second)
+	for time.Now().Before(deadline) {
+		if job, err = loadJob(id); err == nil && job.finished() {
+			return job, nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	now := time.Now()
+	code := gogo.ExitInterrupted
+	job.Status = JobKilled
+	job.ExitCode = &code
+	job.Finished = &now
+	return job, saveJob(job)
+}
+
+// jobStatusColor returns the terminal color used for a job status
+func jobStatusColor(status string) string {
+	switch status {
+	case JobSucceeded:
+		return "\x1b[32m"
+	case JobFailed, JobKilled:
+		return "\x1b[31m"
+	case JobLost:
+		return "\x1b[33m"
+	default:
+		return "\x1b[36m"
+	}
+}
+
+// NewJobsCommand returns the 'jobs' command for managing background runs
+func NewJobsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "List and manage gadgets running in the background",
+		Long: `Gadgets started with --background run as jobs. Their output goes to a log and
+their result is recorded when they finish, even after you close the terminal.
+
+Examples:
+  GoGoGadget backup --background
+  GoGoGadget jobs list
+  GoGoGadget jobs logs <id> -f
+  GoGoGadget jobs wait <id>
+  GoGoGadget jobs kill <id>`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List background jobs",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobs, err := listJobs()
+			if err != nil {
+				return err
+			}
+			if len(jobs) == 0 {
+				colorText.Cyan("No background jobs. Start one with 'GoGoGadget <gadget> --background'.")
+				return nil
+			}
+			out := colorable.NewColorableStdout()
+			fmt.Fprintf(out, "\x1b[36m%-24s  %-20s  %-10s  %-19s  %-10s  %s\x1b[0m\n", "ID", "Gadget", "Status", "Started", "Duration", "Exit")
+			for _, job := range jobs {
+				end := time.Now()
+				if job.Finished != nil {
+					end = *job.Finished
+				}
+				exit := "-"
+				if job.ExitCode != nil {
+					exit = fmt.Sprint(*job.ExitCode)
+				}
+				fmt.Fprintf(out, "%-24s  \x1b[1;35m%-20s\x1b[0m  %s%-10s\x1b[0m  %-19s  %-10s  %s\n",
+					job.ID, job.Gadget, jobStatusColor(job.Status), job.Status,
+					job.Started.Format("2006-01-02 15:04:05"), end.Sub(job.Started).Round(time.Second), exit)
+			}
+			return nil
+		},
+	}
+
+	var follow bool
+	logsCmd := &cobra.Command{
+		Use:          "logs [id]",
+		Short:        "Show a job's output",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := loadJob(args[0]); err != nil {
+				return err
+			}
+			return followJobLog(cmd.Context(), args[0], os.Stdout, follow)
+		},
+	}
+	logsCmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep printing new output until the job finishes")
+
+	waitCmd := &cobra.Command{
+		Use:          "wait [id]",
+		Short:        "Wait for a job to finish and exit with its exit code",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			job, err := waitForJob(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(colorable.NewColorableStdout(), "Job %s %s%s\x1b[0m\n", job.ID, jobStatusColor(job.Status), job.Status)
+			if job.Status == JobSucceeded {
+				return nil
+			}
+			code := 1
+			if job.ExitCode != nil && *job.ExitCode != 0 {
+				code = *job.ExitCode
+			}
+			return &ExitCodeError{Code: code}
+		},
+	}
+
+	killCmd := &cobra.Command{
+		Use:          "kill [id]",
+		Short:        "Stop a running job",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			job, err := killJob(args[0])
+			if err != nil {
+				return err
+			}
+			colorText.Green(fmt.Sprintf("✅ Job %s %s.", job.ID, job.Status))
+			return nil
+		},
+	}
+
+	runJobCmd := &cobra.Command{
+		Use:          "run-job [id]",
+		Short:        "Run a background job (used internally by --background)",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		Hidden:       true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runJob(cmd, args[0])
+		},
+	}
+
+	cmd.AddCommand(listCmd, logsCmd, waitCmd, killCmd, runJobCmd)
+	return cmd
+}
@@ -0,0 +1,342 @@
+package scripts
+
+import (
+	"bufio"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// libraryFiles are the names the gadget library is stored under, by format
+var libraryFiles = map[string]string{
+	gogo.FormatJSON: "user_scripts.json",
+	gogo.FormatYAML: "user_scripts.yaml",
+	gogo.FormatTOML: "user_scripts.toml",
+}
+
+// readGadgetFile reads a JSON, YAML or TOML file of gadgets
+func readGadgetFile(path string) (gogo.Library, error) {
+	format, ok := gogo.FormatOf(path)
+	if !ok {
+		return nil, fmt.Errorf("%s isn't a .json, .yaml or .toml file", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scripts, err := gogo.Decode(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	for _, name := range scripts.Names() {
+		if !gogo.ValidName(name) {
+			return nil, fmt.Errorf("'%s' in %s can't be a gadget name; use letters, numbers, dashes or underscores", name, path)
+		}
+	}
+	return scripts, nil
+}
+
+// exportGadgetFile writes the named gadgets (and the gadgets their workflows
+// run) or every gadget as a JSON, YAML or TOML file
+func exportGadgetFile(scripts gogo.Library, names []string, format, output string) error {
+	if len(names) == 0 {
+		names = scripts.Names()
+	} else {
+		var err error
+		if names, err = packGadgetsWithSteps(names, scripts); err != nil {
+			return err
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("there are no gadgets to export")
+	}
+	selected := gogo.Library{}
+	for _, name := range names {
+		config := scripts[name]
+		config.Dangerous = false // worked out again on import
+		selected[name] = config
+	}
+	data, err := gogo.Encode(selected, format)
+	if err != nil {
+		return err
+	}
+	if output == "-" {
+		fmt.Print(string(data))
+		return nil
+	}
+	if output == "" {
+		output = "gadgets." + format
+		if len(names) == 1 {
+			output = names[0] + "." + format
+		}
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		return err
+	}
+	successText(fmt.Sprintf("✅ Exported %d gadgets to %s", len(names), output))
+	return nil
+}
+
+// What to do with a gadget from a file when one with the same name exists
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictRename    = "rename"
+)
+
+// Import actions shown in the preview
+const (
+	importAdd       = "add"
+	importOverwrite = "overwrite"
+	importRename    = "rename"
+	importSkip      = "skip"
+	importSame      = "same"
+)
+
+// importChange is what happens to one gadget from an imported file
+type importChange struct {
+	Name   string // name in the file
+	Target string // name it's saved under
+	Action string
+}
+
+// planImport decides what happens to each gadget in incoming. Renamed gadgets
+// get the first free name-2, name-3, ... and the workflows being imported are
+// pointed at the new names, which can in turn make those workflows differ
+// from the user's and be renamed too.
+func planImport(incoming, existing gogo.Library, onConflict string) []importChange {
+	differs := func(name string) bool {
+		current, exists := existing[name]
+		return exists && gadgetHash(name, current) != gadgetHash(name, incoming[name])
+	}
+	renamed := map[string]string{}
+	if onConflict == ConflictRename {
+		taken := map[string]bool{}
+		for name := range existing {
+			taken[name] = true
+		}
+		for name := range incoming {
+			taken[name] = true
+		}
+		for again := true; again; {
+			again = false
+			for _, name := range incoming.Names() {
+				if _, done := renamed[name]; done || !differs(name) {
+					continue
+				}
+				for i := 2; ; i++ {
+					candidate := fmt.Sprintf("%s-%d", name, i)
+					if !taken[candidate] {
+						renamed[name] = candidate
+						taken[candidate] = true
+						break
+					}
+				}
+				again = true
+			}
+			renameSteps(incoming, renamed)
+		}
+	}
+
+	var changes []importChange
+	for _, name := range incoming.Names() {
+		change := importChange{Name: name, Target: name, Action: importAdd}
+		if _, exists := existing[name]; exists {
+			switch {
+			case !differs(name):
+				change.Action = importSame
+			case onConflict == ConflictOverwrite:
+				change.Action = importOverwrite
+			case onConflict == ConflictRename:
+				change.Action = importRename
+				change.Target = renamed[name]
+			default:
+				change.Action = importSkip
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// renameSteps points workflow steps at the new names of renamed gadgets
+func renameSteps(scripts gogo.Library, renamed map[string]string) {
+	for name, config := range scripts {
+		if len(config.Steps) == 0 {
+			continue
+		}
+		steps := make([]gogo.WorkflowStep, len(config.Steps))
+		copy(steps, config.Steps)
+		for i, step := range steps {
+			if target, ok := renamed[step.Gadget]; ok {
+				steps[i].Gadget = target
+			}
+		}
+		config.Steps = steps
+		scripts[name] = config
+	}
+}
+
+// gadgetYAML renders a single gadget as YAML, for previews and diffs
+func gadgetYAML(name string, config gogo.Gadget) string {
+	config.Dangerous = false
+	data, err := gogo.Encode(gogo.Library{name: config}, gogo.FormatYAML)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// printImportPreview lists what an import will do, with a diff for every
+// gadget it replaces
+func printImportPreview(changes []importChange, incoming, existing gogo.Library) {
+	for _, c := range changes {
+		switch c.Action {
+		case importAdd:
+			colorText.Green(fmt.Sprintf("  + %s (new)", c.Name))
+		case importSame:
+			fmt.Printf("  = %s (already the same)\n", c.Name)
+		case importSkip:
+			colorText.Cyan(fmt.Sprintf("  · %s (skipped; you have a different gadget with this name)", c.Name))
+		case importRename:
+			colorText.Green(fmt.Sprintf("  + %s (saved as '%s'; you have a different gadget with this name)", c.Name, c.Target))
+		case importOverwrite:
+			colorText.Yellow(fmt.Sprintf("  ~ %s (replaces your gadget)", c.Name))
+			printLineDiff(lineDiff(gadgetYAML(c.Name, existing[c.Name]), gadgetYAML(c.Name, incoming[c.Name])), "      ", nil)
+		}
+	}
+}
+
+// importGadgetFile imports the gadgets in a JSON, YAML or TOML file after
+// showing what will change. In a terminal the import is confirmed first.
+func importGadgetFile(path, onConflict string, dryRun, yes bool) error {
+	switch onConflict {
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+	default:
+		return fmt.Errorf("unknown --on-conflict '%s'; use %s, %s or %s", onConflict, ConflictSkip, ConflictOverwrite, ConflictRename)
+	}
+	incoming, err := readGadgetFile(path)
+	if err != nil {
+		return err
+	}
+	if len(incoming) == 0 {
+		return fmt.Errorf("%s has no gadgets", path)
+	}
+	scripts, err := loadScripts()
+	if err != nil {
+		return err
+	}
+	changes := planImport(incoming, scripts, onConflict)
+	infoText(fmt.Sprintf("Importing %s:", filepath.Base(path)))
+	printImportPreview(changes, incoming, scripts)
+
+	var imported []importChange
+	for _, c := range changes {
+		if c.Action != importSkip && c.Action != importSame {
+			imported = append(imported, c)
+		}
+	}
+	if len(imported) == 0 {
+		infoText("Nothing to import.")
+		return nil
+	}
+	if dryRun {
+		infoText("Dry run: nothing was changed.")
+		return nil
+	}
+	if !yes && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Printf("Import %d gadgets? Y/N: ", len(imported))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			warnText("⚠️ Cancelled.")
+			return &ExitCodeError{Code: 1}
+		}
+	}
+
+	for _, c := range imported {
+		config := incoming[c.Name]
+		config.Dangerous = false // worked out again when saved
+		scripts[c.Target] = config
+	}
+	if err := saveScripts(scripts); err != nil {
+		return err
+	}
+	successText(fmt.Sprintf("✅ Imported %d gadgets from %s", len(imported), filepath.Base(path)))
+	var names []string
+	for _, c := range imported {
+		if err := warnImportedGadget(c.Target, scripts[c.Target], scripts); err != nil {
+			return err
+		}
+		names = append(names, c.Target)
+	}
+	warnUnsigned(names, scripts)
+	return nil
+}
+
+// NewLibraryCommand returns the 'library' command, which shows where gadgets
+// are kept and switches the library between JSON, YAML and TOML
+func NewLibraryCommand() *cobra.Command {
+	var format string
+	cmd := &cobra.Command{
+		Use:   "library",
+		Short: "Show where your gadgets are stored, or store them as YAML, TOML or JSON",
+		Long: `Show where your gadgets are stored. With --format the library is converted to
+YAML (user_scripts.yaml), TOML (user_scripts.toml) or back to JSON
+(user_scripts.json). YAML and TOML keep multi-line commands as readable blocks,
+which makes the library easier to edit by hand. The old file is kept with a
+.bak extension.`,
+		Example:      "  GoGoGadget library --format yaml",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			if dir := libraryRepo(); dir != "" {
+				if format != "" {
+					return fmt.Errorf("your gadgets are kept in the git repository at %s as one YAML file per gadget, so the format can't be changed", dir)
+				}
+				infoText(fmt.Sprintf("Your %d gadgets are stored in the git repository at %s, one YAML file per gadget", len(scripts), dir))
+				return nil
+			}
+			path := getUserScriptsPath()
+			current, _ := gogo.FormatOf(path)
+			if format == "" || format == current {
+				infoText(fmt.Sprintf("Your %d gadgets are stored as %s in %s", len(scripts), strings.ToUpper(current), path))
+				return nil
+			}
+			file, ok := libraryFiles[format]
+			if !ok {
+				return fmt.Errorf("the library can be stored as %s, %s or %s, not '%s'", gogo.FormatJSON, gogo.FormatYAML, gogo.FormatTOML, format)
+			}
+			data, err := gogo.Encode(scripts, format)
+			if err != nil {
+				return err
+			}
+			newPath := filepath.Join(getConfigDir(), file)
+			if err := os.WriteFile(newPath+".tmp", data, 0644); err != nil {
+				return err
+			}
+			if err := os.Rename(newPath+".tmp", newPath); err != nil {
+				return err
+			}
+			err = os.Rename(path, path+".bak")
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			successText(fmt.Sprintf("✅ Your gadgets are now stored as %s in %s", strings.ToUpper(format), newPath))
+			if err == nil {
+				infoText(fmt.Sprintf("   The old library was kept as %s", path+".bak"))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "", "Store the library as yaml, toml or json")
+	return cmd
+}
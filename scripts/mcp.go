@@ -0,0 +1,478 @@
+package scripts
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gogo/gogo"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// mcpProtocolVersions lists the Model Context Protocol versions the server
+// speaks, newest first
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// mcpConfirmArgument is the tool argument that confirms a dangerous gadget
+const mcpConfirmArgument = "confirm_dangerous"
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// rpcMessage is a JSON-RPC 2.0 request, notification or response
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// mcpTool describes one gadget as a tool
+type mcpTool struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	InputSchema mcpSchema          `json:"inputSchema"`
+	Annotations mcpToolAnnotations `json:"annotations"`
+}
+
+// mcpToolAnnotations are hints for the client. Tools count as destructive
+// unless they say otherwise, so the hint is always sent.
+type mcpToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	DestructiveHint bool   `json:"destructiveHint"`
+}
+
+// mcpSchema is the small part of JSON Schema needed to describe variables
+type mcpSchema struct {
+	Type                 string                `json:"type"`
+	Description          string                `json:"description,omitempty"`
+	Properties           map[string]*mcpSchema `json:"properties,omitempty"`
+	Required             []string              `json:"required,omitempty"`
+	Items                *mcpSchema            `json:"items,omitempty"`
+	Default              interface{}           `json:"default,omitempty"`
+	AdditionalProperties *bool                 `json:"additionalProperties,omitempty"`
+}
+
+// mcpContent is one block of a tool result
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError"`
+}
+
+// mcpToolError is a failed tool call. It's sent as a result with isError set,
+// so the assistant sees what went wrong and can try again.
+func mcpToolError(format string, args ...interface{}) mcpToolResult {
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: fmt.Sprintf(format, args...)}}, IsError: true}
+}
+
+// variableSchema returns the JSON Schema of one variable, based on its type,
+// list setting, description and default
+func variableSchema(varName string, config gogo.Gadget) *mcpSchema {
+	opt := config.VariableOptions[varName]
+	s := &mcpSchema{Type: "string"}
+	switch opt.Type {
+	case gogo.VariableTypeInt:
+		s.Type = "integer"
+	case gogo.VariableTypeNumber:
+		s.Type = "number"
+	case gogo.VariableTypeBool:
+		s.Type = "boolean"
+	}
+	if def, ok := config.VariableDefault(varName); ok {
+		s.Default = def
+		if checked, err := gogo.CheckValue(varName, def, config); err == nil {
+			switch s.Type {
+			case "integer":
+				s.Default, _ = strconv.ParseInt(checked, 10, 64)
+			case "number":
+				s.Default, _ = strconv.ParseFloat(checked, 64)
+			case "boolean":
+				s.Default = checked == "$true"
+			}
+		}
+	}
+	desc := config.VariableDescription(varName)
+	if opt.List {
+		s = &mcpSchema{Type: "array", Items: &mcpSchema{Type: s.Type}, Default: s.Default}
+		if s.Default != nil {
+			s.Default = []interface{}{s.Default}
+		}
+		desc += " (the gadget runs once per value)"
+	}
+	s.Description = desc
+	return s
+}
+
+// gadgetTool describes a gadget as a tool whose arguments are its variables
+func gadgetTool(name string, config gogo.Gadget, scripts gogo.Library) mcpTool {
+	noExtra := false
+	schema := mcpSchema{Type: "object", Properties: map[string]*mcpSchema{}, AdditionalProperties: &noExtra}
+	for _, v := range gogo.VariableNames(name, config, scripts) {
+		schema.Properties[v] = variableSchema(v, config)
+		if _, ok := config.VariableDefault(v); !ok {
+			schema.Required = append(schema.Required, v)
+		}
+	}
+
+	desc := config.Description
+	if desc == "" {
+		desc = fmt.Sprintf("Run the '%s' gadget", name)
+	}
+	findings := gadgetDangers(name, config, scripts)
+	dangerous := len(findings) > 0 || config.Dangerous
+	if dangerous {
+		var reasons []string
+		for _, f := range findings {
+			reasons = append(reasons, fmt.Sprintf("%s (%s)", f.Reason, f.Command))
+		}
+		desc += "\n\nDANGEROUS: " + strings.Join(reasons, "; ") +
+			fmt.Sprintf(". Ask the user before running it and set %s to true only once they agree.", mcpConfirmArgument)
+		if _, clash := schema.Properties[mcpConfirmArgument]; !clash {
+			schema.Properties[mcpConfirmArgument] = &mcpSchema{
+				Type:        "boolean",
+				Description: "Set to true once the user has agreed to run this dangerous gadget",
+			}
+		}
+	}
+	return mcpTool{
+		Name:        name,
+		Description: desc,
+		InputSchema: schema,
+		Annotations: mcpToolAnnotations{Title: name, DestructiveHint: dangerous},
+	}
+}
+
+// mcpArgumentValues turns one tool argument into variable values. Lists take
+// JSON arrays; a single value is accepted too.
+func mcpArgumentValues(varName string, raw json.RawMessage, config gogo.Gadget) ([]string, error) {
+	var list []json.RawMessage
+	if config.IsListVariable(varName) && json.Unmarshal(raw, &list) == nil {
+		var vals []string
+		for _, item := range list {
+			v, err := mcpScalar(varName, item)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, v)
+		}
+		return vals, nil
+	}
+	v, err := mcpScalar(varName, raw)
+	if err != nil {
+		return nil, err
+	}
+	return []string{v}, nil
+}
+
+// mcpScalar turns a JSON string, number or boolean into the text of a value
+func mcpScalar(varName string, raw json.RawMessage) (string, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("'%s' must be a string, number or boolean", varName)
+}
+
+// mcpServer answers JSON-RPC requests read line by line from stdin
+type mcpServer struct {
+	out io.Writer
+	// writeMu keeps responses from concurrent tool calls whole
+	writeMu sync.Mutex
+	// calls holds the cancel functions of running tool calls by request id
+	callsMu sync.Mutex
+	calls   map[string]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func (s *mcpServer) send(msg rpcMessage) {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		data, _ = json.Marshal(rpcMessage{JSONRPC: "2.0", ID: msg.ID, Error: &rpcError{Code: rpcInternalError, Message: err.Error()}})
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.out.Write(append(data, '\n'))
+}
+
+func (s *mcpServer) reply(id json.RawMessage, result interface{}, err error) {
+	if err != nil {
+		rerr, ok := err.(*rpcError)
+		if !ok {
+			rerr = &rpcError{Code: rpcInternalError, Message: err.Error()}
+		}
+		s.send(rpcMessage{ID: id, Error: rerr})
+		return
+	}
+	s.send(rpcMessage{ID: id, Result: result})
+}
+
+// serve reads messages until in ends or ctx is cancelled. Tool calls run in
+// the background so a long run doesn't hold up pings or cancellations.
+func (s *mcpServer) serve(ctx context.Context, in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			s.reply(json.RawMessage("null"), nil, &rpcError{Code: rpcParseError, Message: "parse error: " + err.Error()})
+			continue
+		}
+		if msg.JSONRPC != "2.0" || msg.Method == "" {
+			if msg.ID != nil && msg.Result == nil && msg.Error == nil {
+				s.reply(msg.ID, nil, &rpcError{Code: rpcInvalidRequest, Message: "invalid request"})
+			}
+			continue // responses to requests we never send are ignored
+		}
+		s.handle(ctx, msg)
+	}
+	s.wg.Wait()
+	return scanner.Err()
+}
+
+func (s *mcpServer) handle(ctx context.Context, msg rpcMessage) {
+	if msg.ID == nil {
+		if msg.Method == "notifications/cancelled" {
+			var p struct {
+				RequestID json.RawMessage `json:"requestId"`
+			}
+			if json.Unmarshal(msg.Params, &p) == nil {
+				s.callsMu.Lock()
+				if cancel, ok := s.calls[string(p.RequestID)]; ok {
+					cancel()
+				}
+				s.callsMu.Unlock()
+			}
+		}
+		return // other notifications, like notifications/initialized, need nothing
+	}
+
+	switch msg.Method {
+	case "initialize":
+		s.reply(msg.ID, mcpInitialize(msg.Params), nil)
+	case "ping":
+		s.reply(msg.ID, struct{}{}, nil)
+	case "tools/list":
+		result, err := mcpListTools()
+		s.reply(msg.ID, result, err)
+	case "tools/call":
+		callCtx, cancel := context.WithCancel(ctx)
+		key := string(msg.ID)
+		s.callsMu.Lock()
+		s.calls[key] = cancel
+		s.callsMu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			result, err := mcpCallTool(callCtx, msg.Params)
+			s.callsMu.Lock()
+			delete(s.calls, key)
+			s.callsMu.Unlock()
+			cancel()
+			s.reply(msg.ID, result, err)
+		}()
+	default:
+		s.reply(msg.ID, nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method '%s' not found", msg.Method)})
+	}
+}
+
+// mcpInitialize agrees on a protocol version: the client's if it's one we
+// know, otherwise our newest
+func mcpInitialize(params json.RawMessage) interface{} {
+	var p struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	_ = json.Unmarshal(params, &p)
+	version := mcpProtocolVersions[0]
+	if containsString(mcpProtocolVersions, p.ProtocolVersion) {
+		version = p.ProtocolVersion
+	}
+	return map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+		"serverInfo":      map[string]string{"name": "GoGoGadget", "version": "1.0.0"},
+		"instructions":    "Each tool runs one of the user's GoGoGadget gadgets (PowerShell shortcuts). Tools marked DANGEROUS need the user's agreement before you set " + mcpConfirmArgument + ".",
+	}
+}
+
+// mcpListTools returns a tool for every gadget. The library is read on each
+// request so gadgets added while the server runs show up.
+func mcpListTools() (interface{}, error) {
+	scripts, err := loadScripts()
+	if err != nil {
+		return nil, fmt.Errorf("error loading your gadgets: %w", err)
+	}
+	tools := []mcpTool{}
+	for _, name := range scripts.Names() {
+		tools = append(tools, gadgetTool(name, scripts[name], scripts))
+	}
+	return map[string]interface{}{"tools": tools}, nil
+}
+
+// mcpCallTool runs a gadget through the same checks as the CLI: the policy,
+// confirmation of dangerous gadgets and variable types. List variables run
+// the gadget once per value, one after the other.
+func mcpCallTool(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Name      string                     `json:"name"`
+		Arguments map[string]json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	scripts, err := loadScripts()
+	if err != nil {
+		return nil, fmt.Errorf("error loading your gadgets: %w", err)
+	}
+	config, ok := scripts[p.Name]
+	if !ok {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("unknown tool '%s'", p.Name)}
+	}
+	name := p.Name
+
+	if _, err := checkPolicy(name, config, scripts); err != nil {
+		return mcpToolError("⛔ %v", err), nil
+	}
+	varNames := gogo.VariableNames(name, config, scripts)
+	confirmed := false
+	if raw, ok := p.Arguments[mcpConfirmArgument]; ok && !containsString(varNames, mcpConfirmArgument) {
+		if err := json.Unmarshal(raw, &confirmed); err != nil {
+			return mcpToolError("%s must be true or false", mcpConfirmArgument), nil
+		}
+		delete(p.Arguments, mcpConfirmArgument)
+	}
+	if findings := gadgetDangers(name, config, scripts); (len(findings) > 0 || config.Dangerous) && !confirmed {
+		var reasons []string
+		for _, f := range findings {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", f.Command, f.Reason))
+		}
+		return mcpToolError("'%s' is marked dangerous and did not run:\n%s\nAsk the user, then call it again with %s set to true if they agree.",
+			name, strings.Join(reasons, "\n"), mcpConfirmArgument), nil
+	}
+
+	for arg := range p.Arguments {
+		if !containsString(varNames, arg) {
+			return mcpToolError("'%s' has no variable '%s'", name, arg), nil
+		}
+	}
+	values := map[string][]string{}
+	for _, v := range varNames {
+		var raw []string
+		if arg, ok := p.Arguments[v]; ok {
+			if raw, err = mcpArgumentValues(v, arg, config); err != nil {
+				return mcpToolError("%v", err), nil
+			}
+		} else if def, ok := config.VariableDefault(v); ok {
+			raw = []string{def}
+		} else {
+			return mcpToolError("no value for variable '%s'", v), nil
+		}
+		if values[v], err = gogo.ExpandValues(v, raw, config); err != nil {
+			return mcpToolError("%v", err), nil
+		}
+		if len(values[v]) == 0 {
+			return mcpToolError("no value for variable '%s'", v), nil
+		}
+	}
+
+	var output bytes.Buffer
+	var outMu sync.Mutex
+	w := &lockedWriter{w: &output, mu: &outMu}
+	failed := false
+	for _, vars := range gogo.Combinations(varNames, values) {
+		start := time.Now()
+		err := runGadgetWithHooks(ctx, name, config, scripts, vars, gogo.Runner{Stdout: w, Stderr: w, Prompt: noPrompt})
+		recordRun(RunSourceMCP, name, vars, start, err)
+		if err != nil {
+			failed = true
+			fmt.Fprintf(w, "\n❌ %v (exit code %d)\n", err, gogo.ExitCode(err))
+		}
+	}
+	text := output.String()
+	if text == "" {
+		text = "(no output)"
+	}
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: text}}, IsError: failed}, nil
+}
+
+// lockedWriter lets stdout and stderr share one buffer
+type lockedWriter struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func (l *lockedWriter) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(b)
+}
+
+// NewMCPCommand returns the 'mcp' command that serves gadgets as tools to assistants
+func NewMCPCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "mcp",
+		Short: "Serve gadgets as tools over the Model Context Protocol (stdio)",
+		Long: `Serve every gadget as a tool to AI assistants and editors that speak the Model
+Context Protocol. Messages are JSON-RPC 2.0, one per line on stdin and stdout;
+configure your assistant to start 'GoGoGadget mcp'.
+
+A tool's arguments are the gadget's variables, with their types, descriptions
+and defaults. Runs go through the same policy and history as the CLI. Gadgets
+marked dangerous only run when the call sets ` + mcpConfirmArgument + ` to true.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// stdout belongs to the protocol; anything GoGoGadget prints goes to stderr
+			out := os.Stdout
+			os.Stdout = os.Stderr
+			defer func() { os.Stdout = out }()
+
+			s := &mcpServer{out: out, calls: map[string]context.CancelFunc{}}
+			return s.serve(cmd.Context(), cmd.InOrStdin())
+		},
+	}
+}
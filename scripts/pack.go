@@ -0,0 +1,656 @@
+package scripts
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gogo/gogo"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// PackExtension is the file extension of gadget packs
+const PackExtension = ".gogopack"
+
+// packFormatVersion is the newest pack layout this version can read
+const packFormatVersion = 1
+
+// Files inside a pack
+const (
+	packManifestFile = "gogopack.json"
+	packGadgetsFile  = "gadgets.json"
+	packReadmeFile   = "README.md"
+)
+
+// maxPackFileSize limits how much of each file in a pack is read
+const maxPackFileSize = 10 << 20
+
+// PackManifest describes a pack: what it is, who made it and which gadgets it holds
+type PackManifest struct {
+	FormatVersion int      `json:"formatVersion"`
+	Name          string   `json:"name"`
+	Version       string   `json:"version"`
+	Author        string   `json:"author,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	Gadgets       []string `json:"gadgets"`
+}
+
+// gadgetPack is a pack read from a .gogopack file
+type gadgetPack struct {
+	Manifest PackManifest
+	Gadgets  gogo.Library
+	Readme   string
+}
+
+// InstalledPack records a pack installed into the library, so its gadgets can be
+// upgraded or removed together
+type InstalledPack struct {
+	Version     string    `json:"version"`
+	Author      string    `json:"author,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Installed   time.Time `json:"installed"`
+	// Gadgets maps each gadget to a hash of it as installed, to notice local changes
+	Gadgets map[string]string `json:"gadgets"`
+}
+
+// getPacksPath returns the path of the installed packs record
+func getPacksPath() string {
+	return filepath.Join(getConfigDir(), "packs.json")
+}
+
+// loadPacks reads the installed packs, by name
+func loadPacks() (map[string]InstalledPack, error) {
+	packs := map[string]InstalledPack{}
+	data, err := os.ReadFile(getPacksPath())
+	if os.IsNotExist(err) {
+		return packs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &packs); err != nil {
+		return nil, fmt.Errorf("packs.json is unreadable: %w", err)
+	}
+	return packs, nil
+}
+
+// savePacks writes the installed packs
+func savePacks(packs map[string]InstalledPack) error {
+	return writeFileAtomic(getPacksPath(), packs)
+}
+
+// packOwners maps each gadget installed from a pack to the pack's name
+func packOwners(packs map[string]InstalledPack) map[string]string {
+	owners := map[string]string{}
+	for name, p := range packs {
+		for gadget := range p.Gadgets {
+			owners[gadget] = name
+		}
+	}
+	return owners
+}
+
+// gadgetHash fingerprints a gadget's definition, ignoring its signature
+func gadgetHash(name string, config gogo.Gadget) string {
+	config.Signature = nil
+	payload, _ := signaturePayload(name, config)
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// compareVersions compares dotted version numbers like 1.2.0: -1 if a is older
+// than b, 1 if newer and 0 if they are the same. Missing parts count as 0.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// writePack writes a pack as a zip file. Entries carry no timestamps, so the same
+// pack always gives the same file.
+func writePack(path string, pack gadgetPack) error {
+	manifest, err := json.MarshalIndent(pack.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	gadgets, err := json.MarshalIndent(pack.Gadgets, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+	files := []struct {
+		name string
+		data []byte
+	}{{packManifestFile, manifest}, {packGadgetsFile, gadgets}}
+	if pack.Readme != "" {
+		files = append(files, struct {
+			name string
+			data []byte
+		}{packReadmeFile, []byte(pack.Readme)})
+	}
+	for _, file := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate})
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := w.Write(file.data); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readPackFile returns one file from an open pack, or nil if it isn't there
+func readPackFile(zr *zip.ReadCloser, name string) ([]byte, error) {
+	for _, file := range zr.File {
+		if file.Name != name {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, maxPackFileSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxPackFileSize {
+			return nil, fmt.Errorf("%s in the pack is too large", name)
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// readPack opens a .gogopack file and checks that it is complete and consistent
+func readPack(path string) (*gadgetPack, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a gadget pack: %w", path, err)
+	}
+	defer zr.Close()
+
+	manifestData, err := readPackFile(zr, packManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	if manifestData == nil {
+		return nil, fmt.Errorf("%s is not a gadget pack: it has no %s", path, packManifestFile)
+	}
+	var pack gadgetPack
+	if err := json.Unmarshal(manifestData, &pack.Manifest); err != nil {
+		return nil, fmt.Errorf("the manifest of %s is unreadable: %w", path, err)
+	}
+	m := pack.Manifest
+	if m.FormatVersion > packFormatVersion {
+		return nil, fmt.Errorf("%s needs a newer GoGoGadget (pack format %d)", path, m.FormatVersion)
+	}
+	if !gogo.ValidName(m.Name) {
+		return nil, fmt.Errorf("the pack name '%s' is not valid", m.Name)
+	}
+	if !moduleVersionRe.MatchString(m.Version) {
+		return nil, fmt.Errorf("the pack version '%s' is not valid", m.Version)
+	}
+
+	gadgetData, err := readPackFile(zr, packGadgetsFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(gadgetData, &pack.Gadgets); err != nil {
+		return nil, fmt.Errorf("the gadgets in %s are unreadable: %w", path, err)
+	}
+	if len(pack.Gadgets) != len(m.Gadgets) {
+		return nil, fmt.Errorf("the manifest of %s lists %d gadgets but the pack holds %d", path, len(m.Gadgets), len(pack.Gadgets))
+	}
+	for _, name := range m.Gadgets {
+		if _, ok := pack.Gadgets[name]; !ok {
+			return nil, fmt.Errorf("the manifest of %s lists '%s', which the pack doesn't hold", path, name)
+		}
+		if !gogo.ValidName(name) {
+			return nil, fmt.Errorf("the pack holds a gadget with an invalid name: '%s'", name)
+		}
+	}
+
+	readme, err := readPackFile(zr, packReadmeFile)
+	if err != nil {
+		return nil, err
+	}
+	pack.Readme = string(readme)
+	return &pack, nil
+}
+
+// printPackGadgets lists a pack's gadgets with anything worth knowing before
+// installing them: danger, signatures and policy
+func printPackGadgets(pack *gadgetPack, library gogo.Library) {
+	policies, _ := loadPolicies()
+	combined := gogo.Library{}
+	for name, config := range library {
+		combined[name] = config
+	}
+	for name, config := range pack.Gadgets {
+		combined[name] = config
+	}
+	for _, name := range pack.Manifest.Gadgets {
+		config := pack.Gadgets[name]
+		colorText.Green(fmt.Sprintf("  %s: %s", name, config.Description))
+		if findings := gadgetDangers(name, config, combined); len(findings) > 0 {
+			warnText("    ⚠️ dangerous:")
+			printDangers(name, findings)
+		}
+		switch err := verifyGadgetSignature(name, config, policies); {
+		case config.Signature == nil:
+			infoText("    not signed")
+		case err != nil:
+			warnText("    ⚠️ " + err.Error())
+		default:
+			who, _ := trustedKeyName(config.Signature.PublicKey, policies)
+			successText(fmt.Sprintf("    🔑 signed by %s", who))
+		}
+		for _, v := range gadgetPolicyViolations(name, config, combined, policies) {
+			if v.Gadget == name {
+				warnText("    ⛔ blocked by policy: " + v.String())
+			}
+		}
+		for _, step := range config.Steps {
+			if _, ok := combined[step.Gadget]; !ok {
+				warnText(fmt.Sprintf("    ⚠️ needs the gadget '%s', which neither the pack nor your library has", step.Gadget))
+			}
+		}
+	}
+}
+
+// packGadgetsWithSteps returns the named gadgets plus every gadget their
+// workflows run, sorted
+func packGadgetsWithSteps(names []string, scripts gogo.Library) ([]string, error) {
+	seen := map[string]bool{}
+	var add func(string) error
+	add = func(name string) error {
+		if seen[name] {
+			return nil
+		}
+		config, ok := scripts[name]
+		if !ok {
+			return fmt.Errorf("gadget '%s' not found", name)
+		}
+		seen[name] = true
+		for _, step := range config.Steps {
+			if err := add(step.Gadget); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, name := range names {
+		if err := add(name); err != nil {
+			return nil, err
+		}
+	}
+	all := make([]string, 0, len(seen))
+	for name := range seen {
+		all = append(all, name)
+	}
+	sort.Strings(all)
+	return all, nil
+}
+
+// installPack adds a pack's gadgets to the library, replacing an installed
+// version of the same pack. Gadgets that belong to the user or to another pack
+// are never replaced.
+func installPack(pack *gadgetPack, force bool) error {
+	m := pack.Manifest
+	scripts, err := loadScripts()
+	if err != nil {
+		return err
+	}
+	packs, err := loadPacks()
+	if err != nil {
+		return err
+	}
+	previous, upgrading := packs[m.Name]
+	if upgrading && !force {
+		switch compareVersions(m.Version, previous.Version) {
+		case 0:
+			return fmt.Errorf("%s %s is already installed; use --force to install it again", m.Name, m.Version)
+		case -1:
+			return fmt.Errorf("%s %s is newer than %s; use --force to go back to the older version", m.Name, previous.Version, m.Version)
+		}
+	}
+
+	owners := packOwners(packs)
+	var conflicts []string
+	for _, name := range m.Gadgets {
+		if _, exists := scripts[name]; !exists || owners[name] == m.Name {
+			continue
+		}
+		if owner := owners[name]; owner != "" {
+			conflicts = append(conflicts, fmt.Sprintf("'%s' comes from the pack %s", name, owner))
+		} else {
+			conflicts = append(conflicts, fmt.Sprintf("'%s' is one of your own gadgets", name))
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%s can't be installed because gadgets with the same names exist:\n  • %s\nRename or delete them first", m.Name, strings.Join(conflicts, "\n  • "))
+	}
+
+	for _, name := range sortedKeys(previous.Gadgets) {
+		config, ok := scripts[name]
+		if !ok {
+			continue
+		}
+		if gadgetHash(name, config) != previous.Gadgets[name] {
+			if !containsString(m.Gadgets, name) {
+				infoText(fmt.Sprintf("Kept '%s' because you changed it; it's now one of your own gadgets.", name))
+				continue
+			}
+			warnText(fmt.Sprintf("⚠️ Your changes to '%s' were replaced by the pack.", name))
+		}
+		delete(scripts, name)
+	}
+	installed := InstalledPack{
+		Version:     m.Version,
+		Author:      m.Author,
+		Description: m.Description,
+		Installed:   time.Now().UTC().Truncate(time.Second),
+		Gadgets:     map[string]string{},
+	}
+	for _, name := range m.Gadgets {
+		config := pack.Gadgets[name]
+		config.Dangerous = false // worked out again when saved
+		scripts[name] = config
+		installed.Gadgets[name] = gadgetHash(name, config)
+	}
+	if err := saveScripts(scripts); err != nil {
+		return err
+	}
+	packs[m.Name] = installed
+	if err := savePacks(packs); err != nil {
+		return err
+	}
+	if upgrading {
+		successText(fmt.Sprintf("✅ Upgraded %s from %s to %s (%d gadgets).", m.Name, previous.Version, m.Version, len(m.Gadgets)))
+	} else {
+		successText(fmt.Sprintf("✅ Installed %s %s (%d gadgets).", m.Name, m.Version, len(m.Gadgets)))
+	}
+	return nil
+}
+
+// uninstallPack removes a pack's gadgets. Gadgets changed since they were
+// installed are kept as the user's own.
+func uninstallPack(name string) error {
+	packs, err := loadPacks()
+	if err != nil {
+		return err
+	}
+	pack, ok := packs[name]
+	if !ok {
+		return fmt.Errorf("the pack '%s' is not installed", name)
+	}
+	scripts, err := loadScripts()
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, gadget := range sortedKeys(pack.Gadgets) {
+		config, ok := scripts[gadget]
+		if !ok {
+			continue
+		}
+		if gadgetHash(gadget, config) != pack.Gadgets[gadget] {
+			infoText(fmt.Sprintf("Kept '%s' because you changed it; it's now one of your own gadgets.", gadget))
+			continue
+		}
+		delete(scripts, gadget)
+		removed++
+	}
+	if err := saveScripts(scripts); err != nil {
+		return err
+	}
+	delete(packs, name)
+	if err := savePacks(packs); err != nil {
+		return err
+	}
+	successText(fmt.Sprintf("✅ Uninstalled %s %s (removed %d gadgets).", name, pack.Version, removed))
+	return nil
+}
+
+// NewPackCommand returns the 'pack' command for sharing gadgets as .gogopack files
+func NewPackCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pack",
+		Short: "Share gadgets as .gogopack files and install packs from others",
+		Long: `A pack is a single .gogopack file holding gadgets, a name, a version, the
+author and an optional README. Installed packs are tracked, so a newer version
+replaces the old one and uninstalling removes exactly the pack's gadgets.`,
+	}
+
+	var version, author, description, readme, output string
+	var sign bool
+	createCmd := &cobra.Command{
+		Use:   "create <pack-name> <gadget>...",
+		Short: "Bundle gadgets into a .gogopack file",
+		Example: `  GoGoGadget pack create server-tools restart-vm check-disk --version 1.0.0 --readme README.md
+  GoGoGadget pack create server-tools restart-vm --sign -o server-tools.gogopack`,
+		Args:         cobra.MinimumNArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			packName := args[0]
+			if !gogo.ValidName(packName) {
+				return fmt.Errorf("'%s' can't be a pack name; use letters, numbers, dashes or underscores", packName)
+			}
+			if !moduleVersionRe.MatchString(version) {
+				return fmt.Errorf("'%s' isn't a version; use numbers like 1.2.0", version)
+			}
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			names, err := packGadgetsWithSteps(args[1:], scripts)
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				if !containsString(args[1:], name) {
+					infoText(fmt.Sprintf("Including '%s' because a workflow in the pack runs it.", name))
+				}
+			}
+
+			var key *signingKey
+			if sign {
+				if key, err = loadSigningKey(); err != nil {
+					return err
+				}
+				if key == nil {
+					return fmt.Errorf("you don't have a signing key yet; create one with 'GoGoGadget sign --show-key'")
+				}
+			}
+			pack := gadgetPack{
+				Manifest: PackManifest{
+					FormatVersion: packFormatVersion,
+					Name:          packName,
+					Version:       version,
+					Author:        author,
+					Description:   description,
+					Gadgets:       names,
+				},
+				Gadgets: gogo.Library{},
+			}
+			if pack.Manifest.Author == "" && key != nil {
+				pack.Manifest.Author = key.Author
+			}
+			for _, name := range names {
+				config := scripts[name]
+				config.Dangerous = false
+				if key != nil {
+					if err := signGadget(name, &config, key); err != nil {
+						return err
+					}
+				} else if config.Signature != nil && checkSignature(name, config) != nil {
+					warnText(fmt.Sprintf("⚠️ The signature on '%s' no longer matches it, so it was left out of the pack.", name))
+					config.Signature = nil
+				}
+				pack.Gadgets[name] = config
+			}
+			if readme != "" {
+				data, err := os.ReadFile(readme)
+				if err != nil {
+					return err
+				}
+				pack.Readme = string(data)
+			}
+			if output == "" {
+				output = packName + PackExtension
+			}
+			if err := writePack(output, pack); err != nil {
+				return err
+			}
+			successText(fmt.Sprintf("✅ Created %s with %d gadgets.", output, len(names)))
+			return nil
+		},
+	}
+	createCmd.Flags().StringVar(&version, "version", "1.0.0", "Version of the pack")
+	createCmd.Flags().StringVar(&author, "author", "", "Who made the pack (default: your signing key's name when --sign is used)")
+	createCmd.Flags().StringVar(&description, "desc", "", "What the pack is for")
+	createCmd.Flags().StringVar(&readme, "readme", "", "A README file to include")
+	createCmd.Flags().StringVarP(&output, "output", "o", "", "File to write (default: <pack-name>.gogopack)")
+	createCmd.Flags().BoolVar(&sign, "sign", false, "Sign the gadgets in the pack with your key")
+
+	inspectCmd := &cobra.Command{
+		Use:          "inspect <file.gogopack>",
+		Short:        "Show what a pack holds without installing it",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pack, err := readPack(args[0])
+			if err != nil {
+				return err
+			}
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			m := pack.Manifest
+			colorText.Cyan(fmt.Sprintf("📦 %s %s", m.Name, m.Version))
+			if m.Author != "" {
+				colorText.Cyan("   by " + m.Author)
+			}
+			if m.Description != "" {
+				colorText.Cyan("   " + m.Description)
+			}
+			packs, _ := loadPacks()
+			if installed, ok := packs[m.Name]; ok {
+				infoText(fmt.Sprintf("   Version %s is installed.", installed.Version))
+			}
+			fmt.Println()
+			printPackGadgets(pack, scripts)
+			if pack.Readme != "" {
+				fmt.Println()
+				fmt.Println(strings.TrimSpace(pack.Readme))
+			}
+			return nil
+		},
+	}
+
+	var force bool
+	installCmd := &cobra.Command{
+		Use:          "install <file.gogopack>",
+		Short:        "Install a pack, or upgrade it if an older version is installed",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pack, err := readPack(args[0])
+			if err != nil {
+				return err
+			}
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			colorText.Cyan(fmt.Sprintf("📦 %s %s", pack.Manifest.Name, pack.Manifest.Version))
+			printPackGadgets(pack, scripts)
+			return installPack(pack, force)
+		},
+	}
+	installCmd.Flags().BoolVar(&force, "force", false, "Install even if this or a newer version is already installed")
+
+	uninstallCmd := &cobra.Command{
+		Use:          "uninstall <pack-name>",
+		Short:        "Remove a pack's gadgets",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return uninstallPack(args[0])
+		},
+	}
+
+	listCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List installed packs",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			packs, err := loadPacks()
+			if err != nil {
+				return err
+			}
+			if len(packs) == 0 {
+				colorText.Cyan("No packs installed. Install one with 'GoGoGadget pack install <file.gogopack>'.")
+				return nil
+			}
+			names := make([]string, 0, len(packs))
+			for name := range packs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				p := packs[name]
+				line := fmt.Sprintf("📦 %s %s", name, p.Version)
+				if p.Author != "" {
+					line += " by " + p.Author
+				}
+				colorText.Green(line)
+				if p.Description != "" {
+					infoText("   " + p.Description)
+				}
+				infoText("   " + strings.Join(sortedKeys(p.Gadgets), ", "))
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(createCmd, inspectCmd, installCmd, uninstallCmd, listCmd)
+	return cmd
+}
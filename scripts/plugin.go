@@ -0,0 +1,301 @@
+package scripts
+
+import (
+	"errors"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-colorable"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// pluginPrefixes start the file names of plugin executables: GoGoGadget-<name>
+// or gogo-<name> adds the command <name>
+var pluginPrefixes = []string{"GoGoGadget-", "gogo-"}
+
+// Environment variables GoGoGadget passes to plugins
+const (
+	// PluginStoreVariable is the gadget library: a file, or the folder of
+	// gadget files when the library is kept in a git repository
+	PluginStoreVariable = "GOGOGADGET_STORE"
+	// PluginStoreFormatVariable is json, yaml, toml or dir (one YAML file per gadget)
+	PluginStoreFormatVariable = "GOGOGADGET_STORE_FORMAT"
+	PluginSettingsVariable    = "GOGOGADGET_SETTINGS"
+	PluginConfigDirVariable   = "GOGOGADGET_CONFIG_DIR"
+	// PluginOutputVariable is color when the plugin may print colors, otherwise plain
+	PluginOutputVariable = "GOGOGADGET_OUTPUT"
+	// PluginExecutableVariable is GoGoGadget itself, for plugins that run gadgets
+	PluginExecutableVariable = "GOGOGADGET_EXECUTABLE"
+)
+
+// Values of PluginOutputVariable
+const (
+	PluginOutputColor = "color"
+	PluginOutputPlain = "plain"
+)
+
+// StoreFormatDir is the store format of a library kept in a git repository
+const StoreFormatDir = "dir"
+
+// pluginAnnotation marks the commands added for plugins, with the plugin's path
+const pluginAnnotation = "gogogadget-plugin"
+
+// plugin is an executable found in the plugins folder or on PATH
+type plugin struct {
+	Name string
+	Path string
+	// HiddenBy names what 'GoGoGadget <name>' runs instead of the plugin, if anything
+	HiddenBy string
+	// Duplicate is set when HiddenBy is another plugin with the same name
+	Duplicate bool
+}
+
+// pluginsDir is the folder searched for plugins before PATH
+func pluginsDir() string {
+	return filepath.Join(getConfigDir(), "plugins")
+}
+
+// findPlugins returns the plugins in the plugins folder and on PATH, sorted by
+// name. When several executables have the same name the first one found is
+// used; the others are returned as hidden by it.
+func findPlugins() []plugin {
+	dirs := append([]string{pluginsDir()}, filepath.SplitList(os.Getenv("PATH"))...)
+	var plugins []plugin
+	first := map[string]string{}
+	seenDirs := map[string]bool{}
+	for _, dir := range dirs {
+		if dir == "" || seenDirs[dir] {
+			continue
+		}
+		seenDirs[dir] = true
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := pluginName(entry.Name())
+			if !ok {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if !isExecutable(path) {
+				continue
+			}
+			p := plugin{Name: name, Path: path}
+			if earlier, ok := first[name]; ok {
+				p.HiddenBy, p.Duplicate = "the plugin at "+earlier, true
+			} else {
+				first[name] = path
+			}
+			plugins = append(plugins, p)
+		}
+	}
+	// Stable, so plugins with the same name stay in search order
+	sort.SliceStable(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+// pluginName returns the command a plugin file adds, if the file is a plugin
+func pluginName(file string) (string, bool) {
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(file))
+		if !containsString(windowsExecutableExts(), ext) {
+			return "", false
+		}
+		file = strings.TrimSuffix(file, filepath.Ext(file))
+	}
+	for _, prefix := range pluginPrefixes {
+		if len(file) > len(prefix) && strings.EqualFold(file[:len(prefix)], prefix) {
+			name := file[len(prefix):]
+			return name, gogo.ValidName(name)
+		}
+	}
+	return "", false
+}
+
+// windowsExecutableExts returns the extensions Windows runs as programs
+func windowsExecutableExts() []string {
+	pathext := os.Getenv("PATHEXT")
+	if pathext == "" {
+		pathext = ".com;.exe;.bat;.cmd"
+	}
+	var exts []string
+	for _, ext := range strings.Split(strings.ToLower(pathext), ";") {
+		if ext != "" {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+// isExecutable reports whether path is a file that can be run
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode()&0111 != 0
+}
+
+// pluginEnv returns the environment variables that tell a plugin where
+// GoGoGadget keeps its files and how to print
+func pluginEnv() []string {
+	store, format := getUserScriptsPath(), StoreFormatDir
+	if dir := libraryRepo(); dir != "" {
+		store = repoStore(dir).Dir
+	} else {
+		format, _ = gogo.FormatOf(store)
+	}
+	output := PluginOutputPlain
+	if _, noColor := os.LookupEnv("NO_COLOR"); !noColor && term.IsTerminal(int(os.Stdout.Fd())) {
+		output = PluginOutputColor
+	}
+	self, _ := os.Executable()
+	return []string{
+		PluginStoreVariable + "=" + store,
+		PluginStoreFormatVariable + "=" + format,
+		PluginSettingsVariable + "=" + getSettingsPath(),
+		PluginConfigDirVariable + "=" + getConfigDir(),
+		PluginOutputVariable + "=" + output,
+		PluginExecutableVariable + "=" + self,
+	}
+}
+
+// runPlugin runs a plugin with the terminal's input and output. The plugin
+// reports its own errors, so only its exit code is passed on.
+func runPlugin(cmd *cobra.Command, p plugin, args []string) error {
+	err := defaultRunner().Exec(cmd.Context(), p.Path, args, pluginEnv())
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &exitErr), errors.Is(err, gogo.ErrInterrupted):
+		return &ExitCodeError{Code: gogo.ExitCode(err)}
+	}
+	return fmt.Errorf("running plugin '%s': %w", p.Name, err)
+}
+
+// AddPluginCommands adds a command for each plugin. Built-in commands and
+// gadgets keep their names: a plugin with the same name is left out, and can
+// still be run with 'GoGoGadget plugin run'.
+func AddPluginCommands(root *cobra.Command) {
+	plugins := findPlugins()
+	markHiddenPlugins(root, plugins)
+	for _, p := range plugins {
+		if p.HiddenBy != "" {
+			continue
+		}
+		root.AddCommand(&cobra.Command{
+			Use:                p.Name,
+			Short:              fmt.Sprintf("Plugin (%s)", p.Path),
+			Annotations:        map[string]string{pluginAnnotation: p.Path},
+			DisableFlagParsing: true,
+			SilenceUsage:       true,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runPlugin(cmd, p, args)
+			},
+		})
+	}
+}
+
+// markHiddenPlugins records which plugins share a name with a built-in command
+// or a gadget
+func markHiddenPlugins(root *cobra.Command, plugins []plugin) {
+	scripts, _ := loadScripts()
+	// Cobra adds these when the command line is parsed
+	taken := map[string]string{"help": "the built-in command 'help'", "completion": "the built-in command 'completion'"}
+	for _, c := range root.Commands() {
+		if _, ok := c.Annotations[pluginAnnotation]; ok {
+			continue
+		}
+		for _, name := range append([]string{c.Name()}, c.Aliases...) {
+			if _, ok := scripts[name]; ok {
+				taken[name] = fmt.Sprintf("the gadget '%s'", name)
+			} else {
+				taken[name] = fmt.Sprintf("the built-in command '%s'", name)
+			}
+		}
+	}
+	for i, p := range plugins {
+		if by, ok := taken[p.Name]; ok && p.HiddenBy == "" {
+			plugins[i].HiddenBy = by
+		}
+	}
+}
+
+// NewPluginCommand creates the 'plugin' command for listing and running plugins
+func NewPluginCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "List and run plugins that add commands to GoGoGadget",
+		Long: `Any program named GoGoGadget-<name> or gogo-<name> in the plugins folder of
+the GoGoGadget config folder, or on your PATH, adds the command
+'GoGoGadget <name>'. The plugins folder is searched first.
+
+Plugins get these environment variables:
+  ` + PluginStoreVariable + `          the gadget library file, or folder in repository mode
+  ` + PluginStoreFormatVariable + `   json, yaml, toml or dir
+  ` + PluginSettingsVariable + `       settings.json
+  ` + PluginConfigDirVariable + `     the GoGoGadget config folder
+  ` + PluginOutputVariable + `         color or plain
+  ` + PluginExecutableVariable + `     GoGoGadget itself
+
+A plugin with the same name as a built-in command or a gadget doesn't get a
+command of its own; run it with 'GoGoGadget plugin run <name>'.`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "Show the plugins GoGoGadget found",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plugins := findPlugins()
+			markHiddenPlugins(cmd.Root(), plugins)
+			if len(plugins) == 0 {
+				colorText.Cyan(fmt.Sprintf("No plugins found. Put a GoGoGadget-<name> or gogo-<name> program in %s or on your PATH.", pluginsDir()))
+				return nil
+			}
+			out := colorable.NewColorableStdout()
+			fmt.Fprintf(out, "\x1b[36m%-20s  %s\x1b[0m\n", "Plugin", "Path")
+			for _, p := range plugins {
+				fmt.Fprintf(out, "\x1b[1;35m%-20s\x1b[0m  %s\n", p.Name, p.Path)
+				switch {
+				case p.Duplicate:
+					fmt.Fprintf(out, "  \x1b[33m⚠️  Not used: %s comes first\x1b[0m\n", p.HiddenBy)
+				case p.HiddenBy != "":
+					fmt.Fprintf(out, "  \x1b[33m⚠️  'GoGoGadget %s' runs %s; run the plugin with 'GoGoGadget plugin run %s'\x1b[0m\n", p.Name, p.HiddenBy, p.Name)
+				}
+			}
+			return nil
+		},
+	}
+
+	runCmd := &cobra.Command{
+		Use:   "run <plugin> [args...]",
+		Short: "Run a plugin, even one hidden by a command or gadget",
+		// Everything after the plugin name belongs to the plugin
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+				return cmd.Help()
+			}
+			for _, p := range findPlugins() {
+				if p.Name == args[0] {
+					return runPlugin(cmd, p, args[1:])
+				}
+			}
+			return fmt.Errorf("no plugin named '%s'; see 'GoGoGadget plugin list'", args[0])
+		},
+	}
+
+	cmd.AddCommand(listCmd, runCmd)
+	return cmd
+}
@@ -0,0 +1,357 @@
+package scripts
+
+import (
+	"encoding/json"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	"github.com/spf13/cobra"
+)
+
+// Policy restricts what gadgets may do. An administrator can set a machine-wide
+// policy and users can add their own; a gadget must pass every policy file.
+type Policy struct {
+	// AllowCommands, when set, lists the only cmdlets and executables gadgets may
+	// run. Entries may use wildcards, e.g. "Get-*".
+	AllowCommands []string `json:"allowCommands,omitempty"`
+	// DenyCommands lists cmdlets and executables gadgets may never run
+	DenyCommands []string `json:"denyCommands,omitempty"`
+	// ForbidRawVariables requires every {{variable}} to sit inside a single-quoted
+	// string, so a value can't be run as code
+	ForbidRawVariables bool `json:"forbidRawVariables,omitempty"`
+	// RequireSigned only allows gadgets signed with a trusted key
+	RequireSigned bool `json:"requireSigned,omitempty"`
+	// TrustedKeys lists public keys ("ed25519:...") trusted on top of each user's own list
+	TrustedKeys []string `json:"trustedKeys,omitempty"`
+
+	// path is the file the policy was read from
+	path string
+	// machine is set for the administrator's policy
+	machine bool
+}
+
+// Policy rule names, as they appear in policy.json
+const (
+	RuleAllowCommands      = "allowCommands"
+	RuleDenyCommands       = "denyCommands"
+	RuleForbidRawVariables = "forbidRawVariables"
+	RuleRequireSigned      = "requireSigned"
+)
+
+// extraPolicyVariable names a policy file to apply on top of the others, e.g.
+// to try out a policy before rolling it out. It can only add rules: the
+// machine policy always applies, so users can't switch it off.
+const extraPolicyVariable = "GOGOGADGET_EXTRA_POLICY"
+
+// userPolicyPath returns the policy file in the user's GoGoGadget folder
+func userPolicyPath() string {
+	return filepath.Join(getConfigDir(), "policy.json")
+}
+
+// policyPaths returns every place a policy file is looked for, machine first
+func policyPaths() []string {
+	paths := []string{machinePolicyPath()}
+	if extra := os.Getenv(extraPolicyVariable); extra != "" {
+		paths = append(paths, extra)
+	}
+	return append(paths, userPolicyPath())
+}
+
+// loadPolicies reads every policy file that exists. A file that can't be read
+// or parsed is an error rather than being ignored, so a broken policy blocks runs.
+func loadPolicies() ([]Policy, error) {
+	var policies []Policy
+	for _, path := range policyPaths() {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read policy %s: %w", path, err)
+		}
+		var p Policy
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, fmt.Errorf("could not parse policy %s: %w", path, err)
+		}
+		p.path = path
+		p.machine = path == machinePolicyPath()
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// policyViolation is one rule a gadget breaks
+type policyViolation struct {
+	Gadget string
+	Rule   string
+	Detail string
+	Path   string
+}
+
+func (v policyViolation) String() string {
+	return fmt.Sprintf("%s (%s in %s)", v.Detail, v.Rule, v.Path)
+}
+
+// PolicyError is returned when a policy blocks a gadget from running
+type PolicyError struct {
+	Gadget     string
+	Violations []policyViolation
+}
+
+func (e *PolicyError) Error() string {
+	lines := []string{fmt.Sprintf("gadget '%s' is blocked by policy:", e.Gadget)}
+	for _, v := range e.Violations {
+		lines = append(lines, "  • "+v.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// psAliases maps common PowerShell aliases to the cmdlets they run, so
+// allowing or denying a cmdlet covers its aliases too
+var psAliases = map[string]string{
+	"rm": "remove-item", "del": "remove-item", "erase": "remove-item", "rd": "remove-item", "rmdir": "remove-item", "ri": "remove-item",
+	"cp": "copy-item", "copy": "copy-item", "cpi": "copy-item",
+	"mv": "move-item", "move": "move-item", "mi": "move-item",
+	"ls": "get-childitem", "dir": "get-childitem", "gci": "get-childitem",
+	"cat": "get-content", "gc": "get-content", "type": "get-content",
+	"echo": "write-output", "write": "write-output",
+	"cd": "set-location", "chdir": "set-location", "sl": "set-location",
+	"ni": "new-item", "md": "new-item", "mkdir": "new-item",
+	"iex": "invoke-expression", "iwr": "invoke-webrequest", "irm": "invoke-restmethod",
+	"start": "start-process", "saps": "start-process",
+	"kill": "stop-process", "spps": "stop-process",
+	"ps": "get-process", "gps": "get-process",
+	"icm": "invoke-command", "%": "foreach-object", "foreach": "foreach-object", "?": "where-object", "where": "where-object",
+}
+
+// commandMatches reports whether a command (or the cmdlet its alias stands for)
+// matches one of the patterns
+func commandMatches(name string, patterns []string) bool {
+	base := commandBaseName(name)
+	candidates := []string{base}
+	if cmdlet, ok := psAliases[base]; ok {
+		candidates = append(candidates, cmdlet)
+	}
+	for _, pattern := range patterns {
+		pattern = commandBaseName(pattern)
+		for _, c := range candidates {
+			if ok, _ := filepath.Match(pattern, c); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// safeBuiltins are built-in variables whose values are always plain numbers,
+// gadget names or quoted paths, so they are safe to insert outside quotes
+var safeBuiltins = map[string]bool{gogo.ExitCodeVariable: true, gogo.DurationVariable: true, gogo.GadgetNameVariable: true, gogo.ChangedFilesVariable: true}
+
+// rawVariables returns the {{variables}} in command that aren't inside a single-quoted string
+func rawVariables(command string) []string {
+	var raw []string
+	seen := map[string]bool{}
+	for _, token := range tokenizePowerShell(command) {
+		if token.Type == chroma.LiteralStringSingle {
+			continue
+		}
+		for _, m := range placeholderRe.FindAllStringSubmatch(token.Value, -1) {
+			if !seen[m[1]] && !safeBuiltins[m[1]] {
+				raw = append(raw, m[1])
+				seen[m[1]] = true
+			}
+		}
+	}
+	return raw
+}
+
+// checkCommandPolicy returns the rules one command line breaks under policy p
+func checkCommandPolicy(gadget, command string, p Policy) []policyViolation {
+	var violations []policyViolation
+	add := func(rule, detail string) {
+		violations = append(violations, policyViolation{Gadget: gadget, Rule: rule, Detail: detail, Path: p.path})
+	}
+	for _, call := range parseCommandCalls(command) {
+		switch {
+		case commandMatches(call.Name, p.DenyCommands):
+			add(RuleDenyCommands, fmt.Sprintf("'%s' is not allowed", call.Name))
+		case len(p.AllowCommands) == 0:
+		case call.Computed || strings.Contains(call.Name, "{{") || strings.HasPrefix(call.Name, "$"):
+			add(RuleAllowCommands, fmt.Sprintf("the command '%s' is only known when the gadget runs, so it can't be checked", call.Name))
+		case !commandMatches(call.Name, p.AllowCommands):
+			add(RuleAllowCommands, fmt.Sprintf("'%s' is not on the list of allowed commands", call.Name))
+		}
+	}
+	// With a list of allowed commands, anything that runs code without a
+	// command is refused rather than let through
+	if len(p.AllowCommands) > 0 {
+		for _, m := range staticMembers(command) {
+			add(RuleAllowCommands, fmt.Sprintf("'%s' uses .NET directly, so it can't be checked against the allowed commands", m))
+		}
+	}
+	if p.ForbidRawVariables {
+		for _, v := range rawVariables(command) {
+			add(RuleForbidRawVariables, fmt.Sprintf("{{%s}} is inserted as code; put it inside single quotes, like '{{%s}}'", v, v))
+		}
+	}
+	return violations
+}
+
+// gadgetPolicyViolations returns every rule a gadget breaks, including its hooks,
+// the global hooks and, for workflows, the gadgets of each step
+func gadgetPolicyViolations(name string, config gogo.Gadget, scripts gogo.Library, policies []Policy) []policyViolation {
+	var violations []policyViolation
+	hooks := globalHooks()
+	for _, p := range policies {
+		for _, command := range []string{hooks.Before, hooks.After} {
+			violations = append(violations, checkCommandPolicy("settings.json hooks", command, p)...)
+		}
+	}
+	return append(violations, collectPolicyViolations(name, config, scripts, policies, map[string]bool{})...)
+}
+
+func collectPolicyViolations(name string, config gogo.Gadget, scripts gogo.Library, policies []Policy, visiting map[string]bool) []policyViolation {
+	if visiting[name] {
+		return nil
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	var violations []policyViolation
+	for _, p := range policies {
+		for _, command := range []string{config.Before, config.Command, config.After} {
+			violations = append(violations, checkCommandPolicy(name, command, p)...)
+		}
+		if p.RequireSigned {
+			var err error
+			if p.machine {
+				err = verifyMachineSignature(name, config, p)
+			} else {
+				err = verifyGadgetSignature(name, config, policies)
+			}
+			if err != nil {
+				violations = append(violations, policyViolation{Gadget: name, Rule: RuleRequireSigned, Detail: err.Error(), Path: p.path})
+			}
+		}
+	}
+	for _, step := range config.Steps {
+		if stepConfig, ok := scripts[step.Gadget]; ok {
+			violations = append(violations, collectPolicyViolations(step.Gadget, stepConfig, scripts, policies, visiting)...)
+		}
+	}
+	return violations
+}
+
+// escapeValues reports whether variable values must be escaped for single-quoted strings
+func escapeValues(policies []Policy) bool {
+	for _, p := range policies {
+		if p.ForbidRawVariables {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPolicy loads the policies and returns a *PolicyError if they block the gadget
+func checkPolicy(name string, config gogo.Gadget, scripts gogo.Library) ([]Policy, error) {
+	policies, err := loadPolicies()
+	if err != nil {
+		return nil, err
+	}
+	if violations := gadgetPolicyViolations(name, config, scripts, policies); len(violations) > 0 {
+		return nil, &PolicyError{Gadget: name, Violations: violations}
+	}
+	return policies, nil
+}
+
+// NewPolicyCommand returns the 'policy' command for checking gadgets against policy files
+func NewPolicyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Check gadgets against the policy that limits what they may run",
+	}
+
+	checkCmd := &cobra.Command{
+		Use:          "check [gadget]",
+		Short:        "Explain which policy rules block a gadget (or every gadget)",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			policies, err := loadPolicies()
+			if err != nil {
+				return err
+			}
+			if len(policies) == 0 {
+				colorText.Cyan("No policy files found, so every gadget is allowed. Looked in:")
+				for _, path := range policyPaths() {
+					colorText.Cyan("  " + path)
+				}
+				return nil
+			}
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			names := make([]string, 0, len(scripts))
+			if len(args) == 1 {
+				if _, ok := scripts[args[0]]; !ok {
+					return fmt.Errorf("gadget '%s' not found", args[0])
+				}
+				names = append(names, args[0])
+			} else {
+				for name := range scripts {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+			}
+
+			blocked := 0
+			for _, name := range names {
+				violations := gadgetPolicyViolations(name, scripts[name], scripts, policies)
+				if len(violations) == 0 {
+					successText(fmt.Sprintf("✅ %s: allowed", name))
+					continue
+				}
+				blocked++
+				errorText(fmt.Sprintf("⛔ %s: blocked", name))
+				for _, v := range violations {
+					detail := v.String()
+					if v.Gadget != name {
+						detail = fmt.Sprintf("in '%s': %s", v.Gadget, detail)
+					}
+					warnText("   • " + detail)
+				}
+			}
+			if blocked > 0 {
+				return &ExitCodeError{Code: 1}
+			}
+			return nil
+		},
+	}
+
+	showCmd := &cobra.Command{
+		Use:          "show",
+		Short:        "Show where policy files are looked for and which are in use",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, path := range policyPaths() {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					colorText.Cyan(fmt.Sprintf("%s (not found)", path))
+					continue
+				}
+				colorText.Green(path)
+				fmt.Println(strings.TrimSpace(string(data)))
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(checkCmd, showCmd)
+	return cmd
+}
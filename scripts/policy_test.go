@@ -0,0 +1,75 @@
+package scripts
+
+import (
+	"reflect"
+	"testing"
+)
+
+// policyRules returns the rule broken by each violation
+func policyRules(violations []policyViolation) []string {
+	var rules []string
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestCheckCommandPolicy(t *testing.T) {
+	allow := Policy{AllowCommands: []string{"Get-*", "Write-Output"}}
+	deny := Policy{DenyCommands: []string{"Remove-Item", "Stop-Computer"}}
+	raw := Policy{ForbidRawVariables: true}
+
+	tests := []struct {
+		name    string
+		command string
+		policy  Policy
+		want    []string
+	}{
+		{"allowed commands", "Get-ChildItem | Write-Output", allow, nil},
+		{"allowed alias", "ls; echo done", allow, nil},
+		{"not allowed", "Get-Item x; Stop-Computer", allow, []string{RuleAllowCommands}},
+		{"allowed literal after &", "& 'Get-Item' x", allow, nil},
+		{"allowed script block", "& { Get-Date }", allow, nil},
+		{"command in a subexpression", `Write-Output "now $(Stop-Computer)"`, allow, []string{RuleAllowCommands}},
+		{"command from a variable", "& {{cmd}}", allow, []string{RuleAllowCommands}},
+		{"command in a PowerShell variable", "& $cmd", allow, []string{RuleAllowCommands}},
+		{"expanding string", `& "Stop-$what"`, allow, []string{RuleAllowCommands}},
+
+		// Ways around an allow-list: each must be refused
+		{"computed with &", "& ('Stop-'+'Computer')", allow, []string{RuleAllowCommands}},
+		{"computed without a space", `&('Remove-Item') C:\x -Recurse`, allow, []string{RuleAllowCommands}},
+		{"computed dot-source", `.("Stop-Computer")`, allow, []string{RuleAllowCommands}},
+		{"dot-sourced variable", ". $script", allow, []string{RuleAllowCommands}},
+		{"dot-sourced script", `. .\setup.ps1`, allow, []string{RuleAllowCommands}},
+		{".NET static method", `[System.IO.Directory]::Delete('C:\x', $true)`, allow, []string{RuleAllowCommands}},
+		{".NET after an allowed command", "Get-ChildItem; [Diagnostics.Process]::Start('calc')", allow, []string{RuleAllowCommands}},
+		{".NET type from a variable", "$t::Start('calc')", allow, []string{RuleAllowCommands}},
+
+		{"denied", "Get-Item x; Remove-Item x", deny, []string{RuleDenyCommands}},
+		{"denied alias", "rm -r x", deny, []string{RuleDenyCommands}},
+		{"denied full path", `C:\Windows\System32\shutdown.exe /s`, Policy{DenyCommands: []string{"shutdown"}}, []string{RuleDenyCommands}},
+		{"deny list alone allows the rest", "Get-Item x; [IO.File]::ReadAllText('x')", deny, nil},
+
+		{"quoted variable", "Get-Item '{{path}}'", raw, nil},
+		{"raw variable", "Get-Item {{path}}", raw, []string{RuleForbidRawVariables}},
+		{"numeric built-in", "exit {{GOGO_EXIT_CODE}}", raw, nil},
+		{"changed files are quoted already", "Invoke-ScriptAnalyzer {{GOGO_CHANGED_FILES}}", raw, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := checkCommandPolicy("g", tt.command, tt.policy)
+			if got := policyRules(violations); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%q broke %v, want %v; violations: %v", tt.command, got, tt.want, violations)
+			}
+		})
+	}
+}
+
+func TestComputedCallKeepsArguments(t *testing.T) {
+	// The argument after an expression is not a command of its own
+	calls := parseCommandCalls(`&('Remove-Item') C:\x -Recurse`)
+	want := []commandCall{{Name: "& (...)", Args: []string{`C:\x`, "-Recurse"}, Computed: true}}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got %+v, want %+v", calls, want)
+	}
+}
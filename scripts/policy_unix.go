@@ -0,0 +1,8 @@
+//go:build !windows
+
+package scripts
+
+// machinePolicyPath returns the administrator's policy file
+func machinePolicyPath() string {
+	return "/etc/gogogadget/policy.json"
+}
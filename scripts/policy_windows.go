@@ -0,0 +1,20 @@
+//go:build windows
+
+package scripts
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// machinePolicyPath returns the administrator's policy file. The ProgramData
+// folder is asked of Windows rather than read from %ProgramData%, which any
+// user can point somewhere else.
+func machinePolicyPath() string {
+	programData, err := windows.KnownFolderPath(windows.FOLDERID_ProgramData, 0)
+	if err != nil {
+		programData = `C:\ProgramData`
+	}
+	return filepath.Join(programData, "GoGoGadget", "policy.json")
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package scripts
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess starts cmd in a new session so it outlives the terminal that started it
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// processAlive reports whether a process with the given PID exists
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// terminateProcess asks a process to stop; GoGoGadget passes SIGTERM on to its gadget
+func terminateProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
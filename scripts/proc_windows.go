@@ -0,0 +1,44 @@
+//go:build windows
+
+package scripts
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+const (
+	detachedProcess                = 0x00000008
+	createNewProcessGroup          = 0x00000200
+	processQueryLimitedInformation = 0x1000
+	stillActive                    = 259
+)
+
+// detachProcess starts cmd without a console so it outlives the terminal that started it
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: detachedProcess | createNewProcessGroup,
+		HideWindow:    true,
+	}
+}
+
+// processAlive reports whether a process with the given PID is still running
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
+
+// terminateProcess stops a process and everything it started. Detached processes
+// can't be sent Ctrl+C, so this goes straight to taskkill.
+func terminateProcess(pid int) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
+}
@@ -0,0 +1,832 @@
+package scripts
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// repoGadgetDir is the folder in a gadget repository holding one file per gadget
+const repoGadgetDir = "gadgets"
+
+// repoGadgetExt is the extension of the gadget files in a repository
+const repoGadgetExt = gogo.DirStoreExt
+
+// Sides of a merge, for --keep and the conflict prompt
+const (
+	KeepMine   = "mine"
+	KeepTheirs = "theirs"
+)
+
+// libraryRepo returns the git working copy the library is kept in, or "" when
+// the library is a single file
+func libraryRepo() string {
+	return loadSettings().Repo
+}
+
+// defaultRepoDir is where 'repo init' and 'repo clone' put the working copy
+func defaultRepoDir() string {
+	return filepath.Join(getConfigDir(), "repo")
+}
+
+// repoGadgetName returns the gadget a repository path belongs to
+func repoGadgetName(path string) (string, bool) {
+	dir, file := filepath.Split(filepath.ToSlash(path))
+	if dir != repoGadgetDir+"/" || !strings.HasSuffix(file, repoGadgetExt) {
+		return "", false
+	}
+	name := strings.TrimSuffix(file, repoGadgetExt)
+	return name, gogo.ValidName(name)
+}
+
+// repoStore returns the store for the gadget files in a working copy
+func repoStore(dir string) gogo.DirStore {
+	return gogo.DirStore{Dir: filepath.Join(dir, repoGadgetDir)}
+}
+
+// git runs a git command in dir and returns its output without the final newline
+func git(dir string, args ...string) (string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", fmt.Errorf("git isn't installed or isn't on your PATH")
+	}
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		sub := args[0]
+		for i := 0; i+2 < len(args) && args[i] == "-c"; i += 2 {
+			sub = args[i+2]
+		}
+		return "", fmt.Errorf("git %s: %s", sub, msg)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// gitAsUser runs a git command that records who made a change, naming
+// GoGoGadget when git doesn't know who the user is
+func gitAsUser(dir string, args ...string) (string, error) {
+	var identity []string
+	if name, _ := git(dir, "config", "user.name"); name == "" {
+		identity = append(identity, "-c", "user.name=GoGoGadget")
+	}
+	if email, _ := git(dir, "config", "user.email"); email == "" {
+		identity = append(identity, "-c", "user.email=gogogadget@localhost")
+	}
+	return git(dir, append(identity, args...)...)
+}
+
+// gitCommit commits what's staged
+func gitCommit(dir, message string) error {
+	_, err := gitAsUser(dir, "commit", "-q", "-m", message)
+	return err
+}
+
+// repoChanges lists the gadgets changed in the working copy since the last
+// commit, as "added", "changed" or "deleted"
+func repoChanges(dir string) (map[string]string, error) {
+	out, err := git(dir, "status", "--porcelain", "--untracked-files=all", "--", repoGadgetDir)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		code, path := line[:2], line[3:]
+		name, ok := repoGadgetName(path)
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.ContainsAny(code, "?A"):
+			changes[name] = "added"
+		case strings.Contains(code, "D"):
+			changes[name] = "deleted"
+		default:
+			changes[name] = "changed"
+		}
+	}
+	return changes, nil
+}
+
+// commitRepoChanges commits the gadgets changed in the working copy and
+// returns how many there were
+func commitRepoChanges(dir, message string) (int, error) {
+	changes, err := repoChanges(dir)
+	if err != nil || len(changes) == 0 {
+		return 0, err
+	}
+	if message == "" {
+		names := sortedKeys(changes)
+		message = "Update gadgets: " + strings.Join(names, ", ")
+		if len(names) > 5 {
+			message = fmt.Sprintf("Update %d gadgets", len(names))
+		}
+	}
+	if _, err := git(dir, "add", "-A", "--", repoGadgetDir); err != nil {
+		return 0, err
+	}
+	return len(changes), gitCommit(dir, message)
+}
+
+// repoUpstream returns the branch the working copy pulls from and pushes to
+func repoUpstream(dir string) (string, bool) {
+	upstream, err := git(dir, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
+	return upstream, err == nil && upstream != ""
+}
+
+// repoGadgetsAt reads the gadgets as they were in a commit
+func repoGadgetsAt(dir, rev string) (gogo.Library, error) {
+	scripts := gogo.Library{}
+	out, err := git(dir, "ls-tree", "-r", "--name-only", rev, "--", repoGadgetDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range strings.Split(out, "\n") {
+		name, ok := repoGadgetName(path)
+		if !ok {
+			continue
+		}
+		data, err := git(dir, "show", rev+":"+path)
+		if err != nil {
+			return nil, err
+		}
+		config, err := gogo.DecodeGadget([]byte(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		scripts[name] = config
+	}
+	return scripts, nil
+}
+
+// gadgetConflict is a gadget changed differently here and in the repository
+type gadgetConflict struct {
+	Name string
+	// Fields changed differently on each side; empty when one side deleted the gadget
+	Fields             []string
+	Base, Mine, Theirs *gogo.Gadget // nil when the gadget doesn't exist on that side
+}
+
+// gadgetFields splits a gadget into its fields, for merging field by field
+func gadgetFields(config *gogo.Gadget) map[string]json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	if config == nil {
+		return fields
+	}
+	c := *config
+	c.Dangerous = false
+	data, _ := json.Marshal(c)
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+// mergeGadgetFields merges two edits of a gadget field by field. Fields changed
+// differently on both sides are returned as conflicts, or taken from keep's
+// side when keep is set. The signature is kept only if the result matches one
+// side exactly.
+func mergeGadgetFields(base, mine, theirs *gogo.Gadget, keep string) (gogo.Gadget, []string) {
+	b, m, t := gadgetFields(base), gadgetFields(mine), gadgetFields(theirs)
+	keys := map[string]bool{}
+	for _, fields := range []map[string]json.RawMessage{b, m, t} {
+		for k := range fields {
+			keys[k] = true
+		}
+	}
+	merged := map[string]json.RawMessage{}
+	var conflicts []string
+	for k := range keys {
+		if k == "signature" {
+			continue
+		}
+		bv, mv, tv := string(b[k]), string(m[k]), string(t[k])
+		var v string
+		switch {
+		case mv == tv, tv == bv:
+			v = mv
+		case mv == bv:
+			v = tv
+		case keep == KeepMine:
+			v = mv
+		case keep == KeepTheirs:
+			v = tv
+		default:
+			conflicts = append(conflicts, k)
+			continue
+		}
+		if v != "" {
+			merged[k] = json.RawMessage(v)
+		}
+	}
+	sort.Strings(conflicts)
+	data, _ := json.Marshal(merged)
+	var config gogo.Gadget
+	_ = json.Unmarshal(data, &config)
+	switch text := gogo.GadgetText(config); {
+	case mine != nil && text == gogo.GadgetText(withoutSignature(*mine)):
+		config.Signature = mine.Signature
+	case theirs != nil && text == gogo.GadgetText(withoutSignature(*theirs)):
+		config.Signature = theirs.Signature
+	}
+	return config, conflicts
+}
+
+// withoutSignature returns config with its signature removed
+func withoutSignature(config gogo.Gadget) gogo.Gadget {
+	config.Signature = nil
+	return config
+}
+
+// mergeGadgets does a three-way merge of the gadgets in base, mine and theirs.
+// A gadget changed on one side only takes that change; one changed on both
+// sides is merged field by field.
+func mergeGadgets(base, mine, theirs gogo.Library) (gogo.Library, []gadgetConflict) {
+	names := map[string]bool{}
+	for _, scripts := range []gogo.Library{base, mine, theirs} {
+		for name := range scripts {
+			names[name] = true
+		}
+	}
+	lookup := func(scripts gogo.Library, name string) *gogo.Gadget {
+		if config, ok := scripts[name]; ok {
+			return &config
+		}
+		return nil
+	}
+	text := func(config *gogo.Gadget) string {
+		if config == nil {
+			return ""
+		}
+		return gogo.GadgetText(*config)
+	}
+	merged := gogo.Library{}
+	var conflicts []gadgetConflict
+	for _, name := range sortedKeysOf(names) {
+		b, m, t := lookup(base, name), lookup(mine, name), lookup(theirs, name)
+		bt, mt, tt := text(b), text(m), text(t)
+		switch {
+		case mt == tt, tt == bt:
+			if m != nil {
+				merged[name] = *m
+			}
+		case mt == bt:
+			if t != nil {
+				merged[name] = *t
+			}
+		case m != nil && t != nil:
+			config, fields := mergeGadgetFields(b, m, t, "")
+			if len(fields) == 0 {
+				merged[name] = config
+				continue
+			}
+			conflicts = append(conflicts, gadgetConflict{Name: name, Fields: fields, Base: b, Mine: m, Theirs: t})
+		default:
+			conflicts = append(conflicts, gadgetConflict{Name: name, Base: b, Mine: m, Theirs: t})
+		}
+	}
+	return merged, conflicts
+}
+
+// sortedKeysOf returns the keys of a set in sorted order
+func sortedKeysOf(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// resolve settles a conflict by keeping one side; false means the gadget is deleted
+func (c gadgetConflict) resolve(keep string) (gogo.Gadget, bool) {
+	if len(c.Fields) > 0 {
+		config, _ := mergeGadgetFields(c.Base, c.Mine, c.Theirs, keep)
+		return config, true
+	}
+	side := c.Mine
+	if keep == KeepTheirs {
+		side = c.Theirs
+	}
+	if side == nil {
+		return gogo.Gadget{}, false
+	}
+	return *side, true
+}
+
+// printConflict describes a conflict in terms of the gadget's fields
+func printConflict(c gadgetConflict) {
+	switch {
+	case c.Mine == nil:
+		warnText(fmt.Sprintf("⚠️ You deleted '%s', but it was changed in the repository.", c.Name))
+		return
+	case c.Theirs == nil:
+		warnText(fmt.Sprintf("⚠️ You changed '%s', but it was deleted in the repository.", c.Name))
+		return
+	case c.Base == nil:
+		warnText(fmt.Sprintf("⚠️ '%s' was added here and in the repository, differently:", c.Name))
+	default:
+		warnText(fmt.Sprintf("⚠️ '%s' was changed here and in the repository:", c.Name))
+	}
+	mine, theirs := gadgetFields(c.Mine), gadgetFields(c.Theirs)
+	for _, field := range c.Fields {
+		fmt.Printf("   %s\n", field)
+		fmt.Printf("     mine:   %s\n", conflictValue(mine[field]))
+		fmt.Printf("     theirs: %s\n", conflictValue(theirs[field]))
+	}
+}
+
+// conflictValue shows a field's value the way it was typed, indenting
+// multi-line commands under the label
+func conflictValue(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return "(not set)"
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		if s == "" {
+			return `""`
+		}
+		return strings.ReplaceAll(s, "\n", "\n             ")
+	}
+	return string(raw)
+}
+
+// printGadgetChanges lists which gadgets differ between before and after
+func printGadgetChanges(before, after gogo.Library) int {
+	names := map[string]bool{}
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+	count := 0
+	for _, name := range sortedKeysOf(names) {
+		b, inBefore := before[name]
+		a, inAfter := after[name]
+		switch {
+		case !inBefore:
+			colorText.Green(fmt.Sprintf("  + %s (new)", name))
+		case !inAfter:
+			errorText(fmt.Sprintf("  - %s (removed)", name))
+		case gogo.GadgetText(b) != gogo.GadgetText(a):
+			colorText.Yellow(fmt.Sprintf("  ~ %s (changed)", name))
+		default:
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// isLocalRemote reports whether a remote is a folder rather than a URL or an
+// scp-style host:path
+func isLocalRemote(remote string) bool {
+	if strings.Contains(remote, "://") {
+		return false
+	}
+	if len(remote) >= 2 && remote[1] == ':' { // a Windows drive letter
+		return true
+	}
+	colon := strings.Index(remote, ":")
+	return colon < 0 || strings.ContainsAny(remote[:colon], `/\`)
+}
+
+// requireRepo returns the library's working copy, or an error saying how to set one up
+func requireRepo() (string, error) {
+	dir := libraryRepo()
+	if dir == "" {
+		return "", fmt.Errorf("your gadgets aren't in a git repository yet; use 'GoGoGadget repo init' or 'GoGoGadget repo clone <path>'")
+	}
+	return dir, nil
+}
+
+// useRepo switches the library to the working copy in dir
+func useRepo(dir string) error {
+	settings := loadSettings()
+	settings.Repo = dir
+	return saveSettings(settings)
+}
+
+// pullRepo fetches the repository and merges its gadgets with the local ones.
+// keep settles conflicts without asking; otherwise they are asked about in a
+// terminal and reported (changing nothing) without one.
+func pullRepo(dir, keep string) error {
+	if n, err := commitRepoChanges(dir, ""); err != nil {
+		return err
+	} else if n > 0 {
+		infoText(fmt.Sprintf("Committed your changes to %d gadgets first.", n))
+	}
+	upstream, ok := repoUpstream(dir)
+	if !ok {
+		return fmt.Errorf("this repository has nothing to pull from; clone one with 'GoGoGadget repo clone <path>' or add a remote with git")
+	}
+	if _, err := git(dir, "fetch", "-q"); err != nil {
+		return err
+	}
+	head, err := git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	theirsRev, err := git(dir, "rev-parse", upstream)
+	if err != nil {
+		return err
+	}
+	baseRev, err := git(dir, "merge-base", head, theirsRev)
+	unrelated := err != nil
+	if theirsRev == baseRev {
+		successText("✅ Already up to date.")
+		return nil
+	}
+	mine, err := repoGadgetsAt(dir, head)
+	if err != nil {
+		return err
+	}
+	if head == baseRev {
+		if _, err := gitAsUser(dir, "merge", "-q", "--ff-only", upstream); err != nil {
+			return err
+		}
+		after, err := repoGadgetsAt(dir, "HEAD")
+		if err != nil {
+			return err
+		}
+		n := printGadgetChanges(mine, after)
+		successText(fmt.Sprintf("✅ Pulled %d changed gadgets from %s.", n, upstream))
+		return nil
+	}
+
+	base := gogo.Library{}
+	if !unrelated {
+		if base, err = repoGadgetsAt(dir, baseRev); err != nil {
+			return err
+		}
+	}
+	theirs, err := repoGadgetsAt(dir, theirsRev)
+	if err != nil {
+		return err
+	}
+	merged, conflicts := mergeGadgets(base, mine, theirs)
+	if len(conflicts) > 0 {
+		interactive := keep == "" && term.IsTerminal(int(os.Stdin.Fd()))
+		if keep == "" && !interactive {
+			for _, c := range conflicts {
+				printConflict(c)
+			}
+			errorText(fmt.Sprintf("❌ %d gadgets were changed both here and in the repository. Nothing was merged.", len(conflicts)))
+			infoText("   Pull again in a terminal to choose for each gadget, or use --keep mine or --keep theirs.")
+			return &ExitCodeError{Code: 1}
+		}
+		reader := bufio.NewReader(os.Stdin)
+		for _, c := range conflicts {
+			choice := keep
+			if interactive {
+				printConflict(c)
+				for choice == "" {
+					fmt.Print("Keep [m]ine or [t]heirs? (q to stop): ")
+					answer, _ := reader.ReadString('\n')
+					switch strings.ToLower(strings.TrimSpace(answer)) {
+					case "m", "mine":
+						choice = KeepMine
+					case "t", "theirs":
+						choice = KeepTheirs
+					case "q", "":
+						warnText("⚠️ Stopped. Nothing was merged.")
+						return &ExitCodeError{Code: 1}
+					}
+				}
+			}
+			if config, ok := c.resolve(choice); ok {
+				merged[c.Name] = config
+			}
+		}
+	}
+
+	mergeArgs := []string{"merge", "-q", "--no-ff", "--no-commit", upstream}
+	if unrelated {
+		mergeArgs = append(mergeArgs, "--allow-unrelated-histories")
+	}
+	_, mergeErr := gitAsUser(dir, mergeArgs...)
+	if _, err := git(dir, "rev-parse", "-q", "--verify", "MERGE_HEAD"); err != nil {
+		if mergeErr != nil {
+			return mergeErr
+		}
+		return fmt.Errorf("git merge didn't start a merge")
+	}
+	if err := repoStore(dir).Save(merged); err != nil {
+		return err
+	}
+	if _, err := git(dir, "add", "-A", "--", repoGadgetDir); err != nil {
+		return err
+	}
+	unmerged, err := git(dir, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return err
+	}
+	if unmerged != "" {
+		git(dir, "merge", "--abort")
+		return fmt.Errorf("files outside %s/ conflict and need to be merged with git:\n  %s", repoGadgetDir, strings.ReplaceAll(unmerged, "\n", "\n  "))
+	}
+	if err := gitCommit(dir, "Merge gadgets from "+upstream); err != nil {
+		return err
+	}
+	if n := printGadgetChanges(mine, merged); n > 0 {
+		successText(fmt.Sprintf("✅ Merged %d changed gadgets from %s.", n, upstream))
+	} else {
+		successText(fmt.Sprintf("✅ Merged with %s; your gadgets stayed the same.", upstream))
+	}
+	return nil
+}
+
+// pushRepo commits local changes and pushes them to the repository
+func pushRepo(dir, message string) error {
+	n, err := commitRepoChanges(dir, message)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		infoText(fmt.Sprintf("Committed your changes to %d gadgets.", n))
+	}
+	args := []string{"push", "-q"}
+	if _, ok := repoUpstream(dir); !ok {
+		remotes, err := git(dir, "remote")
+		if err != nil {
+			return err
+		}
+		if !containsString(strings.Fields(remotes), "origin") {
+			return fmt.Errorf("this repository has nowhere to push to; add a remote with 'GoGoGadget repo init --remote <path>' or git")
+		}
+		args = append(args, "-u", "origin", "HEAD")
+	}
+	if _, err := git(dir, args...); err != nil {
+		if strings.Contains(err.Error(), "rejected") {
+			return fmt.Errorf("the repository has changes you don't have yet; run 'GoGoGadget repo pull' first")
+		}
+		return err
+	}
+	successText("✅ Pushed your gadgets.")
+	return nil
+}
+
+// NewRepoCommand returns the 'repo' command for keeping gadgets in a git repository
+func NewRepoCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repo",
+		Short: "Keep your gadgets in a git repository and share them with a team",
+		Long: `Keep your gadgets in a git working copy, one YAML file per gadget, and sync
+them with a shared repository (a folder or any git remote).
+
+Pulling merges gadget by gadget: a gadget changed on one side takes that
+change, and one changed on both sides is merged field by field. When the same
+field was changed differently, you choose whose version to keep.`,
+	}
+
+	var remote string
+	initCmd := &cobra.Command{
+		Use:   "init [folder]",
+		Short: "Move your gadgets into a new git repository",
+		Long: `Move your gadgets into a new git repository (default: a 'repo' folder in the
+GoGoGadget config folder). With --remote the repository is pushed to a shared
+location; a folder that doesn't exist yet is created as a bare repository.`,
+		Example:      "  GoGoGadget repo init --remote \\\\fileserver\\it\\gadgets.git",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if dir := libraryRepo(); dir != "" {
+				return fmt.Errorf("your gadgets are already in the repository at %s", dir)
+			}
+			dir := defaultRepoDir()
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			dir, err := filepath.Abs(dir)
+			if err != nil {
+				return err
+			}
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			if _, err := git(dir, "init", "-q"); err != nil {
+				return err
+			}
+			if err := repoStore(dir).Save(scripts); err != nil {
+				return err
+			}
+			if _, err := commitRepoChanges(dir, fmt.Sprintf("Add %d gadgets", len(scripts))); err != nil {
+				return err
+			}
+			if remote != "" && isLocalRemote(remote) {
+				if remote, err = filepath.Abs(remote); err != nil {
+					return err
+				}
+				if _, err := os.Stat(remote); os.IsNotExist(err) {
+					if _, err := git(".", "init", "-q", "--bare", remote); err != nil {
+						return err
+					}
+				}
+			}
+			if remote != "" {
+				if _, err := git(dir, "remote", "add", "origin", remote); err != nil {
+					return err
+				}
+			}
+			if err := useRepo(dir); err != nil {
+				return err
+			}
+			successText(fmt.Sprintf("✅ Your %d gadgets are now in the git repository at %s", len(scripts), dir))
+			if remote != "" {
+				return pushRepo(dir, "")
+			}
+			return nil
+		},
+	}
+	initCmd.Flags().StringVar(&remote, "remote", "", "Shared repository to push to, e.g. a folder on a file share")
+
+	cloneCmd := &cobra.Command{
+		Use:   "clone <repository> [folder]",
+		Short: "Use a shared gadget repository as your library",
+		Long: `Clone a shared gadget repository and use it as your library. Your own gadgets
+are added to it (push them to share them); when the repository already has a
+gadget with the same name, the repository's version is used.`,
+		Example:      "  GoGoGadget repo clone \\\\fileserver\\it\\gadgets.git",
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if dir := libraryRepo(); dir != "" {
+				return fmt.Errorf("your gadgets are already in the repository at %s", dir)
+			}
+			dir := defaultRepoDir()
+			if len(args) > 1 {
+				dir = args[1]
+			}
+			dir, err := filepath.Abs(dir)
+			if err != nil {
+				return err
+			}
+			if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+				return fmt.Errorf("%s already exists and isn't empty", dir)
+			}
+			own, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			if _, err := git(".", "clone", "-q", args[0], dir); err != nil {
+				return err
+			}
+			scripts, err := repoStore(dir).Load()
+			if err != nil {
+				return err
+			}
+			shared := len(scripts)
+			added := 0
+			for _, name := range own.Names() {
+				config, exists := scripts[name]
+				if !exists {
+					scripts[name] = own[name]
+					added++
+				} else if gogo.GadgetText(config) != gogo.GadgetText(own[name]) {
+					warnText(fmt.Sprintf("⚠️ Using the repository's '%s'; your own version is still in %s.", name, filepath.Base(getUserScriptsPath())))
+				}
+			}
+			if err := repoStore(dir).Save(scripts); err != nil {
+				return err
+			}
+			if err := useRepo(dir); err != nil {
+				return err
+			}
+			successText(fmt.Sprintf("✅ Cloned %d gadgets into %s", shared, dir))
+			if added > 0 {
+				infoText(fmt.Sprintf("   Added %d of your own gadgets; run 'GoGoGadget repo push' to share them.", added))
+			}
+			return nil
+		},
+	}
+
+	var keep string
+	pullCmd := &cobra.Command{
+		Use:   "pull",
+		Short: "Get the latest gadgets from the repository",
+		Long: `Get the latest gadgets from the repository, merging them with yours. Your
+uncommitted changes are committed first. When a gadget was changed differently
+on both sides you're asked which version to keep, or --keep decides.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if keep != "" && keep != KeepMine && keep != KeepTheirs {
+				return fmt.Errorf("--keep must be %s or %s", KeepMine, KeepTheirs)
+			}
+			dir, err := requireRepo()
+			if err != nil {
+				return err
+			}
+			return pullRepo(dir, keep)
+		},
+	}
+	pullCmd.Flags().StringVar(&keep, "keep", "", "Settle conflicts without asking: mine or theirs")
+
+	var message string
+	pushCmd := &cobra.Command{
+		Use:          "push",
+		Short:        "Commit your gadget changes and share them",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := requireRepo()
+			if err != nil {
+				return err
+			}
+			return pushRepo(dir, message)
+		},
+	}
+	pushCmd.Flags().StringVarP(&message, "message", "m", "", "Commit message (default: the names of the changed gadgets)")
+
+	statusCmd := &cobra.Command{
+		Use:          "status",
+		Short:        "Show gadgets changed here and in the repository",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := requireRepo()
+			if err != nil {
+				return err
+			}
+			infoText(fmt.Sprintf("Gadget repository: %s", dir))
+			changes, err := repoChanges(dir)
+			if err != nil {
+				return err
+			}
+			if len(changes) == 0 {
+				fmt.Println("No local changes.")
+			} else {
+				fmt.Println("Changed here and not pushed yet:")
+				for _, name := range sortedKeys(changes) {
+					fmt.Printf("  %s (%s)\n", name, changes[name])
+				}
+			}
+			upstream, ok := repoUpstream(dir)
+			if !ok {
+				warnText("⚠️ Not connected to a shared repository.")
+				return nil
+			}
+			if _, err := git(dir, "fetch", "-q"); err != nil {
+				warnText(fmt.Sprintf("⚠️ Could not reach %s: %v", upstream, err))
+			}
+			counts, err := git(dir, "rev-list", "--left-right", "--count", "HEAD..."+upstream)
+			if err != nil {
+				return err
+			}
+			var ahead, behind int
+			fmt.Sscanf(counts, "%d %d", &ahead, &behind)
+			if ahead > 0 {
+				fmt.Printf("%d commits to push.\n", ahead)
+			}
+			if behind == 0 {
+				fmt.Printf("Up to date with %s.\n", upstream)
+				return nil
+			}
+			out, err := git(dir, "diff", "--name-status", "HEAD..."+upstream, "--", repoGadgetDir)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Changed in %s (run 'GoGoGadget repo pull'):\n", upstream)
+			for _, line := range strings.Split(out, "\n") {
+				status, path, ok := strings.Cut(line, "\t")
+				name, isGadget := repoGadgetName(path)
+				if !ok || !isGadget {
+					continue
+				}
+				what := "changed"
+				switch status {
+				case "A":
+					what = "added"
+				case "D":
+					what = "deleted"
+				}
+				fmt.Printf("  %s (%s)\n", name, what)
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(initCmd, cloneCmd, pullCmd, pushCmd, statusCmd)
+	return cmd
+}
@@ -0,0 +1,447 @@
+package scripts
+
+import (
+	"bufio"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/mattn/go-colorable"
+	"golang.org/x/term"
+)
+
+// commandCall is one command in a PowerShell line: its name and the words after it
+type commandCall struct {
+	Name string
+	Args []string
+	// Computed is set when the & or . operator runs something other than a
+	// plain name, e.g. & $cmd or & ('Stop-' + 'Computer'). Name is then the
+	// variable or string given, or e.g. "& (...)" for an expression.
+	Computed bool
+}
+
+// String returns the call roughly as written
+func (c commandCall) String() string {
+	return strings.TrimSpace(c.Name + " " + strings.Join(c.Args, " "))
+}
+
+// isLiteralName reports whether a word after & or . names a command outright:
+// a bare word or a quoted string that doesn't expand anything
+func isLiteralName(w psWord) bool {
+	switch {
+	case w.Type == chroma.LiteralStringSingle:
+		return true
+	case w.Type.InCategory(chroma.LiteralString):
+		return !strings.ContainsAny(w.Text, "$`")
+	}
+	return w.Type != chroma.NameVariable && commandNameRe.MatchString(w.Text)
+}
+
+// templateVariableRe matches {{variable}} placeholders in a gadget command
+var templateVariableRe = regexp.MustCompile(`\{\{([A-Za-z0-9_]+)\}\}`)
+
+// placeholderRe matches the words tokenizePowerShell puts in place of {{variable}}
+var placeholderRe = regexp.MustCompile(`gogovar_([A-Za-z0-9_]+?)_rav`)
+
+// psKeywords start statements without being commands themselves
+var psKeywords = map[string]bool{
+	"if": true, "elseif": true, "else": true, "foreach": true, "for": true, "while": true, "do": true,
+	"until": true, "switch": true, "return": true, "throw": true, "try": true, "catch": true,
+	"finally": true, "param": true, "begin": true, "process": true, "end": true, "trap": true,
+	"break": true, "continue": true, "exit": true,
+}
+
+// commandNameRe matches words that can name a command without the & call operator
+var commandNameRe = regexp.MustCompile(`^[A-Za-z_.\\/~][A-Za-z0-9_.\\/:~+-]*$`)
+
+// psWord is one word of a statement and the token type it starts with
+type psWord struct {
+	Text string
+	Type chroma.TokenType
+}
+
+// tokenizePowerShell runs the chroma PowerShell lexer, standing in a plain word
+// for each {{variable}} so its braces aren't read as a script block
+func tokenizePowerShell(command string) []chroma.Token {
+	command = templateVariableRe.ReplaceAllString(command, "gogovar_${1}_rav")
+	lexer := lexers.Get("powershell")
+	if lexer == nil {
+		return nil
+	}
+	iterator, err := lexer.Tokenise(nil, command)
+	if err != nil {
+		return nil
+	}
+	var tokens []chroma.Token
+	for token := iterator(); token.Type != chroma.EOF.Type; token = iterator() {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// parseCommandCalls splits a PowerShell command into the commands it runs, using
+// the same chroma tokenizer as 'analyze'. Statements are split on ; | & newlines
+// and brackets, so commands inside pipelines, script blocks and ( ) are found too.
+// Assignments, keywords and plain values like "text" or 5 are skipped.
+//
+// A call whose target is an expression, like & ('Stop-' + 'Computer'), is
+// marked Computed; the words after the expression are its arguments.
+func parseCommandCalls(command string) []commandCall {
+	var calls []commandCall
+	var words []psWord
+	var word strings.Builder
+	var wordType chroma.TokenType
+	callOperator := false
+	// depth counts open brackets. computed holds the expressions run by & or .
+	// that are still open, and argsOf the call that gets the words after the
+	// one just closed (-1 when there is none).
+	type openExpression struct{ depth, call int }
+	var computed []openExpression
+	depth, argsOf := 0, -1
+
+	endWord := func() {
+		if word.Len() > 0 {
+			words = append(words, psWord{Text: placeholderRe.ReplaceAllString(word.String(), "{{$1}}"), Type: wordType})
+			word.Reset()
+		}
+	}
+	// dotSource reports whether the statement so far is just the . operator
+	dotSource := func() bool {
+		endWord()
+		return len(words) == 1 && words[0].Text == "."
+	}
+	endStatement := func() {
+		endWord()
+		if argsOf >= 0 {
+			calls[argsOf].Args = append(calls[argsOf].Args, textOf(words)...)
+			words, argsOf = nil, -1
+		}
+		for len(words) > 0 && psKeywords[strings.ToLower(words[0].Text)] {
+			words = words[1:]
+		}
+		if len(words) > 1 && words[0].Text == "." {
+			words, callOperator = words[1:], true // . script.ps1 runs it like &
+		}
+		if len(words) > 0 {
+			first := words[0]
+			if first.Type == chroma.Keyword && strings.EqualFold(first.Text, "function") {
+				// A function definition, not a call
+			} else if callOperator || templateVariableRe.FindString(first.Text) == first.Text ||
+				(commandNameRe.MatchString(first.Text) && !first.Type.InCategory(chroma.Literal)) {
+				calls = append(calls, commandCall{
+					Name:     strings.Trim(first.Text, `"'`),
+					Args:     textOf(words[1:]),
+					Computed: callOperator && !isLiteralName(first) && templateVariableRe.FindString(first.Text) != first.Text,
+				})
+			}
+		}
+		words = nil
+		callOperator = false
+	}
+
+	for _, token := range tokenizePowerShell(command) {
+		switch {
+		case token.Type == chroma.Text || token.Type.InCategory(chroma.Comment):
+			endWord()
+			if strings.Contains(token.Value, "\n") {
+				endStatement()
+			}
+		case token.Type == chroma.Punctuation && token.Value == "&":
+			endStatement()
+			callOperator = true
+		case token.Type == chroma.Punctuation && token.Value == "(" && (callOperator || dotSource()):
+			operator := "&"
+			if !callOperator {
+				operator = "."
+			}
+			words, callOperator = nil, false
+			endStatement()
+			calls = append(calls, commandCall{Name: operator + " (...)", Computed: true})
+			computed = append(computed, openExpression{depth: depth, call: len(calls) - 1})
+			depth++
+		case token.Type == chroma.Punctuation && strings.ContainsAny(token.Value, ";|{}()"):
+			endStatement()
+			for _, c := range token.Value {
+				switch c {
+				case '(', '{':
+					depth++
+				case ')', '}':
+					depth--
+					if n := len(computed); n > 0 && computed[n-1].depth == depth {
+						argsOf, computed = computed[n-1].call, computed[:n-1]
+					}
+				}
+			}
+		case token.Type == chroma.Punctuation && token.Value == "=" && word.Len() == 0 &&
+			len(words) == 1 && strings.HasPrefix(words[0].Text, "$"):
+			words = nil // $x = ...: what follows is the statement
+		default:
+			if word.Len() == 0 {
+				wordType = token.Type
+			}
+			word.WriteString(strings.TrimSpace(token.Value))
+			if strings.TrimSpace(token.Value) != token.Value {
+				endWord() // Builtins like "iex " carry their trailing space
+			}
+		}
+	}
+	endStatement()
+	return calls
+}
+
+// staticMembers returns every use of a .NET static member in a command, like
+// [System.IO.File]::Delete or $type::Start. They run without any command, so
+// nothing in parseCommandCalls shows them.
+func staticMembers(command string) []string {
+	var members []string
+	var prev, pending string
+	for _, token := range tokenizePowerShell(command) {
+		text := strings.TrimSpace(token.Value)
+		if text == "" {
+			continue
+		}
+		switch {
+		case pending != "":
+			members = append(members, placeholderRe.ReplaceAllString(pending+text, "{{$1}}"))
+			pending = ""
+		case token.Type == chroma.Punctuation && text == "::":
+			pending = prev + "::"
+		}
+		prev = text
+	}
+	if pending != "" {
+		members = append(members, pending)
+	}
+	return members
+}
+
+// textOf returns the text of each word
+func textOf(words []psWord) []string {
+	texts := make([]string, len(words))
+	for i, w := range words {
+		texts[i] = w.Text
+	}
+	return texts
+}
+
+// commandBaseName normalizes a command name for matching: lowercase, without
+// its folder or a .exe/.cmd/.bat extension
+func commandBaseName(name string) string {
+	name = strings.ToLower(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	for _, ext := range []string{".exe", ".cmd", ".bat", ".com"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+// hasParameter reports whether args include the named PowerShell parameter,
+// allowing the abbreviations PowerShell accepts (e.g. -Rec for -Recurse)
+func hasParameter(args []string, param string) bool {
+	param = strings.ToLower(param)
+	for _, arg := range args {
+		arg = strings.ToLower(arg)
+		if i := strings.Index(arg, ":"); i > 0 {
+			arg = arg[:i] // -Force:$true
+		}
+		arg = "-" + strings.TrimLeft(arg, "-")
+		if len(arg) >= 3 && strings.HasPrefix(param, arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasShortFlag reports whether args include a Unix-style short flag, alone or
+// combined with one other (e.g. -r in -rf). Longer words are PowerShell parameters.
+func hasShortFlag(args []string, flag rune) bool {
+	for _, arg := range args {
+		if len(arg) > 1 && len(arg) <= 3 && arg[0] == '-' && arg[1] != '-' && strings.ContainsRune(strings.ToLower(arg[1:]), flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSwitch reports whether args include a cmd.exe-style switch like /s
+func hasSwitch(args []string, sw string) bool {
+	for _, arg := range args {
+		if strings.EqualFold(arg, sw) {
+			return true
+		}
+	}
+	return false
+}
+
+// dangerRule flags commands that can do serious, hard-to-undo damage
+type dangerRule struct {
+	// Commands holds lowercase command names and their aliases
+	Commands []string
+	// Match decides whether a call is dangerous; nil means always
+	Match  func(call commandCall) bool
+	Reason string
+}
+
+// dangerRules are checked against every command a gadget runs
+var dangerRules = []dangerRule{
+	{
+		Commands: []string{"remove-item", "ri", "rm", "del", "erase", "rd", "rmdir"},
+		Match: func(call commandCall) bool {
+			return hasParameter(call.Args, "-Recurse") || hasShortFlag(call.Args, 'r') || hasSwitch(call.Args, "/s")
+		},
+		Reason: "deletes folders and everything in them",
+	},
+	{
+		Commands: []string{"format-volume", "clear-disk", "initialize-disk", "remove-partition", "format", "diskpart"},
+		Reason:   "erases a disk or volume",
+	},
+	{
+		Commands: []string{"stop-computer", "restart-computer", "shutdown"},
+		Reason:   "shuts down or restarts the computer",
+	},
+	{
+		Commands: []string{"invoke-expression", "iex"},
+		Reason:   "runs text as code",
+	},
+	{
+		Commands: []string{"set-executionpolicy"},
+		Reason:   "changes which scripts PowerShell allows to run",
+	},
+}
+
+// downloadCommands fetch content from the internet
+var downloadCommands = []string{"invoke-webrequest", "iwr", "invoke-restmethod", "irm", "curl", "wget", "start-bitstransfer"}
+
+// dangerFinding explains why a gadget was flagged
+type dangerFinding struct {
+	Gadget  string
+	Command string
+	Reason  string
+}
+
+// analyzeDanger returns the dangerous commands in one PowerShell command line
+func analyzeDanger(command string) []dangerFinding {
+	calls := parseCommandCalls(command)
+	downloads := false
+	for _, call := range calls {
+		if containsString(downloadCommands, commandBaseName(call.Name)) {
+			downloads = true
+		}
+	}
+
+	var findings []dangerFinding
+	for _, call := range calls {
+		name := commandBaseName(call.Name)
+		for _, rule := range dangerRules {
+			if !containsString(rule.Commands, name) || (rule.Match != nil && !rule.Match(call)) {
+				continue
+			}
+			reason := rule.Reason
+			if downloads && (name == "invoke-expression" || name == "iex") {
+				reason = "downloads code from the internet and runs it"
+			}
+			findings = append(findings, dangerFinding{Command: call.String(), Reason: reason})
+			break
+		}
+	}
+	return findings
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// gadgetDangers returns the dangerous commands a gadget runs, including its
+// hooks and, for workflows, the gadgets of every step
+func gadgetDangers(name string, config gogo.Gadget, scripts gogo.Library) []dangerFinding {
+	return collectGadgetDangers(name, config, scripts, map[string]bool{})
+}
+
+func collectGadgetDangers(name string, config gogo.Gadget, scripts gogo.Library, visiting map[string]bool) []dangerFinding {
+	if visiting[name] {
+		return nil
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	var findings []dangerFinding
+	for _, command := range []string{config.Before, config.Command, config.After} {
+		for _, f := range analyzeDanger(command) {
+			f.Gadget = name
+			findings = append(findings, f)
+		}
+	}
+	for _, step := range config.Steps {
+		if stepConfig, ok := scripts[step.Gadget]; ok {
+			findings = append(findings, collectGadgetDangers(step.Gadget, stepConfig, scripts, visiting)...)
+		}
+	}
+	return findings
+}
+
+// markDangerousGadgets updates the Dangerous flag of every gadget
+func markDangerousGadgets(scripts gogo.Library) {
+	for name, config := range scripts {
+		config.Dangerous = len(gadgetDangers(name, config, scripts)) > 0
+		scripts[name] = config
+	}
+}
+
+// printDangers lists why a gadget was flagged, naming the step gadget when it isn't name
+func printDangers(name string, findings []dangerFinding) {
+	for _, f := range findings {
+		msg := fmt.Sprintf("   • %s: %s", f.Command, f.Reason)
+		if f.Gadget != name {
+			msg += fmt.Sprintf(" (in '%s')", f.Gadget)
+		}
+		warnText(msg)
+	}
+}
+
+// warnIfDangerous tells the user a gadget they just saved will need confirmation to run
+func warnIfDangerous(name string) {
+	scripts, err := loadScripts()
+	if err != nil {
+		return
+	}
+	config, ok := scripts[name]
+	if !ok {
+		return
+	}
+	if findings := gadgetDangers(name, config, scripts); len(findings) > 0 {
+		warnText(fmt.Sprintf("⚠️ '%s' is marked dangerous because it:", name))
+		printDangers(name, findings)
+		warnText("   You'll be asked to confirm each time it runs (or pass --yes).")
+	}
+}
+
+// confirmDangerous asks the user to type the gadget's name before a dangerous
+// gadget runs. yes skips the question; without a terminal --yes is required.
+func confirmDangerous(name string, config gogo.Gadget, scripts gogo.Library, yes bool) error {
+	findings := gadgetDangers(name, config, scripts)
+	if (len(findings) == 0 && !config.Dangerous) || yes {
+		return nil
+	}
+	warnText(fmt.Sprintf("⚠️ '%s' is marked dangerous because it:", name))
+	printDangers(name, findings)
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("'%s' is marked dangerous; pass --yes to run it without a terminal", name)
+	}
+	fmt.Fprintf(colorable.NewColorableStdout(), "\x1b[33mType '%s' to run it: \x1b[0m", name)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != name {
+		warnText("⚠️ Cancelled.")
+		return &ExitCodeError{Code: 1}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package scripts
+
+import (
+	"gogo/gogo"
+	"reflect"
+	"testing"
+)
+
+// dangerReasons returns the reason of each finding
+func dangerReasons(findings []dangerFinding) []string {
+	var reasons []string
+	for _, f := range findings {
+		reasons = append(reasons, f.Reason)
+	}
+	return reasons
+}
+
+func TestAnalyzeDanger(t *testing.T) {
+	const (
+		deletes  = "deletes folders and everything in them"
+		erases   = "erases a disk or volume"
+		shutdown = "shuts down or restarts the computer"
+		runsText = "runs text as code"
+		download = "downloads code from the internet and runs it"
+	)
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{`Remove-Item C:\temp -Recurse -Force`, []string{deletes}},
+		{`Remove-Item -Path C:\temp -r`, []string{deletes}},
+		{"rm -rf ./build", []string{deletes}},
+		{`rd /s /q C:\temp`, []string{deletes}},
+		{`C:\Windows\System32\shutdown.exe /r /t 0`, []string{shutdown}},
+		{"Format-Volume -DriveLetter D", []string{erases}},
+		{"Get-Disk 1 | Clear-Disk -RemoveData", []string{erases}},
+		{"Stop-Computer -Force", []string{shutdown}},
+		{"Invoke-Expression $code", []string{runsText}},
+		{"iwr https://example.com/install.ps1 | iex", []string{download}},
+		{"iex (irm https://example.com/install.ps1)", []string{download}},
+		{"Get-ChildItem; Write-Output (Remove-Item x -Recurse)", []string{deletes}},
+
+		// Nothing to flag
+		{"Remove-Item notes.txt", nil},
+		{"Get-ChildItem -Recurse", nil},
+		{"Write-Output 'Remove-Item C:\\ -Recurse'", nil},
+		{"# Stop-Computer", nil},
+		{"Invoke-WebRequest https://example.com -OutFile page.html", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := dangerReasons(analyzeDanger(tt.command)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("analyzeDanger(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestGadgetDangers(t *testing.T) {
+	lib := gogo.Library{
+		"clean":  {Command: "Remove-Item ./build -Recurse"},
+		"report": {Command: "Get-ChildItem", After: "Stop-Computer"},
+		"safe":   {Command: "Write-Output hi"},
+		"nightly": {
+			Type:  gogo.TypeWorkflow,
+			Steps: []gogo.WorkflowStep{{Gadget: "safe"}, {Gadget: "clean"}, {Gadget: "missing"}},
+		},
+		"loop": {Type: gogo.TypeWorkflow, Steps: []gogo.WorkflowStep{{Gadget: "loop"}, {Gadget: "report"}}},
+	}
+	tests := []struct {
+		gadget string
+		want   []string // the gadgets the findings come from
+	}{
+		{"clean", []string{"clean"}},
+		{"report", []string{"report"}},
+		{"safe", nil},
+		{"nightly", []string{"clean"}},
+		{"loop", []string{"report"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, f := range gadgetDangers(tt.gadget, lib[tt.gadget], lib) {
+			got = append(got, f.Gadget)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("gadgetDangers(%q) came from %v, want %v", tt.gadget, got, tt.want)
+		}
+	}
+
+	markDangerousGadgets(lib)
+	for name, want := range map[string]bool{"clean": true, "safe": false, "nightly": true} {
+		if lib[name].Dangerous != want {
+			t.Errorf("%s: Dangerous = %v, want %v", name, lib[name].Dangerous, want)
+		}
+	}
+}
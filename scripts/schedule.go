@@ -0,0 +1,500 @@
+package scripts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-colorable"
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/cobra"
+)
+
+// Catch-up policies decide what the daemon does about runs it missed
+// (because it wasn't running, or the computer was asleep)
+const (
+	// CatchUpSkip drops missed runs and waits for the next one
+	CatchUpSkip = "skip"
+	// CatchUpOnce runs a single time for any number of missed runs
+	CatchUpOnce = "once"
+	// CatchUpAll runs once for every missed run, up to maxCatchUpRuns
+	CatchUpAll = "all"
+)
+
+const (
+	// scheduleTolerance is how late a run may start and still count as on time
+	scheduleTolerance = time.Minute
+	// maxCatchUpRuns caps how many missed runs the "all" policy replays
+	maxCatchUpRuns = 100
+	// schedulerTick is how often the daemon checks for due entries
+	schedulerTick = 15 * time.Second
+)
+
+// ScheduleEntry runs a gadget on a cron schedule with fixed variable values
+type ScheduleEntry struct {
+	ID        string            `json:"id"`
+	Gadget    string            `json:"gadget"`
+	Cron      string            `json:"cron"`
+	Variables map[string]string `json:"variables,omitempty"`
+	CatchUp   string            `json:"catchUp"`
+	Created   time.Time         `json:"created"`
+}
+
+// Clock tells the scheduler the time, so tests and simulations can supply their own
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the real wall clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// getSchedulePath returns the path of the schedule entries, edited by 'schedule'
+func getSchedulePath() string {
+	return filepath.Join(getConfigDir(), "schedule.json")
+}
+
+// getScheduleStatePath returns the path where the daemon records each entry's
+// last run, kept apart from schedule.json so edits and the daemon don't collide
+func getScheduleStatePath() string {
+	return filepath.Join(getConfigDir(), "schedule_state.json")
+}
+
+// loadSchedule reads all schedule entries
+func loadSchedule() ([]ScheduleEntry, error) {
+	data, err := os.ReadFile(getSchedulePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []ScheduleEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("schedule.json is unreadable: %w", err)
+	}
+	return entries, nil
+}
+
+// saveSchedule writes all schedule entries
+func saveSchedule(entries []ScheduleEntry) error {
+	return writeFileAtomic(getSchedulePath(), entries)
+}
+
+// parseCron parses a standard five-field cron expression or a descriptor like @daily
+func parseCron(expr string) (cron.Schedule, error) {
+	sched, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression '%s': %w", expr, err)
+	}
+	return sched, nil
+}
+
+// dueTimes returns the newest limit times sched was due after last and up to
+// now. After a long outage with a frequent schedule there could be a great many,
+// so it looks back from now in growing windows instead of walking every due
+// time since last.
+func dueTimes(sched cron.Schedule, last, now time.Time, limit int) []time.Time {
+	span := now.Sub(last)
+	for window := time.Hour; ; window *= 2 {
+		from := last
+		if window > 0 && window < span { // window turns negative if doubling overflows
+			from = now.Add(-window)
+		}
+		var due []time.Time
+		for t := sched.Next(from); !t.After(now); t = sched.Next(t) {
+			due = append(due, t)
+			if len(due) > limit {
+				due = due[1:]
+			}
+		}
+		if len(due) >= limit || from.Equal(last) {
+			return due
+		}
+	}
+}
+
+// runsToStart applies an entry's catch-up policy to its due times and returns
+// the due times that should actually run
+func runsToStart(policy string, due []time.Time, now time.Time) []time.Time {
+	var onTime, missed []time.Time
+	for _, t := range due {
+		if now.Sub(t) <= scheduleTolerance {
+			onTime = append(onTime, t)
+		} else {
+			missed = append(missed, t)
+		}
+	}
+	switch policy {
+	case CatchUpAll:
+		if len(missed) > maxCatchUpRuns {
+			missed = missed[len(missed)-maxCatchUpRuns:]
+		}
+	case CatchUpOnce:
+		if len(missed) > 0 && len(onTime) == 0 {
+			missed = missed[len(missed)-1:]
+		} else {
+			missed = nil
+		}
+	default:
+		missed = nil
+	}
+	return append(missed, onTime...)
+}
+
+// scheduledRunFunc runs one due schedule entry and returns how it went
+type scheduledRunFunc func(ctx context.Context, entry ScheduleEntry, due time.Time) HistoryEntry
+
+// scheduler decides which entries are due and runs them. The clock and runner
+// are swappable so the timing logic can be exercised without waiting.
+type scheduler struct {
+	clock Clock
+	run   scheduledRunFunc
+	// lastRun holds the due time each entry last handled
+	lastRun map[string]time.Time
+	mu      sync.Mutex
+}
+
+func newScheduler(clock Clock, run scheduledRunFunc) *scheduler {
+	return &scheduler{clock: clock, run: run, lastRun: map[string]time.Time{}}
+}
+
+// tick runs every entry that is due at the clock's current time and returns
+// the results, in the order they ran
+func (s *scheduler) tick(ctx context.Context, entries []ScheduleEntry) []HistoryEntry {
+	now := s.clock.Now()
+	var results []HistoryEntry
+	for _, entry := range entries {
+		sched, err := parseCron(entry.Cron)
+		if err != nil {
+			continue // Rejected when the entry was added; skip if edited by hand
+		}
+		s.mu.Lock()
+		last, ok := s.lastRun[entry.ID]
+		s.mu.Unlock()
+		if !ok {
+			last = entry.Created
+		}
+
+		// One more than the catch-up cap, for a run that is also due on time
+		due := dueTimes(sched, last, now, maxCatchUpRuns+1)
+		if len(due) == 0 {
+			continue
+		}
+		for _, t := range runsToStart(entry.CatchUp, due, now) {
+			if ctx.Err() != nil {
+				return results
+			}
+			results = append(results, s.run(ctx, entry, t))
+		}
+		// Everything up to the latest due time is handled, however long the outage
+		s.mu.Lock()
+		s.lastRun[entry.ID] = due[len(due)-1]
+		s.mu.Unlock()
+	}
+	return results
+}
+
+// loop ticks until ctx is cancelled, reloading entries each time so changes
+// made with 'schedule add/remove' are picked up without a restart
+func (s *scheduler) loop(ctx context.Context, load func() ([]ScheduleEntry, error), afterTick func()) error {
+	for {
+		entries, err := load()
+		if err != nil {
+			return err
+		}
+		s.tick(ctx, entries)
+		if afterTick != nil {
+			afterTick()
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.clock.After(schedulerTick):
+		}
+	}
+}
+
+// loadScheduleState reads the daemon's record of when each entry last ran
+func loadScheduleState() map[string]time.Time {
+	state := map[string]time.Time{}
+	if data, err := os.ReadFile(getScheduleStatePath()); err == nil {
+		_ = json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+// runScheduledEntry runs a schedule entry through the normal executor, with its
+// output prefixed by the entry ID, and records the result in the run history
+func runScheduledEntry(ctx context.Context, entry ScheduleEntry, due time.Time) HistoryEntry {
+	start := time.Now()
+	out := colorable.NewColorableStdout()
+	var outMu sync.Mutex
+	prefix := fmt.Sprintf("\x1b[1;35m[%s]\x1b[0m ", entry.ID)
+	stdout := newPrefixWriter(out, prefix, &outMu)
+	stderr := newPrefixWriter(colorable.NewColorableStderr(), prefix, &outMu)
+	fmt.Fprintf(out, "%s\x1b[36m▶ Running '%s' (due %s)\x1b[0m\n", prefix, entry.Gadget, due.Format("2006-01-02 15:04"))
+
+	err := func() error {
+		scripts, err := loadScripts()
+		if err != nil {
+			return err
+		}
+		config, ok := scripts[entry.Gadget]
+		if !ok {
+			return fmt.Errorf("gadget '%s' not found", entry.Gadget)
+		}
+		for _, v := range gogo.VariableNames(entry.Gadget, config, scripts) {
+			if _, ok := entry.Variables[v]; !ok {
+				return fmt.Errorf("no value for variable '%s'; scheduled runs can't prompt", v)
+			}
+		}
+		return runGadgetWithHooks(ctx, entry.Gadget, config, scripts, entry.Variables, gogo.Runner{Stdout: stdout, Stderr: stderr, Prompt: noPrompt})
+	}()
+	stdout.Flush()
+	stderr.Flush()
+
+	result := newHistoryEntry(RunSourceSchedulePrefix+entry.ID, entry.Gadget, entry.Variables, start, err)
+	if herr := appendHistory(result); herr != nil {
+		warnText(fmt.Sprintf("⚠️ Could not record run history: %v", herr))
+	}
+	if err != nil {
+		errorText(fmt.Sprintf("%s❌ %v", prefix, err))
+	} else {
+		successText(fmt.Sprintf("%s✅ Finished in %s", prefix, time.Since(start).Round(time.Millisecond)))
+	}
+	return result
+}
+
+// parseVarAssignments turns NAME=VALUE flags into a variable map
+func parseVarAssignments(assignments []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, kv := range assignments {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("variables must look like NAME=VALUE, got '%s'", kv)
+		}
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// NewScheduleCommand returns the 'schedule' command for recurring gadget runs
+func NewScheduleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schedule",
+		Short: "Run gadgets on a recurring schedule",
+		Long: `Schedule gadgets to run at set times using cron expressions. Scheduled gadgets
+are run by 'GoGoGadget daemon', which needs to be running in the background.
+
+Cron expressions have five fields: minute hour day-of-month month day-of-week.
+Shortcuts like @hourly, @daily and @weekly work too.
+
+Examples:
+  GoGoGadget schedule add cleanup --cron "0 3 * * *" --var folder=C:\Temp
+  GoGoGadget schedule add backup --cron @daily --catch-up once
+  GoGoGadget schedule list
+  GoGoGadget schedule remove backup-1`,
+	}
+
+	var cronExpr, id, catchUp string
+	var varFlags []string
+	var yes bool
+	addCmd := &cobra.Command{
+		Use:          "add [gadget]",
+		Short:        "Schedule a gadget",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			gadget := args[0]
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			config, ok := scripts[gadget]
+			if !ok {
+				return fmt.Errorf("gadget '%s' not found", gadget)
+			}
+			if _, err := parseCron(cronExpr); err != nil {
+				return err
+			}
+			// Scheduled runs can't ask, so dangerous gadgets are confirmed once here
+			if err := confirmDangerous(gadget, config, scripts, yes); err != nil {
+				return err
+			}
+			switch catchUp {
+			case CatchUpSkip, CatchUpOnce, CatchUpAll:
+			default:
+				return fmt.Errorf("--catch-up must be %s, %s or %s", CatchUpSkip, CatchUpOnce, CatchUpAll)
+			}
+			vars, err := parseVarAssignments(varFlags)
+			if err != nil {
+				return err
+			}
+			for _, v := range gogo.VariableNames(gadget, config, scripts) {
+				if _, ok := vars[v]; !ok {
+					return fmt.Errorf("scheduled runs can't ask for values; set variable '%s' with --var %s=VALUE", v, v)
+				}
+			}
+
+			entries, err := loadSchedule()
+			if err != nil {
+				return err
+			}
+			if id == "" {
+				id = nextScheduleID(gadget, entries)
+			}
+			for _, e := range entries {
+				if e.ID == id {
+					return fmt.Errorf("a schedule entry named '%s' already exists", id)
+				}
+			}
+			entries = append(entries, ScheduleEntry{
+				ID:        id,
+				Gadget:    gadget,
+				Cron:      cronExpr,
+				Variables: vars,
+				CatchUp:   catchUp,
+				Created:   time.Now(),
+			})
+			if err := saveSchedule(entries); err != nil {
+				return err
+			}
+			colorText.Green(fmt.Sprintf("✅ Scheduled '%s' as %s. Make sure 'GoGoGadget daemon' is running.", gadget, id))
+			return nil
+		},
+	}
+	addCmd.Flags().StringVar(&cronExpr, "cron", "", "When to run, as a cron expression (e.g. \"*/15 * * * *\" or @daily)")
+	addCmd.Flags().StringVar(&id, "id", "", "Name for this schedule entry (default: gadget-N)")
+	addCmd.Flags().StringArrayVar(&varFlags, "var", nil, "Variable value as NAME=VALUE (repeatable)")
+	addCmd.Flags().StringVar(&catchUp, "catch-up", CatchUpSkip, "What to do about runs missed while the daemon wasn't running: skip, once or all")
+	addCmd.Flags().BoolVar(&yes, "yes", false, "Schedule without asking, even if the gadget is marked dangerous")
+	_ = addCmd.MarkFlagRequired("cron")
+
+	listCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List scheduled gadgets and when they run next",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := loadSchedule()
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				colorText.Cyan("Nothing scheduled. Add an entry with 'GoGoGadget schedule add'.")
+				return nil
+			}
+			state := loadScheduleState()
+			out := colorable.NewColorableStdout()
+			fmt.Fprintf(out, "\x1b[36m%-20s  %-20s  %-16s  %-8s  %-16s  %s\x1b[0m\n", "ID", "Gadget", "Cron", "Catch-up", "Next run", "Variables")
+			for _, e := range entries {
+				next := "-"
+				if sched, err := parseCron(e.Cron); err == nil {
+					next = sched.Next(time.Now()).Format("2006-01-02 15:04")
+				}
+				var vars []string
+				for _, k := range sortedKeys(e.Variables) {
+					vars = append(vars, k+"="+e.Variables[k])
+				}
+				line := fmt.Sprintf("%-20s  \x1b[1;35m%-20s\x1b[0m  %-16s  %-8s  %-16s  %s", e.ID, e.Gadget, e.Cron, e.CatchUp, next, strings.Join(vars, " "))
+				if last, ok := state[e.ID]; ok {
+					line += fmt.Sprintf(" \x1b[90m(last due %s)\x1b[0m", last.Format("2006-01-02 15:04"))
+				}
+				fmt.Fprintln(out, line)
+			}
+			return nil
+		},
+	}
+
+	removeCmd := &cobra.Command{
+		Use:          "remove [id]",
+		Short:        "Remove a schedule entry",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := loadSchedule()
+			if err != nil {
+				return err
+			}
+			kept := entries[:0]
+			for _, e := range entries {
+				if e.ID != args[0] {
+					kept = append(kept, e)
+				}
+			}
+			if len(kept) == len(entries) {
+				return fmt.Errorf("schedule entry '%s' not found", args[0])
+			}
+			if err := saveSchedule(kept); err != nil {
+				return err
+			}
+			colorText.Green("✅ Schedule entry removed.")
+			return nil
+		},
+	}
+
+	cmd.AddCommand(addCmd, listCmd, removeCmd)
+	return cmd
+}
+
+// nextScheduleID returns the first free ID of the form gadget-N
+func nextScheduleID(gadget string, entries []ScheduleEntry) string {
+	taken := map[string]bool{}
+	for _, e := range entries {
+		taken[e.ID] = true
+	}
+	for n := 1; ; n++ {
+		id := fmt.Sprintf("%s-%d", gadget, n)
+		if !taken[id] {
+			return id
+		}
+	}
+}
+
+// NewDaemonCommand returns the 'daemon' command that runs scheduled gadgets
+func NewDaemonCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "daemon",
+		Short: "Run scheduled gadgets (stays in the foreground until stopped)",
+		Long: `Run scheduled gadgets when they are due. The daemon stays in the foreground;
+start it from a terminal you keep open, Task Scheduler at logon, or a service
+manager. Stop it with Ctrl+C.
+
+Runs missed while the daemon wasn't running are handled by each entry's
+catch-up policy. Every run is recorded in 'GoGoGadget history'.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s := newScheduler(systemClock{}, runScheduledEntry)
+			for id, t := range loadScheduleState() {
+				s.lastRun[id] = t
+			}
+			saveState := func() {
+				s.mu.Lock()
+				state := make(map[string]time.Time, len(s.lastRun))
+				for id, t := range s.lastRun {
+					state[id] = t
+				}
+				s.mu.Unlock()
+				if err := writeFileAtomic(getScheduleStatePath(), state); err != nil {
+					warnText(fmt.Sprintf("⚠️ Could not save schedule state: %v", err))
+				}
+			}
+
+			entries, err := loadSchedule()
+			if err != nil {
+				return err
+			}
+			colorText.Cyan(fmt.Sprintf("🕒 GoGoGadget daemon started with %d schedule entries. Press Ctrl+C to stop.", len(entries)))
+			return s.loop(cmd.Context(), loadSchedule, saveState)
+		},
+	}
+}
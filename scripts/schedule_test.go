@@ -0,0 +1,130 @@
+package scripts
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock the test moves by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time                         { return c.now }
+func (c *fakeClock) After(d time.Duration) <-chan time.Time { return make(chan time.Time) }
+
+// recordingScheduler returns a scheduler on clock that records the due time of
+// every run instead of running anything
+func recordingScheduler(clock Clock) (*scheduler, *[]time.Time) {
+	var ran []time.Time
+	s := newScheduler(clock, func(ctx context.Context, entry ScheduleEntry, due time.Time) HistoryEntry {
+		ran = append(ran, due)
+		return HistoryEntry{}
+	})
+	return s, &ran
+}
+
+func TestSchedulerCatchUpAfterOutage(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Ten days later, half a minute past a minute: hourly entries missed their
+	// latest due time too, while every-minute entries have one due on time
+	back := start.Add(10*24*time.Hour + 30*time.Minute + 30*time.Second)
+
+	tests := []struct {
+		policy string
+		// cron is hourly unless set
+		cron string
+		// wantFirst is how many runs the first tick after the outage starts,
+		// and wantLatest whether the latest of them is the newest due time
+		wantFirst  int
+		wantLatest bool
+	}{
+		{policy: CatchUpSkip, wantFirst: 0},
+		{policy: CatchUpOnce, wantFirst: 1, wantLatest: true},
+		{policy: CatchUpAll, wantFirst: maxCatchUpRuns, wantLatest: true},
+		// Every minute for ten days is far more due times than the cap; the
+		// on-time run comes on top of the missed ones
+		{policy: CatchUpSkip, cron: "* * * * *", wantFirst: 1, wantLatest: true},
+		{policy: CatchUpOnce, cron: "* * * * *", wantFirst: 1, wantLatest: true},
+		{policy: CatchUpAll, cron: "* * * * *", wantFirst: maxCatchUpRuns + 1, wantLatest: true},
+	}
+	for _, tt := range tests {
+		cronExpr := tt.cron
+		if cronExpr == "" {
+			cronExpr = "0 * * * *"
+		}
+		t.Run(tt.policy+" "+cronExpr, func(t *testing.T) {
+			clock := &fakeClock{now: back}
+			s, ran := recordingScheduler(clock)
+			entries := []ScheduleEntry{{ID: "e", Cron: cronExpr, CatchUp: tt.policy, Created: start}}
+			sched, _ := parseCron(cronExpr)
+			latest := sched.Next(back.Add(-time.Hour))
+			for next := sched.Next(latest); !next.After(back); next = sched.Next(next) {
+				latest = next
+			}
+
+			s.tick(context.Background(), entries)
+			if len(*ran) != tt.wantFirst {
+				t.Fatalf("first tick ran %d times, want %d", len(*ran), tt.wantFirst)
+			}
+			if tt.wantLatest && !(*ran)[len(*ran)-1].Equal(latest) {
+				t.Errorf("first tick ran up to %s, want the latest due time %s", (*ran)[len(*ran)-1], latest)
+			}
+			if !s.lastRun["e"].Equal(latest) {
+				t.Errorf("last run recorded as %s, want %s", s.lastRun["e"], latest)
+			}
+
+			// The backlog is handled: the next tick has nothing to do
+			*ran = nil
+			clock.now = clock.now.Add(schedulerTick)
+			s.tick(context.Background(), entries)
+			if len(*ran) != 0 {
+				t.Errorf("the tick after catching up ran %d more times", len(*ran))
+			}
+
+			// The next due time runs on time, whatever the policy
+			*ran = nil
+			clock.now = sched.Next(clock.now).Add(schedulerTick)
+			s.tick(context.Background(), entries)
+			if len(*ran) != 1 {
+				t.Errorf("the next on-time tick ran %d times, want 1", len(*ran))
+			}
+		})
+	}
+}
+
+func TestSchedulerOnTimeRunNotDoubledByCatchUp(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, policy := range []string{CatchUpSkip, CatchUpOnce} {
+		// Back just after a due time: it runs on time, and the missed ones
+		// before it don't add another run
+		clock := &fakeClock{now: start.Add(48*time.Hour + 10*time.Second)}
+		s, ran := recordingScheduler(clock)
+		entries := []ScheduleEntry{{ID: "e", Cron: "0 * * * *", CatchUp: policy, Created: start}}
+		s.tick(context.Background(), entries)
+		if len(*ran) != 1 || !(*ran)[0].Equal(start.Add(48*time.Hour)) {
+			t.Errorf("%s: ran %v, want only the on-time run", policy, *ran)
+		}
+	}
+}
+
+func TestDueTimesKeepsNewest(t *testing.T) {
+	sched, _ := parseCron("* * * * *")
+	last := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := last.Add(365 * 24 * time.Hour)
+	due := dueTimes(sched, last, now, 5)
+	if len(due) != 5 {
+		t.Fatalf("got %d due times, want 5", len(due))
+	}
+	for i, d := range due {
+		if want := now.Add(time.Duration(i-4) * time.Minute); !d.Equal(want) {
+			t.Errorf("due[%d] = %s, want %s", i, d, want)
+		}
+	}
+
+	// Fewer due times than the limit are all returned
+	if due := dueTimes(sched, now.Add(-3*time.Minute), now, 5); len(due) != 3 {
+		t.Errorf("got %d due times after three minutes, want 3", len(due))
+	}
+}
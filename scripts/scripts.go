@@ -1,21 +1,19 @@
 package scripts
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"gogo/gogo"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
+	"sort"
+	"time"
 
 	"github.com/mattn/go-colorable"
 	"github.com/spf13/cobra"
 )
 
-const (
-	DefaultDesc = "Value for %s"
-)
-
 // Text styling helpers
 var (
 	errorText   = func(msg string) { fmt.Fprintln(colorable.NewColorableStdout(), "\x1b[31m"+msg+"\x1b[0m") }
@@ -24,16 +22,8 @@ var (
 	warnText    = func(msg string) { fmt.Fprintln(colorable.NewColorableStdout(), "\x1b[33m"+msg+"\x1b[0m") }
 )
 
-type ScriptConfig struct {
-	Description string            `json:"description"`
-	Command     string            `json:"command"`
-	Variables   map[string]string `json:"variables"`
-}
-
-type Scripts map[string]ScriptConfig
-
-// getUserScriptsPath returns the user-writable path for user_scripts.json
-func getUserScriptsPath() string {
+// getConfigDir returns the user-writable GoGoGadget config directory, creating it if needed
+func getConfigDir() string {
 	dir, err := os.UserConfigDir()
 	if err != nil {
 		// fallback to home dir
@@ -41,113 +31,121 @@ func getUserScriptsPath() string {
 	}
 	dir = filepath.Join(dir, "GoGoGadget")
 	_ = os.MkdirAll(dir, 0755)
-	return filepath.Join(dir, "user_scripts.json")
+	return dir
 }
 
-// loadScripts loads all scripts from the user_scripts.json file in user config dir
-func loadScripts() (Scripts, error) {
-	scriptsPath := getUserScriptsPath()
-	if _, err := os.Stat(scriptsPath); os.IsNotExist(err) {
-		emptyScripts := make(Scripts)
-		data, _ := json.MarshalIndent(emptyScripts, "", "  ")
-		os.WriteFile(scriptsPath, data, 0644)
-		return emptyScripts, nil
-	}
-	data, err := os.ReadFile(scriptsPath)
-	if err != nil {
-		return nil, err
+// getUserScriptsPath returns the path of the gadget library: user_scripts.yaml
+// or user_scripts.toml once the library has been switched to YAML or TOML,
+// otherwise user_scripts.json
+func getUserScriptsPath() string {
+	for _, format := range []string{gogo.FormatYAML, gogo.FormatTOML} {
+		path := filepath.Join(getConfigDir(), libraryFiles[format])
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
 	}
-	var scripts Scripts
-	err = json.Unmarshal(data, &scripts)
-	if err != nil {
-		return nil, err
+	return filepath.Join(getConfigDir(), libraryFiles[gogo.FormatJSON])
+}
+
+// libraryStore returns where the gadget library is kept: the file in the user
+// config dir, or the git working copy set up with 'GoGoGadget repo'
+func libraryStore() gogo.Store {
+	if dir := libraryRepo(); dir != "" {
+		return repoStore(dir)
 	}
-	return scripts, nil
+	return gogo.FileStore{Path: getUserScriptsPath()}
 }
 
-// saveScripts saves all scripts to the user_scripts.json file in user config dir
-func saveScripts(scripts Scripts) error {
-	data, err := json.MarshalIndent(scripts, "", "  ")
+// loadScripts loads all scripts from the gadget library
+func loadScripts() (gogo.Library, error) {
+	scripts, err := libraryStore().Load()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return os.WriteFile(getUserScriptsPath(), data, 0644)
+	markDangerousGadgets(scripts)
+	return scripts, nil
 }
 
-// getVariableDescription returns the description for a variable or a default
-func getVariableDescription(varName string, config ScriptConfig) string {
-	desc := config.Variables[varName]
-	if desc == "" {
-		desc = fmt.Sprintf(DefaultDesc, varName)
-	}
-	return desc
+// saveScripts saves all scripts to the gadget library
+func saveScripts(scripts gogo.Library) error {
+	markDangerousGadgets(scripts)
+	return libraryStore().Save(scripts)
 }
 
 // promptForVariable asks the user to input a value for a variable
-func promptForVariable(varName string, config ScriptConfig) string {
-	desc := getVariableDescription(varName, config)
+func promptForVariable(varName string, config gogo.Gadget) (string, error) {
+	desc := config.VariableDescription(varName)
 	infoText(fmt.Sprintf("Enter %s: ", desc))
 
 	var value string
 	fmt.Scanln(&value)
-	return value
+	return value, nil
 }
 
-// runPowerShellScript executes a PowerShell script with the given content
-func runPowerShellScript(scriptName, content string) error {
-	tmpFile, err := os.CreateTemp("", scriptName+"_*.ps1")
-	if err != nil {
-		return fmt.Errorf("error creating temp file: %w", err)
-	}
-	defer os.Remove(tmpFile.Name())
-
-	if _, err := tmpFile.WriteString(content); err != nil {
-		return fmt.Errorf("error writing script content: %w", err)
-	}
-	tmpFile.Close()
-
-	// Use pwsh if available, otherwise fall back to powershell
-	shellCmd := "pwsh"
-	if _, err := exec.LookPath(shellCmd); err != nil {
-		shellCmd = "powershell"
-	}
-
-	cmd := exec.Command(shellCmd, "-File", tmpFile.Name())
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	return cmd.Run()
+// noPrompt stands in for promptForVariable where nobody is there to answer:
+// the API, the MCP server, scheduled runs and background jobs
+func noPrompt(varName string, config gogo.Gadget) (string, error) {
+	return "", fmt.Errorf("no value for variable '%s'", varName)
 }
 
 // AddScriptCommands dynamically adds all script shortcuts as subcommands
 func AddScriptCommands(root *cobra.Command) {
 	scripts, err := loadScripts()
 	if err != nil {
-		errorText(fmt.Sprintf("❌ Error loading user_scripts.json: %v", err))
+		errorText(fmt.Sprintf("❌ Error loading your gadgets: %v", err))
 		return // No scripts yet
 	}
+	policies, _ := loadPolicies() // A broken policy is reported when a gadget runs
 
 	for name, config := range scripts {
-		varNames := extractVariables(config.Command)
+		varNames := gogo.VariableNames(name, config, scripts)
+		short := config.Description
+		if len(gadgetPolicyViolations(name, config, scripts, policies)) > 0 {
+			short += " (blocked by policy)"
+		}
 
 		scriptCmd := &cobra.Command{
 			Use:   name,
-			Short: config.Description,
+			Short: short,
 			Long: config.Description + `
 
 Example usage:
   GoGoGadget ` + name + ` value1 value2
   GoGoGadget ` + name + ` -VAR1 value1 -VAR2 value2
+
+List variables run the gadget once per value (or per combination):
+  GoGoGadget ` + name + ` --VAR1 a --VAR1 b
+  GoGoGadget ` + name + ` --VAR1 a,b,c --parallel 3
+  GoGoGadget ` + name + ` --VAR1 @values.txt
 `,
 			Args: cobra.ArbitraryArgs,
-			Run:  createScriptRunFunc(name, config),
+			RunE: createScriptRunFunc(name, config),
 		}
 
+		scriptCmd.Flags().Int("parallel", 1, "Maximum number of runs at once when variables have several values")
+		scriptCmd.Flags().Bool("yes", false, "Run without asking, even if the gadget is marked dangerous")
+		scriptCmd.Flags().Bool("background", false, "Run as a background job; see 'GoGoGadget jobs'")
+		scriptCmd.Flags().Duration("timeout", 0, "Stop the gadget after this long, e.g. 30s or 5m (overrides the gadget's own timeout)")
+		scriptCmd.Flags().StringArray("watch", nil, "Re-run the gadget when files matching this glob change, e.g. 'src/**/*.ps1' (repeatable)")
+		scriptCmd.Flags().Duration("debounce", 500*time.Millisecond, "With --watch, wait until files have stopped changing for this long")
+		scriptCmd.Flags().Bool("restart", false, "With --watch, stop a run that is still going when files change and start over")
+
 		// Add flags for each variable
 		for _, varName := range varNames {
-			desc := getVariableDescription(varName, config)
-			scriptCmd.Flags().String(varName, "", desc)
+			if scriptCmd.Flags().Lookup(varName) != nil {
+				continue // Built-in flag; the variable can still be given by position or prompt
+			}
+			desc := config.VariableDescription(varName)
+			if config.IsListVariable(varName) {
+				desc += " (list: repeat the flag, separate with commas, or use @file)"
+			}
+			if typ := config.VariableOptions[varName].Type; typ != "" {
+				desc += " (" + typ + ")"
+			}
+			if def, ok := config.VariableDefault(varName); ok {
+				desc += fmt.Sprintf(" (default %q)", def)
+			}
+			scriptCmd.Flags().StringArray(varName, nil, desc)
 		}
 
 		root.AddCommand(scriptCmd)
@@ -155,68 +153,124 @@ Example usage:
 }
 
 // createScriptRunFunc returns a function to run the script with variables
-func createScriptRunFunc(name string, config ScriptConfig) func(*cobra.Command, []string) {
-	return func(cmd *cobra.Command, args []string) {
-		vars := make(map[string]string)
+func createScriptRunFunc(name string, config gogo.Gadget) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
 
 		// Always get the latest variable list from the script definition
 		scripts, err := loadScripts()
 		if err != nil {
-			errorText(fmt.Sprintf("❌ Error loading user_scripts.json: %v", err))
-			return
+			errorText(fmt.Sprintf("❌ Error loading your gadgets: %v", err))
+			return nil
 		}
 		config, ok := scripts[name]
 		if !ok {
 			errorText(fmt.Sprintf("❌ Gadget '%s' not found.\n", name))
-			return
+			return nil
 		}
-		varNames := extractVariables(config.Command)
-
-		// First, try to match provided args to variables by order
-		for i, varName := range varNames {
-			val, _ := cmd.Flags().GetString(varName)
-			if val == "" && i < len(args) && args[i] != "" {
-				val = args[i]
+		policies, err := checkPolicy(name, config, scripts)
+		if err != nil {
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				return err
 			}
-			vars[varName] = val
+			errorText("⛔ " + err.Error())
+			infoText(fmt.Sprintf("Run 'GoGoGadget policy check %s' for details.", name))
+			return &ExitCodeError{Code: 1}
+		}
+		if warning := signatureWarning(name, config, policies); warning != "" {
+			warnText(warning)
+		}
+		for _, v := range config.BuiltinCollisions() {
+			warnText(fmt.Sprintf("⚠️ '%s' has its own variable {{%s}}, but GoGoGadget fills that one in itself now, so it isn't asked for. Rename the variable in the command to keep asking for it.", name, v))
+		}
+		yes, _ := cmd.Flags().GetBool("yes")
+		if err := confirmDangerous(name, config, scripts, yes); err != nil {
+			return err
 		}
+		varNames := gogo.VariableNames(name, config, scripts)
 
-		// Now prompt for any missing variables
-		for _, varName := range varNames {
-			if vars[varName] == "" {
-				vars[varName] = promptForVariable(varName, config)
+		values, err := collectVariableValues(cmd, args, varNames, config)
+		if err != nil {
+			return err
+		}
+		runs := gogo.Combinations(varNames, values)
+
+		opts := defaultRunner()
+		opts.Timeout, _ = cmd.Flags().GetDuration("timeout")
+		run := func(ctx context.Context, vars map[string]string, opts gogo.Runner) error {
+			start := time.Now()
+			err := runGadgetWithHooks(ctx, name, config, scripts, vars, opts)
+			recordRun(RunSourceCLI, name, vars, start, err)
+			return err
+		}
+
+		if background, _ := cmd.Flags().GetBool("background"); background {
+			return startBackgroundJobs(name, runs, opts.Timeout)
+		}
+
+		if patterns, _ := cmd.Flags().GetStringArray("watch"); len(patterns) > 0 {
+			if len(runs) > 1 {
+				return fmt.Errorf("--watch can't be combined with several variable values")
+			}
+			if err := watchPatternsValid(patterns); err != nil {
+				return err
 			}
+			debounce, _ := cmd.Flags().GetDuration("debounce")
+			restart, _ := cmd.Flags().GetBool("restart")
+			return runWatch(cmd.Context(), patterns, debounce, restart, func(ctx context.Context, changed []string) error {
+				watchOpts := opts
+				watchOpts.Builtins = map[string]string{ChangedFilesVariable: formatChangedFiles(changed)}
+				return run(ctx, runs[0], watchOpts)
+			})
 		}
 
-		// Replace variables in the command
-		psCommand := config.Command
-		for varName, value := range vars {
-			psCommand = strings.ReplaceAll(psCommand, "{{"+varName+"}}", value)
+		if len(runs) > 1 {
+			parallel, _ := cmd.Flags().GetInt("parallel")
+			return runFanOut(cmd.Context(), name, runs, labelVariables(varNames, values), parallel, opts, run)
 		}
 
 		// Create and run the script
-		scriptContent := fmt.Sprintf("# %s\n%s\n", config.Description, psCommand)
-		if err := runPowerShellScript(name, scriptContent); err != nil {
-			errorText("❌ Error running your gadget. Please check your command and variable values.")
-			errorText(fmt.Sprintf("Details: %v", err))
-			_ = cmd.Help()
-		} else {
-			successText("✅ Gadget finished! If you expected output, check above.")
+		if err := run(cmd.Context(), runs[0], opts); err != nil {
+			code := gogo.ExitCode(err)
+			switch code {
+			case gogo.ExitInterrupted:
+				warnText("⚠️ Gadget interrupted.")
+			case gogo.ExitTimeout:
+				errorText(fmt.Sprintf("❌ Your gadget was stopped: %v", err))
+			default:
+				errorText("❌ Error running your gadget. Please check your command and variable values.")
+				errorText(fmt.Sprintf("Details: %v", err))
+				_ = cmd.Help()
+			}
+			return &ExitCodeError{Code: code}
 		}
+		successText("✅ Gadget finished! If you expected output, check above.")
+		return nil
+	}
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
+	return keys
 }
 
 // createVariablesListFunc returns a function to list variables for a gadget
-func createVariablesListFunc(name string, config ScriptConfig) func(*cobra.Command, []string) {
+func createVariablesListFunc(name string, config gogo.Gadget) func(*cobra.Command, []string) {
 	return func(cmd *cobra.Command, args []string) {
-		varNames := extractVariables(config.Command)
+		varNames := gogo.ExtractVariables(config.Command)
 		if len(varNames) == 0 {
 			warnText("This gadget has no variables.")
 			return
 		}
 		infoText(fmt.Sprintf("Variables for '%s':", name))
 		for _, varName := range varNames {
-			desc := getVariableDescription(varName, config)
+			desc := config.VariableDescription(varName)
 			successText(fmt.Sprintf("  %s: %s", varName, desc))
 		}
 	}
@@ -0,0 +1,582 @@
+package scripts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gogo/gogo"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultServeAddr is where 'GoGoGadget serve' listens unless --addr is given
+const defaultServeAddr = "127.0.0.1:8765"
+
+// apiExitCodeTrailer carries the exit code at the end of a plain-text run
+const apiExitCodeTrailer = "X-GoGoGadget-Exit-Code"
+
+// maxAPIBody limits the size of request bodies
+const maxAPIBody = 1 << 20
+
+// getAPITokenPath returns the file holding the token clients must send
+func getAPITokenPath() string {
+	return filepath.Join(getConfigDir(), "api_token")
+}
+
+// loadAPIToken reads the API token from path, creating a random one readable
+// only by the current user if the file doesn't exist yet
+func loadAPIToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file '%s' is empty", path)
+		}
+		return token, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// apiGadget is a gadget as sent and received by the HTTP API
+type apiGadget struct {
+	Name string `json:"name"`
+	gogo.Gadget
+}
+
+// apiRunRequest is the body of a run request; every field is optional
+type apiRunRequest struct {
+	Variables map[string]string `json:"variables"`
+	// Confirm must be true to run a gadget marked dangerous
+	Confirm bool `json:"confirm"`
+	// Timeout overrides the gadget's own timeout, e.g. "30s" or "5m"
+	Timeout string `json:"timeout"`
+}
+
+// apiRunResult is sent as the final event of a streamed run
+type apiRunResult struct {
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+}
+
+// apiError is the body of every error response
+type apiError struct {
+	Error string `json:"error"`
+	// Dangers lists why a gadget needs "confirm": true
+	Dangers []string `json:"dangers,omitempty"`
+}
+
+// apiServer serves the gadget library over HTTP. It uses the same store and
+// runner as the CLI, so changes made through it show up in 'GoGoGadget list'.
+type apiServer struct {
+	token string
+	// mu serializes changes to the library so concurrent requests don't lose edits
+	mu sync.Mutex
+}
+
+// newAPIHandler returns the HTTP API, requiring token on every request
+func newAPIHandler(token string) http.Handler {
+	s := &apiServer{token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/gadgets", s.listGadgets)
+	mux.HandleFunc("POST /api/gadgets", s.createGadget)
+	mux.HandleFunc("GET /api/gadgets/{name}", s.getGadget)
+	mux.HandleFunc("PUT /api/gadgets/{name}", s.updateGadget)
+	mux.HandleFunc("DELETE /api/gadgets/{name}", s.deleteGadget)
+	mux.HandleFunc("POST /api/gadgets/{name}/run", s.runGadget)
+	return s.requireToken(mux)
+}
+
+// requireToken rejects requests without the token, given as a bearer token or,
+// for clients like EventSource that can't set headers, a token query parameter
+func (s *apiServer) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			var bearer bool
+			if token, bearer = strings.CutPrefix(auth, "Bearer "); !bearer {
+				token = ""
+			}
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, "missing or wrong token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON sends v as an indented JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, apiError{Error: fmt.Sprintf(format, args...)})
+}
+
+// decodeAPIBody reads a JSON body into v, rejecting unknown fields. An empty
+// body leaves v untouched when allowEmpty is set.
+func decodeAPIBody(w http.ResponseWriter, r *http.Request, v interface{}, allowEmpty bool) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == io.EOF && allowEmpty {
+		return true
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid request body: %v", err)
+		return false
+	}
+	return true
+}
+
+// loadAPIScripts loads the library, reporting failures to the client
+func loadAPIScripts(w http.ResponseWriter) (gogo.Library, bool) {
+	scripts, err := loadScripts()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "error loading your gadgets: %v", err)
+		return nil, false
+	}
+	return scripts, true
+}
+
+func (s *apiServer) listGadgets(w http.ResponseWriter, r *http.Request) {
+	scripts, ok := loadAPIScripts(w)
+	if !ok {
+		return
+	}
+	gadgets := []apiGadget{}
+	for _, name := range scripts.Names() {
+		gadgets = append(gadgets, apiGadget{Name: name, Gadget: scripts[name]})
+	}
+	writeJSON(w, http.StatusOK, gadgets)
+}
+
+func (s *apiServer) getGadget(w http.ResponseWriter, r *http.Request) {
+	scripts, ok := loadAPIScripts(w)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	config, found := scripts[name]
+	if !found {
+		writeAPIError(w, http.StatusNotFound, "gadget '%s' not found", name)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiGadget{Name: name, Gadget: config})
+}
+
+func (s *apiServer) createGadget(w http.ResponseWriter, r *http.Request) {
+	var g apiGadget
+	if !decodeAPIBody(w, r, &g, false) {
+		return
+	}
+	s.saveGadget(w, g.Name, g.Gadget, true)
+}
+
+func (s *apiServer) updateGadget(w http.ResponseWriter, r *http.Request) {
+	var g apiGadget
+	if !decodeAPIBody(w, r, &g, false) {
+		return
+	}
+	name := r.PathValue("name")
+	if g.Name != "" && g.Name != name {
+		writeAPIError(w, http.StatusBadRequest, "the name in the body ('%s') doesn't match the URL ('%s')", g.Name, name)
+		return
+	}
+	s.saveGadget(w, name, g.Gadget, false)
+}
+
+// saveGadget checks and stores a gadget sent by a client. create decides
+// whether the gadget must be new or must already exist.
+func (s *apiServer) saveGadget(w http.ResponseWriter, name string, config gogo.Gadget, create bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scripts, ok := loadAPIScripts(w)
+	if !ok {
+		return
+	}
+	_, exists := scripts[name]
+	switch {
+	case create && exists:
+		writeAPIError(w, http.StatusConflict, "gadget '%s' already exists", name)
+		return
+	case !create && !exists:
+		writeAPIError(w, http.StatusNotFound, "gadget '%s' not found", name)
+		return
+	}
+	if err := checkAPIGadget(name, &config, scripts); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	scripts[name] = config
+	if err := saveScripts(scripts); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "error saving gadget: %v", err)
+		return
+	}
+	status := http.StatusOK
+	if create {
+		status = http.StatusCreated
+		w.Header().Set("Location", "/api/gadgets/"+name)
+	}
+	writeJSON(w, status, apiGadget{Name: name, Gadget: scripts[name]})
+}
+
+// checkAPIGadget applies the checks 'GoGoGadget add' makes to a gadget sent by
+// a client, filling in what the CLI would: the workflow type and an entry for
+// each variable. Dangerous is worked out when the gadget is saved.
+func checkAPIGadget(name string, config *gogo.Gadget, scripts gogo.Library) error {
+	if !gogo.ValidName(name) {
+		return fmt.Errorf("invalid gadget name '%s': use only letters, numbers, dashes, or underscores", name)
+	}
+	switch {
+	case config.Command != "" && len(config.Steps) > 0:
+		return fmt.Errorf("a gadget has either a command or workflow steps, not both")
+	case len(config.Steps) > 0:
+		config.Type = gogo.TypeWorkflow
+		if err := gogo.ValidateWorkflow(name, *config, scripts); err != nil {
+			return err
+		}
+	case config.Command == "":
+		return fmt.Errorf("a gadget needs a command or workflow steps")
+	default:
+		config.Type = ""
+	}
+	if config.Timeout != "" {
+		if _, err := gogo.ParseTimeout(config.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+	for varName, opt := range config.VariableOptions {
+		switch opt.Type {
+		case "", gogo.VariableTypeInt, gogo.VariableTypeNumber, gogo.VariableTypeBool:
+		default:
+			return fmt.Errorf("variable '%s' has unknown type '%s' (use int, number or bool)", varName, opt.Type)
+		}
+	}
+	if config.Variables == nil {
+		config.Variables = map[string]string{}
+	}
+	for _, v := range gogo.VariableNames(name, *config, scripts) {
+		if _, ok := config.Variables[v]; !ok {
+			config.Variables[v] = ""
+		}
+	}
+	config.Dangerous = false
+	return nil
+}
+
+func (s *apiServer) deleteGadget(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scripts, ok := loadAPIScripts(w)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	if _, found := scripts[name]; !found {
+		writeAPIError(w, http.StatusNotFound, "gadget '%s' not found", name)
+		return
+	}
+	delete(scripts, name)
+	if err := saveScripts(scripts); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "error deleting gadget: %v", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runGadget runs a gadget and streams its output. Clients asking for
+// text/event-stream get server-sent events: "stdout" and "stderr" events with
+// one line each, then an "exit" event holding an apiRunResult. Everyone else
+// gets the output as chunked plain text with the exit code in a trailer.
+// Problems found before the run starts are reported as JSON errors.
+func (s *apiServer) runGadget(w http.ResponseWriter, r *http.Request) {
+	scripts, ok := loadAPIScripts(w)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	config, found := scripts[name]
+	if !found {
+		writeAPIError(w, http.StatusNotFound, "gadget '%s' not found", name)
+		return
+	}
+	var req apiRunRequest
+	if !decodeAPIBody(w, r, &req, true) {
+		return
+	}
+
+	if _, err := checkPolicy(name, config, scripts); err != nil {
+		var policyErr *PolicyError
+		if errors.As(err, &policyErr) {
+			writeAPIError(w, http.StatusForbidden, "%v", err)
+		} else {
+			writeAPIError(w, http.StatusInternalServerError, "%v", err)
+		}
+		return
+	}
+	if findings := gadgetDangers(name, config, scripts); (len(findings) > 0 || config.Dangerous) && !req.Confirm {
+		resp := apiError{Error: fmt.Sprintf("'%s' is marked dangerous; send \"confirm\": true to run it", name)}
+		for _, f := range findings {
+			reason := fmt.Sprintf("%s: %s", f.Command, f.Reason)
+			if f.Gadget != name {
+				reason += fmt.Sprintf(" (in '%s')", f.Gadget)
+			}
+			resp.Dangers = append(resp.Dangers, reason)
+		}
+		writeJSON(w, http.StatusForbidden, resp)
+		return
+	}
+	vars, err := apiRunVariables(name, config, scripts, req.Variables)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	var timeout time.Duration
+	if req.Timeout != "" {
+		if timeout, err = gogo.ParseTimeout(req.Timeout); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid timeout: %v", err)
+			return
+		}
+	}
+
+	stream := newAPIStream(w, strings.Contains(r.Header.Get("Accept"), "text/event-stream"))
+	infoText(fmt.Sprintf("▶ Running '%s' for %s", name, r.RemoteAddr))
+	start := time.Now()
+	err = runGadgetWithHooks(r.Context(), name, config, scripts, vars, gogo.Runner{
+		Stdout:  stream.writer("stdout"),
+		Stderr:  stream.writer("stderr"),
+		Timeout: timeout,
+		Prompt:  noPrompt,
+	})
+	recordRun(RunSourceAPI, name, vars, start, err)
+	stream.finish(err)
+}
+
+// apiRunVariables checks the variable values sent with a run. Missing values
+// fall back to the variable's default, as nothing can be asked for.
+func apiRunVariables(name string, config gogo.Gadget, scripts gogo.Library, given map[string]string) (map[string]string, error) {
+	varNames := gogo.VariableNames(name, config, scripts)
+	for v := range given {
+		if !containsString(varNames, v) {
+			return nil, fmt.Errorf("'%s' has no variable '%s'", name, v)
+		}
+	}
+	vars := map[string]string{}
+	for _, v := range varNames {
+		value, ok := given[v]
+		if !ok {
+			if value, ok = config.VariableDefault(v); !ok {
+				return nil, fmt.Errorf("no value for variable '%s'", v)
+			}
+		}
+		checked, err := gogo.CheckValue(v, value, config)
+		if err != nil {
+			return nil, err
+		}
+		vars[v] = checked
+	}
+	return vars, nil
+}
+
+// apiStream sends a run's output to the client as soon as it is written
+type apiStream struct {
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	sse bool
+	// mu keeps lines from stdout and stderr whole
+	mu      sync.Mutex
+	writers []*prefixWriter
+}
+
+func newAPIStream(w http.ResponseWriter, sse bool) *apiStream {
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Trailer", apiExitCodeTrailer)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	s := &apiStream{w: w, rc: http.NewResponseController(w), sse: sse}
+	_ = s.rc.Flush()
+	return s
+}
+
+// writer returns the writer for one output stream. Server-sent events get
+// whole lines; plain text is passed on as it comes.
+func (s *apiStream) writer(event string) io.Writer {
+	if !s.sse {
+		return apiFlushWriter{s}
+	}
+	pw := newPrefixWriter(apiEventWriter{s, event}, "", &s.mu)
+	s.writers = append(s.writers, pw)
+	return pw
+}
+
+// finish sends whatever output is left and the run's result
+func (s *apiStream) finish(err error) {
+	for _, pw := range s.writers {
+		pw.Flush()
+	}
+	result := apiRunResult{}
+	if err != nil {
+		result.ExitCode = gogo.ExitCode(err)
+		result.Error = err.Error()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sse {
+		data, _ := json.Marshal(result)
+		fmt.Fprintf(s.w, "event: exit\ndata: %s\n\n", data)
+		_ = s.rc.Flush()
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(s.w, "\n❌ %v\n", err)
+	}
+	s.w.Header().Set(apiExitCodeTrailer, strconv.Itoa(result.ExitCode))
+}
+
+// apiFlushWriter writes plain-text output straight to the client
+type apiFlushWriter struct{ s *apiStream }
+
+func (f apiFlushWriter) Write(b []byte) (int, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	n, err := f.s.w.Write(b)
+	_ = f.s.rc.Flush()
+	return n, err
+}
+
+// apiEventWriter turns each line it is given into a server-sent event. The
+// prefixWriter in front of it holds the lock while it writes.
+type apiEventWriter struct {
+	s     *apiStream
+	event string
+}
+
+func (e apiEventWriter) Write(line []byte) (int, error) {
+	if len(line) == 0 {
+		return 0, nil // the empty prefix
+	}
+	text := strings.TrimRight(string(line), "\r\n")
+	if _, err := fmt.Fprintf(e.s.w, "event: %s\ndata: %s\n\n", e.event, text); err != nil {
+		return 0, err
+	}
+	_ = e.s.rc.Flush()
+	return len(line), nil
+}
+
+// isLoopbackAddr reports whether addr only listens on this computer
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// NewServeCommand returns the 'serve' command that exposes gadgets over HTTP
+func NewServeCommand() *cobra.Command {
+	var addr, tokenFile string
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve a local HTTP API for listing, editing and running gadgets",
+		Long: `Start a local HTTP API so dashboards and editors can manage and run gadgets.
+It uses the same gadgets, policy and run history as the CLI.
+
+Every request needs the token from the token file, sent as
+'Authorization: Bearer <token>' (or '?token=<token>' where headers can't be set).
+The file is created with a random token the first time.
+
+Endpoints:
+  GET    /api/gadgets              List gadgets
+  GET    /api/gadgets/{name}       Get one gadget
+  POST   /api/gadgets              Create a gadget ({"name": ..., "command": ...})
+  PUT    /api/gadgets/{name}       Replace a gadget
+  DELETE /api/gadgets/{name}       Delete a gadget
+  POST   /api/gadgets/{name}/run   Run a gadget ({"variables": {...}, "confirm": true, "timeout": "30s"})
+
+Runs stream their output as chunked text, or as server-sent events when the
+request has 'Accept: text/event-stream'. Dangerous gadgets need "confirm": true.`,
+		Example: `  GoGoGadget serve
+  GoGoGadget serve --addr 127.0.0.1:9000`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if tokenFile == "" {
+				tokenFile = getAPITokenPath()
+			}
+			token, err := loadAPIToken(tokenFile)
+			if err != nil {
+				return fmt.Errorf("could not read the API token: %w", err)
+			}
+			listener, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			if !isLoopbackAddr(addr) {
+				warnText(fmt.Sprintf("⚠️ Listening on %s, which other computers may reach. Anyone with the token can run your gadgets.", addr))
+			}
+
+			ctx := cmd.Context()
+			server := &http.Server{
+				Handler:           newAPIHandler(token),
+				ReadHeaderTimeout: 10 * time.Second,
+				BaseContext:       func(net.Listener) context.Context { return ctx },
+			}
+			go func() {
+				<-ctx.Done()
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), gogo.DefaultGracePeriod)
+				defer cancel()
+				_ = server.Shutdown(shutdownCtx)
+			}()
+
+			colorText.Cyan(fmt.Sprintf("🌐 GoGoGadget API listening on http://%s/api/gadgets. Press Ctrl+C to stop.", listener.Addr()))
+			infoText(fmt.Sprintf("🔑 Token file: %s", tokenFile))
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&addr, "addr", defaultServeAddr, "Address to listen on, e.g. 127.0.0.1:9000")
+	cmd.Flags().StringVar(&tokenFile, "token-file", "", "File holding the API token (default: api_token in the GoGoGadget config folder)")
+	return cmd
+}
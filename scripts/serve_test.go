@@ -0,0 +1,401 @@
+//go:build !windows
+
+package scripts
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAPIToken = "test-token"
+
+// newTestAPI serves the API from a config folder of its own, with a stand-in
+// shell that runs each gadget's script with sh
+func newTestAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv(extraPolicyVariable, "")
+	shell := filepath.Join(t.TempDir(), "fakeps")
+	if err := os.WriteFile(shell, []byte("#!/bin/sh\n# Called as: fakeps -File script\nshift\nexec sh \"$@\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOGOGADGET_SHELL", shell)
+
+	srv := httptest.NewServer(newAPIHandler(testAPIToken))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// apiRequest sends body (if not nil) as JSON with the test token
+func apiRequest(t *testing.T, srv *httptest.Server, method, path string, body interface{}) *http.Response {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = strings.NewReader(string(data))
+	}
+	req, err := http.NewRequest(method, srv.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAPIToken)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func expectStatus(t *testing.T, resp *http.Response, want int) {
+	t.Helper()
+	if resp.StatusCode != want {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: status %d, want %d; body: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, want, body)
+	}
+}
+
+func decodeResponse(t *testing.T, resp *http.Response, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("decoding the response: %v", err)
+	}
+}
+
+func TestAPIRejectsWrongToken(t *testing.T) {
+	srv := newTestAPI(t)
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		want   int
+	}{
+		{name: "no token", want: http.StatusUnauthorized},
+		{name: "wrong header", header: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "not a bearer token", header: testAPIToken, want: http.StatusUnauthorized},
+		{name: "wrong query", query: "nope", want: http.StatusUnauthorized},
+		// The header wins, so a right query can't make up for a wrong header
+		{name: "wrong header, right query", header: "Bearer nope", query: testAPIToken, want: http.StatusUnauthorized},
+		{name: "header", header: "Bearer " + testAPIToken, want: http.StatusOK},
+		{name: "query", query: testAPIToken, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := srv.URL + "/api/gadgets"
+			if tt.query != "" {
+				url += "?token=" + tt.query
+			}
+			req, _ := http.NewRequest(http.MethodGet, url, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestAPIGadgetCRUD(t *testing.T) {
+	srv := newTestAPI(t)
+
+	resp := apiRequest(t, srv, http.MethodPost, "/api/gadgets", map[string]interface{}{
+		"name":        "greet",
+		"description": "Says hello",
+		"command":     "echo hello {{who}}",
+	})
+	expectStatus(t, resp, http.StatusCreated)
+	if loc := resp.Header.Get("Location"); loc != "/api/gadgets/greet" {
+		t.Errorf("Location %q", loc)
+	}
+	var created apiGadget
+	decodeResponse(t, resp, &created)
+	if _, ok := created.Variables["who"]; !ok {
+		t.Errorf("the variable wasn't filled in: %v", created.Variables)
+	}
+
+	resp = apiRequest(t, srv, http.MethodPost, "/api/gadgets", map[string]interface{}{"name": "greet", "command": "echo again"})
+	expectStatus(t, resp, http.StatusConflict)
+	resp = apiRequest(t, srv, http.MethodPost, "/api/gadgets", map[string]interface{}{"name": "bad name", "command": "echo"})
+	expectStatus(t, resp, http.StatusBadRequest)
+	resp = apiRequest(t, srv, http.MethodPost, "/api/gadgets", map[string]interface{}{"name": "x", "command": "echo", "unknown": 1})
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	// Changes made through the API are what the CLI sees
+	scripts, err := loadScripts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scripts["greet"].Command != "echo hello {{who}}" {
+		t.Errorf("saved command %q", scripts["greet"].Command)
+	}
+
+	resp = apiRequest(t, srv, http.MethodPut, "/api/gadgets/greet", map[string]interface{}{
+		"description": "Says hi",
+		"command":     "echo hi",
+	})
+	expectStatus(t, resp, http.StatusOK)
+	resp = apiRequest(t, srv, http.MethodPut, "/api/gadgets/greet", map[string]interface{}{"name": "other", "command": "echo hi"})
+	expectStatus(t, resp, http.StatusBadRequest)
+	resp = apiRequest(t, srv, http.MethodPut, "/api/gadgets/missing", map[string]interface{}{"command": "echo hi"})
+	expectStatus(t, resp, http.StatusNotFound)
+
+	resp = apiRequest(t, srv, http.MethodGet, "/api/gadgets/greet", nil)
+	expectStatus(t, resp, http.StatusOK)
+	var got apiGadget
+	decodeResponse(t, resp, &got)
+	if got.Name != "greet" || got.Description != "Says hi" || got.Command != "echo hi" {
+		t.Errorf("got %+v after the update", got)
+	}
+
+	resp = apiRequest(t, srv, http.MethodGet, "/api/gadgets", nil)
+	expectStatus(t, resp, http.StatusOK)
+	var list []apiGadget
+	decodeResponse(t, resp, &list)
+	if len(list) != 1 || list[0].Name != "greet" {
+		t.Errorf("list = %+v", list)
+	}
+
+	resp = apiRequest(t, srv, http.MethodDelete, "/api/gadgets/greet", nil)
+	expectStatus(t, resp, http.StatusNoContent)
+	resp = apiRequest(t, srv, http.MethodGet, "/api/gadgets/greet", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+	resp = apiRequest(t, srv, http.MethodDelete, "/api/gadgets/greet", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestAPIRunPlainText(t *testing.T) {
+	srv := newTestAPI(t)
+	resp := apiRequest(t, srv, http.MethodPost, "/api/gadgets", map[string]interface{}{
+		"name":    "greet",
+		"command": "echo hello '{{who}}'\nexit 3",
+	})
+	expectStatus(t, resp, http.StatusCreated)
+
+	resp = apiRequest(t, srv, http.MethodPost, "/api/gadgets/greet/run", nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+	resp = apiRequest(t, srv, http.MethodPost, "/api/gadgets/greet/run", apiRunRequest{Variables: map[string]string{"nope": "x"}})
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = apiRequest(t, srv, http.MethodPost, "/api/gadgets/greet/run", apiRunRequest{Variables: map[string]string{"who": "world"}})
+	expectStatus(t, resp, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "hello world") {
+		t.Errorf("output %q", body)
+	}
+	if code := resp.Trailer.Get(apiExitCodeTrailer); code != "3" {
+		t.Errorf("exit code trailer %q, want 3", code)
+	}
+}
+
+func TestAPIRunBlockedByPolicy(t *testing.T) {
+	srv := newTestAPI(t)
+	resp := apiRequest(t, srv, http.MethodPost, "/api/gadgets", map[string]interface{}{"name": "greet", "command": "echo hello"})
+	expectStatus(t, resp, http.StatusCreated)
+	if err := os.WriteFile(userPolicyPath(), []byte(`{"denyCommands": ["echo"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = apiRequest(t, srv, http.MethodPost, "/api/gadgets/greet/run", nil)
+	expectStatus(t, resp, http.StatusForbidden)
+	var apiErr apiError
+	decodeResponse(t, resp, &apiErr)
+	if !strings.Contains(apiErr.Error, "'echo' is not allowed") {
+		t.Errorf("error %q doesn't say why", apiErr.Error)
+	}
+
+	// A policy that can't be read blocks runs too, but isn't the client's fault
+	if err := os.WriteFile(userPolicyPath(), []byte(`{`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resp = apiRequest(t, srv, http.MethodPost, "/api/gadgets/greet/run", nil)
+	expectStatus(t, resp, http.StatusInternalServerError)
+}
+
+func TestAPIRunDangerousNeedsConfirm(t *testing.T) {
+	srv := newTestAPI(t)
+	target := filepath.Join(t.TempDir(), "target")
+	if err := os.MkdirAll(filepath.Join(target, "inside"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	resp := apiRequest(t, srv, http.MethodPost, "/api/gadgets", map[string]interface{}{
+		"name":    "wipe",
+		"command": "rm -r '{{dir}}'",
+	})
+	expectStatus(t, resp, http.StatusCreated)
+	vars := map[string]string{"dir": target}
+
+	resp = apiRequest(t, srv, http.MethodPost, "/api/gadgets/wipe/run", apiRunRequest{Variables: vars})
+	expectStatus(t, resp, http.StatusForbidden)
+	var apiErr apiError
+	decodeResponse(t, resp, &apiErr)
+	if len(apiErr.Dangers) == 0 || !strings.Contains(apiErr.Dangers[0], "deletes folders") {
+		t.Errorf("dangers = %v", apiErr.Dangers)
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Fatalf("the gadget ran without confirm: %v", err)
+	}
+
+	resp = apiRequest(t, srv, http.MethodPost, "/api/gadgets/wipe/run", apiRunRequest{Variables: vars, Confirm: true})
+	expectStatus(t, resp, http.StatusOK)
+	io.Copy(io.Discard, resp.Body)
+	if code := resp.Trailer.Get(apiExitCodeTrailer); code != "0" {
+		t.Errorf("exit code trailer %q, want 0", code)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("the confirmed run didn't happen: %v", err)
+	}
+}
+
+// sseEvent is one server-sent event
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// readEvent reads the next event from a server-sent event stream
+func readEvent(r *bufio.Reader) (sseEvent, error) {
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return ev, err
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if ev.Event != "" {
+				return ev, nil
+			}
+		case strings.HasPrefix(line, "event: "):
+			ev.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestAPIRunStreamsEvents(t *testing.T) {
+	srv := newTestAPI(t)
+	release := filepath.Join(t.TempDir(), "release")
+	resp := apiRequest(t, srv, http.MethodPost, "/api/gadgets", map[string]interface{}{
+		"name": "slow",
+		// The gadget waits after its first line, so that line can only have
+		// arrived if it was sent while the gadget was still running
+		"command": "echo first\nwhile [ ! -e '{{release}}' ]; do sleep 0.02; done\necho oops >&2\nexit 2",
+	})
+	expectStatus(t, resp, http.StatusCreated)
+
+	// EventSource clients can't set headers, so this one sends the token in the URL
+	body := strings.NewReader(`{"variables": {"release": "` + release + `"}}`)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/gadgets/slow/run?token="+testAPIToken, body)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	expectStatus(t, resp, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type %q", ct)
+	}
+
+	events := make(chan sseEvent)
+	go func() {
+		defer close(events)
+		r := bufio.NewReader(resp.Body)
+		for {
+			ev, err := readEvent(r)
+			if err != nil {
+				return
+			}
+			events <- ev
+		}
+	}()
+	next := func() sseEvent {
+		t.Helper()
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatal("the stream ended early")
+			}
+			return ev
+		case <-time.After(10 * time.Second):
+			t.Fatal("no event arrived")
+		}
+		return sseEvent{}
+	}
+
+	if ev := next(); ev != (sseEvent{Event: "stdout", Data: "first"}) {
+		t.Fatalf("first event %+v", ev)
+	}
+	if err := os.WriteFile(release, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ev := next(); ev != (sseEvent{Event: "stderr", Data: "oops"}) {
+		t.Errorf("second event %+v", ev)
+	}
+	ev := next()
+	if ev.Event != "exit" {
+		t.Fatalf("last event %+v, want exit", ev)
+	}
+	var result apiRunResult
+	if err := json.Unmarshal([]byte(ev.Data), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 2 {
+		t.Errorf("exit code %d, want 2", result.ExitCode)
+	}
+}
+
+func TestAPIRunNeverPrompts(t *testing.T) {
+	srv := newTestAPI(t)
+	for _, g := range []map[string]interface{}{
+		{"name": "fail", "command": "exit 1"},
+		{"name": "show", "command": "echo '{{out}}'"},
+		// The failing step never captures out, so the second step has no value
+		{"name": "wf", "steps": []map[string]interface{}{
+			{"gadget": "fail", "capture": "out", "continueOnError": true},
+			{"gadget": "show"},
+		}},
+	} {
+		expectStatus(t, apiRequest(t, srv, http.MethodPost, "/api/gadgets", g), http.StatusCreated)
+	}
+
+	done := make(chan []byte)
+	go func() {
+		resp := apiRequest(t, srv, http.MethodPost, "/api/gadgets/wf/run", nil)
+		body, _ := io.ReadAll(resp.Body)
+		done <- body
+	}()
+	select {
+	case body := <-done:
+		if !strings.Contains(string(body), "no value for variable 'out'") {
+			t.Errorf("output %q doesn't name the missing variable", body)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the run is waiting for an answer nobody can give")
+	}
+}
@@ -0,0 +1,108 @@
+package scripts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// interruptCleanup, when set, runs before GoGoGadget exits on an interrupt it
+// couldn't wait out, e.g. to put the terminal back the way it was
+var interruptCleanup atomic.Pointer[func()]
+
+// stuckExitDelay is how long a command gets to stop by itself after an
+// interrupt while no gadget is running. Commands waiting on something that
+// can't be cancelled, like a prompt reading the terminal, are ended after it.
+const stuckExitDelay = time.Second
+
+// NotifyInterrupts returns a context that is cancelled with a *gogo.Interrupt
+// when GoGoGadget receives SIGINT or SIGTERM. Running gadgets get the signal
+// forwarded and a grace period to exit; workflows, fan-outs and loops stop
+// before their next run, and the command returns so main can exit with 130.
+// A second signal kills running gadgets at once, or exits if none are running.
+func NotifyInterrupts(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		var intr *gogo.Interrupt
+		var stuck <-chan time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-sigs:
+				if intr == nil {
+					intr = gogo.NewInterrupt(sig)
+					cancel(intr)
+					stuck = time.After(stuckExitDelay)
+					continue
+				}
+				intr.Force()
+				if gogo.ActiveRuns() == 0 {
+					exitInterrupted()
+				}
+			case <-stuck:
+				if gogo.ActiveRuns() > 0 {
+					// Still stopping gadgets, which have their own grace period
+					stuck = time.After(stuckExitDelay)
+					continue
+				}
+				exitInterrupted()
+			}
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel(context.Canceled)
+	}
+}
+
+// exitInterrupted ends GoGoGadget straight away when a command doesn't stop
+// by itself after an interrupt
+func exitInterrupted() {
+	if cleanup := interruptCleanup.Load(); cleanup != nil {
+		(*cleanup)()
+	}
+	fmt.Fprintln(os.Stderr)
+	warnText("⚠️ Interrupted")
+	os.Exit(gogo.ExitInterrupted)
+}
+
+// InterruptResult returns the error GoGoGadget should exit with once a command
+// run with a NotifyInterrupts context has returned err. A command that stopped
+// quietly because of an interrupt, like a watch loop or the daemon, exits with
+// 130 too.
+func InterruptResult(ctx context.Context, err error) error {
+	if gogo.InterruptCause(ctx) == nil {
+		return err
+	}
+	if err == nil || errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr)
+		warnText("⚠️ Interrupted")
+		return &ExitCodeError{Code: gogo.ExitInterrupted}
+	}
+	return err
+}
+
+// sleepContext waits for d, or returns ctx's error if it is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,498 @@
+package scripts
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// publicKeyPrefix starts every public key GoGoGadget prints or accepts
+const publicKeyPrefix = "ed25519:"
+
+// signaturePayloadHeader versions the bytes that are signed
+const signaturePayloadHeader = "gogogadget-signature-v2\n"
+
+// signingKey is the user's own key, stored in the config dir
+type signingKey struct {
+	Author     string `json:"author"`
+	PrivateKey string `json:"privateKey"` // base64 ed25519 seed
+
+	private ed25519.PrivateKey
+}
+
+// publicKey returns the key others use to trust this one
+func (k *signingKey) publicKey() string {
+	return encodePublicKey(k.private.Public().(ed25519.PublicKey))
+}
+
+// TrustedKey is a public key whose signatures are accepted
+type TrustedKey struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"publicKey"`
+}
+
+// getSigningKeyPath returns the path of the user's private signing key
+func getSigningKeyPath() string {
+	return filepath.Join(getConfigDir(), "signing_key.json")
+}
+
+// getTrustedKeysPath returns the path of the user's trusted keys
+func getTrustedKeysPath() string {
+	return filepath.Join(getConfigDir(), "trusted_keys.json")
+}
+
+func encodePublicKey(pub ed25519.PublicKey) string {
+	return publicKeyPrefix + base64.StdEncoding.EncodeToString(pub)
+}
+
+// decodePublicKey parses a key printed by encodePublicKey
+func decodePublicKey(s string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), publicKeyPrefix))
+	if err != nil || len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("'%s' is not an ed25519 public key", s)
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// loadSigningKey reads the user's signing key, or returns nil if there isn't one yet
+func loadSigningKey() (*signingKey, error) {
+	data, err := os.ReadFile(getSigningKeyPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var key signingKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", getSigningKeyPath(), err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(key.PrivateKey)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s does not hold a valid ed25519 key", getSigningKeyPath())
+	}
+	key.private = ed25519.NewKeyFromSeed(seed)
+	return &key, nil
+}
+
+// createSigningKey makes a new key for author and saves it, readable only by the user
+func createSigningKey(author string) (*signingKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	key := &signingKey{
+		Author:     author,
+		PrivateKey: base64.StdEncoding.EncodeToString(private.Seed()),
+		private:    private,
+	}
+	data, err := json.MarshalIndent(key, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(getSigningKeyPath(), data, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// defaultAuthor names a new key after the logged-in user
+func defaultAuthor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return "unknown"
+}
+
+// loadTrustedKeys reads the user's trusted keys
+func loadTrustedKeys() ([]TrustedKey, error) {
+	data, err := os.ReadFile(getTrustedKeysPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []TrustedKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", getTrustedKeysPath(), err)
+	}
+	return keys, nil
+}
+
+// trustedKeyName returns who a public key belongs to if it is trusted: the user's
+// own key, a key in trusted_keys.json, or a key listed by a policy
+func trustedKeyName(publicKey string, policies []Policy) (string, bool) {
+	if own, err := loadSigningKey(); err == nil && own != nil && sameKey(publicKey, own.publicKey()) {
+		return own.Author + " (you)", true
+	}
+	keys, _ := loadTrustedKeys()
+	for _, k := range keys {
+		if sameKey(publicKey, k.PublicKey) {
+			return k.Name, true
+		}
+	}
+	return policyKeyName(publicKey, policies)
+}
+
+// policyKeyName returns which policy trusts a public key, if any of policies lists it
+func policyKeyName(publicKey string, policies []Policy) (string, bool) {
+	for _, p := range policies {
+		for _, k := range p.TrustedKeys {
+			if sameKey(publicKey, k) {
+				return "trusted by " + p.path, true
+			}
+		}
+	}
+	return "", false
+}
+
+// sameKey reports whether two encoded public keys are the same valid key
+func sameKey(a, b string) bool {
+	keyA, err := decodePublicKey(a)
+	if err != nil {
+		return false
+	}
+	keyB, err := decodePublicKey(b)
+	return err == nil && keyA.Equal(keyB)
+}
+
+// signaturePayload returns the bytes a gadget's signature covers: its name and
+// its definition as JSON, including who signed it with which key and when, but
+// not the signature value itself or the derived Dangerous flag
+func signaturePayload(name string, config gogo.Gadget) ([]byte, error) {
+	if config.Signature != nil {
+		sig := *config.Signature
+		sig.Value = ""
+		config.Signature = &sig
+	}
+	config.Dangerous = false
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(signaturePayloadHeader+name+"\n"), data...), nil
+}
+
+// signGadget signs a gadget with key, replacing any earlier signature
+func signGadget(name string, config *gogo.Gadget, key *signingKey) error {
+	sig := &gogo.Signature{
+		Author:    key.Author,
+		PublicKey: key.publicKey(),
+		Signed:    time.Now().UTC().Truncate(time.Second),
+	}
+	signed := *config
+	signed.Signature = sig
+	payload, err := signaturePayload(name, signed)
+	if err != nil {
+		return err
+	}
+	sig.Value = base64.StdEncoding.EncodeToString(ed25519.Sign(key.private, payload))
+	config.Signature = sig
+	return nil
+}
+
+// errUnsigned is returned for gadgets that have no signature at all
+var errUnsigned = errors.New("not signed")
+
+// checkSignature reports whether the gadget's signature matches its definition,
+// without looking at whether the key is trusted
+func checkSignature(name string, config gogo.Gadget) error {
+	sig := config.Signature
+	if sig == nil {
+		return errUnsigned
+	}
+	pub, err := decodePublicKey(sig.PublicKey)
+	if err != nil {
+		return err
+	}
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return errors.New("the signature is not valid base64")
+	}
+	payload, err := signaturePayload(name, config)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, payload, value) {
+		return errors.New("the signature doesn't match; the gadget was changed after it was signed")
+	}
+	return nil
+}
+
+// checkSignedGadget is checkSignature with a message naming the gadget when it
+// isn't signed at all
+func checkSignedGadget(name string, config gogo.Gadget) error {
+	err := checkSignature(name, config)
+	if errors.Is(err, errUnsigned) {
+		return fmt.Errorf("'%s' is not signed", name)
+	}
+	return err
+}
+
+// verifyGadgetSignature reports why a gadget can't be trusted as signed: it has
+// no signature, the signature doesn't match, or the key isn't trusted
+func verifyGadgetSignature(name string, config gogo.Gadget, policies []Policy) error {
+	if err := checkSignedGadget(name, config); err != nil {
+		return err
+	}
+	if _, ok := trustedKeyName(config.Signature.PublicKey, policies); !ok {
+		return fmt.Errorf("'%s' is signed with a key that isn't trusted (it claims to belong to %s)", name, config.Signature.Author)
+	}
+	return nil
+}
+
+// verifyMachineSignature is verifyGadgetSignature for the requireSigned rule of
+// the machine policy p. Only the keys p lists count: the user's own key and
+// trusted_keys.json don't, or anyone could meet the rule by signing gadgets
+// themselves.
+func verifyMachineSignature(name string, config gogo.Gadget, p Policy) error {
+	if err := checkSignedGadget(name, config); err != nil {
+		return err
+	}
+	if _, ok := policyKeyName(config.Signature.PublicKey, []Policy{p}); !ok {
+		return fmt.Errorf("'%s' is signed with a key the machine policy doesn't list (it claims to belong to %s)", name, config.Signature.Author)
+	}
+	return nil
+}
+
+// signatureWarning returns a warning for gadgets whose signature is present but
+// doesn't hold up. Unsigned gadgets are only a problem when a policy requires signing.
+func signatureWarning(name string, config gogo.Gadget, policies []Policy) string {
+	if config.Signature == nil {
+		return ""
+	}
+	if err := verifyGadgetSignature(name, config, policies); err != nil {
+		return "⚠️ " + err.Error()
+	}
+	return ""
+}
+
+// dropStaleSignature removes a signature an edit has made invalid
+func dropStaleSignature(name string) {
+	scripts, err := loadScripts()
+	if err != nil {
+		return
+	}
+	config, ok := scripts[name]
+	if !ok || config.Signature == nil || checkSignature(name, config) == nil {
+		return
+	}
+	config.Signature = nil
+	scripts[name] = config
+	if saveScripts(scripts) == nil {
+		infoText(fmt.Sprintf("The signature on '%s' was removed because it changed. Sign it again with 'GoGoGadget sign %s'.", name, name))
+	}
+}
+
+// NewSignCommand returns the 'sign' command
+func NewSignCommand() *cobra.Command {
+	var author string
+	var showKey bool
+	cmd := &cobra.Command{
+		Use:   "sign [gadget]",
+		Short: "Sign a gadget so others can check who wrote it and that it hasn't changed",
+		Long: `Sign a gadget with your own ed25519 key. The key is created the first time you
+sign and kept in the GoGoGadget folder. Share your public key (see --show-key) so
+others can trust it with 'GoGoGadget trust add'.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := loadSigningKey()
+			if err != nil {
+				return err
+			}
+			if key == nil {
+				if author == "" {
+					author = defaultAuthor()
+				}
+				if key, err = createSigningKey(author); err != nil {
+					return fmt.Errorf("could not create a signing key: %w", err)
+				}
+				successText(fmt.Sprintf("🔑 Created a signing key for %s in %s", key.Author, getSigningKeyPath()))
+			}
+			if showKey {
+				fmt.Println(key.publicKey())
+				return nil
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("name the gadget to sign, or pass --show-key")
+			}
+
+			name := args[0]
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			config, ok := scripts[name]
+			if !ok {
+				return fmt.Errorf("gadget '%s' not found", name)
+			}
+			if author != "" {
+				key.Author = author
+			}
+			if err := signGadget(name, &config, key); err != nil {
+				return err
+			}
+			scripts[name] = config
+			if err := saveScripts(scripts); err != nil {
+				return err
+			}
+			successText(fmt.Sprintf("✅ Signed '%s' as %s.", name, key.Author))
+			infoText("Your public key: " + key.publicKey())
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&author, "author", "", "Name to sign as (default: your key's name, or your user name for a new key)")
+	cmd.Flags().BoolVar(&showKey, "show-key", false, "Print your public key to share with others")
+	return cmd
+}
+
+// NewVerifyCommand returns the 'verify' command that checks gadget signatures
+func NewVerifyCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "verify [gadget]",
+		Short:        "Check who signed a gadget (or every gadget) and that it hasn't changed",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			policies, err := loadPolicies()
+			if err != nil {
+				return err
+			}
+			var names []string
+			if len(args) == 1 {
+				if _, ok := scripts[args[0]]; !ok {
+					return fmt.Errorf("gadget '%s' not found", args[0])
+				}
+				names = args
+			} else {
+				for name := range scripts {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+			}
+
+			bad := 0
+			for _, name := range names {
+				config := scripts[name]
+				err := verifyGadgetSignature(name, config, policies)
+				switch {
+				case err == nil:
+					who, _ := trustedKeyName(config.Signature.PublicKey, policies)
+					successText(fmt.Sprintf("✅ %s: signed by %s on %s", name, who, config.Signature.Signed.Format("2006-01-02")))
+				case config.Signature == nil:
+					infoText(fmt.Sprintf("➖ %s: not signed", name))
+				default:
+					bad++
+					errorText(fmt.Sprintf("❌ %s: %v", name, err))
+				}
+			}
+			if bad > 0 {
+				return &ExitCodeError{Code: 1}
+			}
+			return nil
+		},
+	}
+}
+
+// NewTrustCommand returns the 'trust' command that manages trusted public keys
+func NewTrustCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trust",
+		Short: "Manage the public keys whose gadget signatures you trust",
+	}
+
+	addCmd := &cobra.Command{
+		Use:          "add [name] [public key]",
+		Short:        "Trust signatures made with a public key",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pub, err := decodePublicKey(args[1])
+			if err != nil {
+				return err
+			}
+			keys, err := loadTrustedKeys()
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				if k.Name == args[0] {
+					return fmt.Errorf("a key named '%s' is already trusted; remove it first", args[0])
+				}
+			}
+			keys = append(keys, TrustedKey{Name: args[0], PublicKey: encodePublicKey(pub)})
+			if err := writeFileAtomic(getTrustedKeysPath(), keys); err != nil {
+				return err
+			}
+			successText(fmt.Sprintf("✅ Now trusting gadgets signed by '%s'.", args[0]))
+			return nil
+		},
+	}
+
+	listCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List trusted public keys",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := loadTrustedKeys()
+			if err != nil {
+				return err
+			}
+			if own, err := loadSigningKey(); err == nil && own != nil {
+				fmt.Printf("%-20s  %s\n", own.Author+" (you)", own.publicKey())
+			}
+			for _, k := range keys {
+				fmt.Printf("%-20s  %s\n", k.Name, k.PublicKey)
+			}
+			return nil
+		},
+	}
+
+	removeCmd := &cobra.Command{
+		Use:          "remove [name]",
+		Short:        "Stop trusting a public key",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := loadTrustedKeys()
+			if err != nil {
+				return err
+			}
+			kept := keys[:0]
+			for _, k := range keys {
+				if k.Name != args[0] {
+					kept = append(kept, k)
+				}
+			}
+			if len(kept) == len(keys) {
+				return fmt.Errorf("no trusted key named '%s'", args[0])
+			}
+			if err := writeFileAtomic(getTrustedKeysPath(), kept); err != nil {
+				return err
+			}
+			successText(fmt.Sprintf("✅ No longer trusting '%s'.", args[0]))
+			return nil
+		},
+	}
+
+	cmd.AddCommand(addCmd, listCmd, removeCmd)
+	return cmd
+}
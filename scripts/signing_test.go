@@ -0,0 +1,164 @@
+package scripts
+
+import (
+	"encoding/json"
+	"gogo/gogo"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestSigner points the config dir at a temporary folder and creates a
+// signing key for author in it
+func newTestSigner(t *testing.T, author string) *signingKey {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("APPDATA", filepath.Join(home, "AppData"))
+	key, err := createSigningKey(author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// otherKey returns a key that is neither the user's own nor trusted
+func otherKey(t *testing.T, author string) *signingKey {
+	t.Helper()
+	own, err := loadSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := createSigningKey(author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Put the user's own key back
+	data, _ := json.Marshal(own)
+	if err := os.WriteFile(getSigningKeyPath(), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func signedTestGadget(t *testing.T, key *signingKey) gogo.Gadget {
+	t.Helper()
+	config := gogo.Gadget{
+		Description: "Say hello",
+		Command:     "Write-Output 'Hello {{name}}'",
+		Variables:   map[string]string{"name": "Who to greet"},
+	}
+	if err := signGadget("hello", &config, key); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestSignatureRoundTrip(t *testing.T) {
+	key := newTestSigner(t, "Alice")
+	tests := []struct {
+		name    string
+		tamper  func(g *gogo.Gadget)
+		wantErr string
+	}{
+		{"unchanged", func(g *gogo.Gadget) {}, ""},
+		{"command changed", func(g *gogo.Gadget) { g.Command = "Remove-Item C:\\ -Recurse" }, "changed after it was signed"},
+		{"variable added", func(g *gogo.Gadget) { g.Variables["extra"] = "" }, "changed after it was signed"},
+		{"author changed", func(g *gogo.Gadget) { g.Signature.Author = "Mallory" }, "changed after it was signed"},
+		{"date changed", func(g *gogo.Gadget) { g.Signature.Signed = g.Signature.Signed.AddDate(1, 0, 0) }, "changed after it was signed"},
+		{"not base64", func(g *gogo.Gadget) { g.Signature.Value = "!!" }, "not valid base64"},
+		{"unsigned", func(g *gogo.Gadget) { g.Signature = nil }, "'hello' is not signed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := signedTestGadget(t, key)
+			sig := *config.Signature
+			config.Signature = &sig
+			tt.tamper(&config)
+			err := verifyGadgetSignature("hello", config, nil)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verify: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("verify: %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignatureSurvivesEachFormat(t *testing.T) {
+	key := newTestSigner(t, "Alice")
+	lib := gogo.Library{"hello": signedTestGadget(t, key)}
+	for _, format := range []string{gogo.FormatJSON, gogo.FormatYAML, gogo.FormatTOML} {
+		data, err := gogo.Encode(lib, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		decoded, err := gogo.Decode(data, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if err := verifyGadgetSignature("hello", decoded["hello"], nil); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+	}
+}
+
+func TestSignatureTrust(t *testing.T) {
+	own := newTestSigner(t, "Alice")
+	stranger := otherKey(t, "Bob")
+	friend := otherKey(t, "Carol")
+	data, _ := json.Marshal([]TrustedKey{{Name: "Carol from IT", PublicKey: friend.publicKey()}})
+	if err := os.WriteFile(getTrustedKeysPath(), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	machine := Policy{RequireSigned: true, TrustedKeys: []string{stranger.publicKey()}, path: "/etc/gogogadget/policy.json", machine: true}
+
+	tests := []struct {
+		name        string
+		key         *signingKey
+		author      string // signs with this name instead of the key's own
+		wantTrusted string
+		wantMachine bool
+	}{
+		{"own key", own, "", "Alice (you)", false},
+		{"trusted key", friend, "", "Carol from IT", false},
+		{"trusted key claiming another name", friend, "Alice", "Carol from IT", false},
+		{"untrusted key", stranger, "", "", true},
+		{"untrusted key claiming a trusted name", stranger, "Carol from IT", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := *tt.key
+			if tt.author != "" {
+				key.Author = tt.author
+			}
+			config := signedTestGadget(t, &key)
+
+			err := verifyGadgetSignature("hello", config, nil)
+			if tt.wantTrusted == "" {
+				if err == nil || !strings.Contains(err.Error(), "isn't trusted") {
+					t.Errorf("verify: %v, want a key that isn't trusted", err)
+				}
+			} else if err != nil {
+				t.Errorf("verify: %v", err)
+			} else if who, _ := trustedKeyName(config.Signature.PublicKey, nil); who != tt.wantTrusted {
+				t.Errorf("signed by %q, want %q", who, tt.wantTrusted)
+			}
+
+			// The machine policy only accepts the keys it lists
+			err = verifyMachineSignature("hello", config, machine)
+			if tt.wantMachine && err != nil {
+				t.Errorf("machine policy: %v", err)
+			}
+			if !tt.wantMachine && (err == nil || !strings.Contains(err.Error(), "doesn't list")) {
+				t.Errorf("machine policy: %v, want a key it doesn't list", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,491 @@
+package scripts
+
+import (
+	"bufio"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-colorable"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// Shells whose history 'suggest' reads
+const (
+	HistoryPowerShell = "powershell"
+	HistoryBash       = "bash"
+	HistoryZsh        = "zsh"
+)
+
+// historyFile is a shell history file and the shell that wrote it
+type historyFile struct {
+	Path  string
+	Shell string
+}
+
+// historyEntry is one command from a history file
+type historyEntry struct {
+	Command string
+	Shell   string
+}
+
+// defaultHistoryFiles returns where PSReadLine, bash and zsh keep their history
+func defaultHistoryFiles() []historyFile {
+	home, _ := os.UserHomeDir()
+	psDir := filepath.Join(home, ".local", "share", "powershell", "PSReadLine")
+	if runtime.GOOS == "windows" {
+		psDir = filepath.Join(os.Getenv("APPDATA"), "Microsoft", "Windows", "PowerShell", "PSReadLine")
+	} else if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		psDir = filepath.Join(dataHome, "powershell", "PSReadLine")
+	}
+	return []historyFile{
+		{Path: filepath.Join(psDir, "ConsoleHost_history.txt"), Shell: HistoryPowerShell},
+		{Path: filepath.Join(home, ".bash_history"), Shell: HistoryBash},
+		{Path: filepath.Join(home, ".zsh_history"), Shell: HistoryZsh},
+	}
+}
+
+// historyShell guesses which shell wrote a history file from its name
+func historyShell(path string) string {
+	base := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.Contains(base, "zsh"):
+		return HistoryZsh
+	case strings.Contains(base, "bash"):
+		return HistoryBash
+	}
+	return HistoryPowerShell
+}
+
+// zshExtendedRe matches the ": <time>:<duration>;" prefix of zsh's extended history
+var zshExtendedRe = regexp.MustCompile(`^: \d+:\d+;`)
+
+// readHistory reads the commands in a history file, oldest first. Commands
+// continued over several lines (with ` in PowerShell or \ in bash and zsh) are joined.
+func readHistory(file historyFile) ([]historyEntry, error) {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	continuation := `\`
+	if file.Shell == HistoryPowerShell {
+		continuation = "`"
+	}
+	var entries []historyEntry
+	var pending []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(pending) == 0 {
+			if file.Shell == HistoryBash && strings.HasPrefix(line, "#") && strings.Trim(line[1:], "0123456789") == "" {
+				continue // HISTTIMEFORMAT timestamp
+			}
+			if file.Shell == HistoryZsh {
+				line = zshExtendedRe.ReplaceAllString(line, "")
+			}
+		}
+		if strings.HasSuffix(line, continuation) {
+			pending = append(pending, strings.TrimSuffix(line, continuation))
+			continue
+		}
+		command := strings.TrimSpace(strings.Join(append(pending, line), " "))
+		pending = nil
+		if command != "" {
+			entries = append(entries, historyEntry{Command: command, Shell: file.Shell})
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// shellOperators separate commands on a line; the word after one is a command name
+var shellOperators = map[string]bool{"|": true, ";": true, "&&": true, "||": true, "&": true}
+
+// splitCommandWords splits a command line on whitespace, keeping quoted text
+// together with its quotes
+func splitCommandWords(line string) []string {
+	var words []string
+	var word strings.Builder
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			word.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			word.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+		default:
+			word.WriteRune(r)
+		}
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// dottedNameRe matches file names and host names like report.csv or db.example.com
+var dottedNameRe = regexp.MustCompile(`[A-Za-z0-9]\.[A-Za-z0-9]`)
+
+// isLiteralArgument reports whether a word looks like a value typed for this one
+// run, such as a quoted string, a number, a path, a file or a host name, rather
+// than a subcommand, a flag or a variable
+func isLiteralArgument(word string) bool {
+	if word == "" || strings.HasPrefix(word, "-") || strings.HasPrefix(word, "$") || shellOperators[word] {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(word, "'") || strings.HasPrefix(word, `"`):
+		return true
+	case isLikelyPath(word), strings.ContainsAny(word, `\/`), strings.HasPrefix(word, "~"):
+		return true
+	case strings.ContainsAny(word, "0123456789"), dottedNameRe.MatchString(word):
+		return true
+	}
+	return false
+}
+
+// commandShape returns a command with its literal arguments blanked out.
+// Commands with the same shape differ only in their literal arguments.
+func commandShape(words []string) string {
+	shape := make([]string, len(words))
+	for i, w := range words {
+		if i > 0 && !shellOperators[words[i-1]] && isLiteralArgument(w) {
+			shape[i] = "\x00"
+		} else {
+			shape[i] = w
+		}
+	}
+	return strings.Join(shape, " ")
+}
+
+// suggestion is a group of similar commands from history, proposed as a gadget
+type suggestion struct {
+	Shape     string
+	Count     int
+	Last      int        // position of the most recent use, for ranking ties
+	Examples  [][]string // distinct commands, split into words, most recent first
+	Shell     string
+	Command   string            // the proposed gadget command
+	Variables map[string]string // variable descriptions, with an example value
+}
+
+// ignoredCommands are too short-lived or too general to be useful as gadgets
+var ignoredCommands = map[string]bool{
+	"cd": true, "ls": true, "dir": true, "cls": true, "clear": true, "exit": true, "history": true,
+	"pwd": true, "man": true, "help": true, "get-help": true, "echo": true, "cat": true,
+	"gogogadget": true, "gogo": true,
+}
+
+// clusterHistory groups commands by shape and returns the groups used at least
+// minCount times, most used first. Groups need something to turn into a variable,
+// or at least three words, to be worth a gadget.
+func clusterHistory(entries []historyEntry, minCount int) []*suggestion {
+	groups := map[string]*suggestion{}
+	for i, e := range entries {
+		words := splitCommandWords(e.Command)
+		if len(words) < 2 || ignoredCommands[commandBaseName(words[0])] {
+			continue
+		}
+		shape := commandShape(words)
+		g, ok := groups[shape]
+		if !ok {
+			g = &suggestion{Shape: shape, Shell: e.Shell}
+			groups[shape] = g
+		}
+		g.Count++
+		g.Last = i
+		g.Examples = append(g.Examples, words)
+	}
+
+	var ranked []*suggestion
+	for _, g := range groups {
+		if g.Count < minCount {
+			continue
+		}
+		g.Examples = distinctRecent(g.Examples)
+		if len(g.Examples) == 1 && len(g.Examples[0]) < 3 {
+			continue
+		}
+		ranked = append(ranked, g)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Count != ranked[j].Count {
+			return ranked[i].Count > ranked[j].Count
+		}
+		return ranked[i].Last > ranked[j].Last
+	})
+	return ranked
+}
+
+// distinctRecent returns the distinct commands, most recent first
+func distinctRecent(examples [][]string) [][]string {
+	var out [][]string
+	seen := map[string]bool{}
+	for i := len(examples) - 1; i >= 0; i-- {
+		key := strings.Join(examples[i], " ")
+		if !seen[key] {
+			out = append(out, examples[i])
+			seen[key] = true
+		}
+	}
+	return out
+}
+
+// parameterize proposes a gadget for a group. Words that differ between the
+// commands become {{variables}}, named after the parameter they follow, or by
+// the kind of value 'analyze' sees in them. Quoted words keep their quotes.
+func (s *suggestion) parameterize() {
+	latest := s.Examples[0]
+	analyzed, _, _ := suggestVariables(strings.Join(latest, " "))
+	s.Variables = map[string]string{}
+	counters := map[string]int{}
+	words := append([]string{}, latest...)
+
+	for i, w := range latest {
+		if !s.varies(i) {
+			continue
+		}
+		value := strings.Trim(w, `'"`)
+		name := ""
+		if i > 0 && parameterNameRe.MatchString(latest[i-1]) {
+			name = strings.ReplaceAll(strings.TrimLeft(latest[i-1], "-"), "-", "_")
+		} else {
+			name = literalVariableName(value, analyzed, counters)
+		}
+		for base, n := name, 2; s.Variables[name] != ""; n++ {
+			name = fmt.Sprintf("%s%d", base, n)
+		}
+		s.Variables[name] = "e.g. " + value
+		if quote := w[:1]; (quote == "'" || quote == `"`) && strings.HasSuffix(w, quote) && len(w) > 1 {
+			words[i] = quote + "{{" + name + "}}" + quote
+		} else {
+			words[i] = "{{" + name + "}}"
+		}
+	}
+	s.Command = strings.Join(words, " ")
+}
+
+// parameterNameRe matches a named parameter or flag, like -ComputerName or --port
+var parameterNameRe = regexp.MustCompile(`^--?[A-Za-z][A-Za-z0-9_-]*$`)
+
+// varies reports whether word i differs between the commands of a group
+func (s *suggestion) varies(i int) bool {
+	for _, e := range s.Examples[1:] {
+		if e[i] != s.Examples[0][i] {
+			return true
+		}
+	}
+	return false
+}
+
+// literalVariableName names a variable by the kind of value it holds (path,
+// number or string), as 'analyze' would, numbering repeats: path, path2, ...
+func literalVariableName(value string, analyzed []variableSuggestion, counters map[string]int) string {
+	kind := "string"
+	for _, a := range analyzed {
+		if strings.Trim(a.Original, `'"`) == value {
+			kind = strings.TrimRight(a.VarName, "0123456789")
+			break
+		}
+	}
+	switch {
+	case psNumberRe.MatchString(value):
+		kind = "number"
+	case isLikelyPath(value):
+		kind = "path"
+	}
+	counters[kind]++
+	if counters[kind] > 1 {
+		return fmt.Sprintf("%s%d", kind, counters[kind])
+	}
+	return kind
+}
+
+// existingCommands returns the commands already saved as gadgets
+func existingCommands(scripts gogo.Library) map[string]bool {
+	commands := map[string]bool{}
+	for _, config := range scripts {
+		commands[strings.TrimSpace(config.Command)] = true
+	}
+	return commands
+}
+
+// suggestGadgetName proposes a name from the first words of a command
+func suggestGadgetName(words []string, scripts gogo.Library) string {
+	var parts []string
+	for _, w := range words {
+		if len(parts) == 2 || shellOperators[w] || isLiteralArgument(w) {
+			break
+		}
+		if !strings.HasPrefix(w, "-") && !strings.HasPrefix(w, "$") {
+			parts = append(parts, strings.ToLower(commandBaseName(w)))
+		}
+	}
+	name := gadgetNameFromFile(strings.Join(parts, "-"))
+	if name == "" {
+		name = "suggested"
+	}
+	candidate := name
+	for i := 2; ; i++ {
+		if _, exists := scripts[candidate]; !exists {
+			break
+		}
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	return candidate
+}
+
+// NewSuggestCommand returns the 'suggest' command
+func NewSuggestCommand() *cobra.Command {
+	var files []string
+	var minCount, top int
+	cmd := &cobra.Command{
+		Use:   "suggest",
+		Short: "Suggest gadgets from commands you run often",
+		Long: `Look through your PowerShell (PSReadLine), bash and zsh history for commands
+you run again and again with different values, like paths, numbers or host
+names. Each group is shown with a proposed gadget, where the values that change
+become {{variables}}, and you can save the ones you like.`,
+		Example: `  GoGoGadget suggest
+  GoGoGadget suggest --min 5 --top 5
+  GoGoGadget suggest --history .\old_history.txt`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sources := defaultHistoryFiles()
+			if len(files) > 0 {
+				sources = nil
+				for _, path := range files {
+					sources = append(sources, historyFile{Path: path, Shell: historyShell(path)})
+				}
+			}
+			var entries []historyEntry
+			read := 0
+			for _, src := range sources {
+				e, err := readHistory(src)
+				if os.IsNotExist(err) && len(files) == 0 {
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("could not read history %s: %w", src.Path, err)
+				}
+				infoText(fmt.Sprintf("Read %d commands from %s", len(e), src.Path))
+				entries = append(entries, e...)
+				read++
+			}
+			if read == 0 {
+				warnText("⚠️ No history files found. Looked for:")
+				for _, src := range sources {
+					warnText("   " + src.Path)
+				}
+				return nil
+			}
+
+			scripts, err := loadScripts()
+			if err != nil {
+				return err
+			}
+			existing := existingCommands(scripts)
+			var suggestions []*suggestion
+			for _, s := range clusterHistory(entries, minCount) {
+				s.parameterize()
+				if !existing[s.Command] {
+					suggestions = append(suggestions, s)
+				}
+			}
+			if top > 0 && len(suggestions) > top {
+				suggestions = suggestions[:top]
+			}
+			if len(suggestions) == 0 {
+				warnText(fmt.Sprintf("No commands were run at least %d times with different values. Try a lower --min.", minCount))
+				return nil
+			}
+
+			interactive := term.IsTerminal(int(os.Stdin.Fd()))
+			reader := bufio.NewReader(os.Stdin)
+			out := colorable.NewColorableStdout()
+			saved := 0
+			for i, s := range suggestions {
+				fmt.Fprintln(out)
+				colorText.Green(fmt.Sprintf("%d. Used %d times:", i+1, s.Count))
+				for j, e := range s.Examples {
+					if j == 3 {
+						infoText(fmt.Sprintf("   … and %d more", len(s.Examples)-3))
+						break
+					}
+					infoText("   " + strings.Join(e, " "))
+				}
+				fmt.Fprintf(out, "   Proposed gadget: \x1b[1;33m%s\x1b[0m\n", s.Command)
+				if s.Shell != HistoryPowerShell {
+					warnText(fmt.Sprintf("   From your %s history; check that it works in PowerShell before saving.", s.Shell))
+				}
+				if !interactive {
+					continue
+				}
+
+				name := suggestGadgetName(s.Examples[0], scripts)
+				fmt.Fprintf(out, "\x1b[36m   Save as gadget? Enter a name [%s], 's' to skip or 'q' to stop: \x1b[0m", name)
+				answer, _ := reader.ReadString('\n')
+				answer = strings.TrimSpace(answer)
+				switch strings.ToLower(answer) {
+				case "q":
+					return nil
+				case "s", "n", "no", "skip":
+					continue
+				case "", "y", "yes":
+					answer = name
+				}
+				if !gogo.ValidName(answer) {
+					warnText("   ⚠️ Gadget names can only use letters, numbers, dashes or underscores; skipped.")
+					continue
+				}
+				if _, exists := scripts[answer]; exists {
+					warnText(fmt.Sprintf("   ⚠️ A gadget named '%s' already exists; skipped.", answer))
+					continue
+				}
+				fmt.Fprint(out, "\x1b[36m   Description: \x1b[0m")
+				desc, _ := reader.ReadString('\n')
+				desc = strings.TrimSpace(desc)
+				if desc == "" {
+					desc = "Suggested from history: " + strings.Join(s.Examples[0], " ")
+				}
+				scripts[answer] = gogo.Gadget{Description: desc, Command: s.Command, Variables: s.Variables}
+				if err := saveScripts(scripts); err != nil {
+					return err
+				}
+				successText(fmt.Sprintf("   ✅ Saved '%s'", answer))
+				warnIfDangerous(answer)
+				saved++
+			}
+			if !interactive {
+				fmt.Fprintln(out)
+				infoText("Run 'GoGoGadget suggest' in a terminal to save suggestions, or add them with 'GoGoGadget add'.")
+			} else if saved > 0 {
+				fmt.Fprintln(out)
+				successText(fmt.Sprintf("✅ Saved %d new gadgets.", saved))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&files, "history", nil, "History file to read instead of the usual ones (repeatable); zsh and bash files are recognized by name")
+	cmd.Flags().IntVar(&minCount, "min", 3, "Only suggest commands used at least this many times")
+	cmd.Flags().IntVar(&top, "top", 10, "Show at most this many suggestions (0 for all)")
+	return cmd
+}
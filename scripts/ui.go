@@ -0,0 +1,992 @@
+package scripts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"gogo/gogo"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-colorable"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// uiMode is what the gadget browser is doing
+type uiMode int
+
+const (
+	uiBrowse uiMode = iota
+	uiSearch
+	uiForm
+	uiConfirmRun
+	uiRunning
+	uiShowOutput
+	uiEdit
+	uiConfirmDelete
+)
+
+// uiOutput collects a run's output for the output pane
+type uiOutput struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	redraw chan<- struct{}
+}
+
+func (o *uiOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	o.buf.Write(p)
+	o.mu.Unlock()
+	select {
+	case o.redraw <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// String returns the output so far, cleaned up for display
+func (o *uiOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return cleanOutput(o.buf.String())
+}
+
+// uiRunResult is how a run started from the browser ended
+type uiRunResult struct {
+	Runs, Failed int
+	Err          error
+}
+
+// gadgetBrowser is the state of 'GoGoGadget ui'
+type gadgetBrowser struct {
+	ctx      context.Context
+	scripts  gogo.Library
+	policies []Policy
+	owners   map[string]string
+
+	search   *textField
+	names    []string // gadgets matching the search
+	selected int
+	listTop  int
+	mode     uiMode
+
+	// message replaces the status line until the next key
+	message, messageColor string
+
+	// Variable form and edit form
+	fields   []*textField
+	focus    int
+	formVars []string
+
+	// The current or last run
+	runName   string
+	runs      []map[string]string
+	runLabels []string
+	output    *uiOutput
+	scroll    int // output lines scrolled up from the bottom
+	stop      context.CancelCauseFunc
+	intr      *gogo.Interrupt
+	redraw    chan struct{}
+	finished  chan uiRunResult
+}
+
+// NewUICommand creates the 'ui' command, a full-screen browser for gadgets
+func NewUICommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ui [search]",
+		Short: "Browse, run, edit and delete gadgets in a full-screen view",
+		Long: `Browse your gadgets in a full-screen view: search the list, see each gadget's
+command and variables, fill in the variables and watch the output as it runs.
+Gadgets can be edited and deleted from the same screen.
+
+Keys are shown at the bottom of the screen. Without an interactive terminal
+the plain gadget list is printed instead.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+				warnText("⚠️ 'GoGoGadget ui' needs an interactive terminal, so here is the plain list instead.")
+				printGadgetList()
+				return nil
+			}
+			b := &gadgetBrowser{
+				ctx:      cmd.Context(),
+				search:   newTextField("Search", "", strings.Join(args, " ")),
+				redraw:   make(chan struct{}, 1),
+				finished: make(chan uiRunResult, 1),
+			}
+			if err := b.reload(""); err != nil {
+				return err
+			}
+			return b.loop()
+		},
+	}
+}
+
+// loop shows the browser until the user quits
+func (b *gadgetBrowser) loop() error {
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("could not set up the terminal: %w", err)
+	}
+	scr := &screen{out: colorable.NewColorableStdout()}
+	var once sync.Once
+	restore := func() {
+		once.Do(func() {
+			scr.leave()
+			_ = term.Restore(fd, oldState)
+		})
+	}
+	interruptCleanup.Store(&restore)
+	defer interruptCleanup.Store(nil)
+	defer restore()
+	scr.enter()
+
+	keys := make(chan uiKey, 16)
+	go readKeys(os.Stdin, keys)
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	interrupted := b.ctx.Done()
+	dirty := true
+	for {
+		if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil && (w != scr.width || h != scr.height) {
+			scr.width, scr.height = w, h
+			dirty = true
+		}
+		if dirty {
+			scr.draw(b.view(scr.width, scr.height))
+			dirty = false
+		}
+
+		select {
+		case <-interrupted:
+			// Stopped from outside, e.g. by SIGTERM: let a run finish stopping first
+			if b.mode != uiRunning {
+				return &ExitCodeError{Code: gogo.ExitInterrupted}
+			}
+			interrupted = nil
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if quit := b.handleKey(k); quit {
+				return nil
+			}
+			dirty = true
+		case res := <-b.finished:
+			b.runFinished(res)
+			if b.ctx.Err() != nil {
+				return &ExitCodeError{Code: gogo.ExitInterrupted}
+			}
+			dirty = true
+		case <-b.redraw:
+			dirty = true
+		case <-ticker.C:
+		}
+	}
+}
+
+// reload reads the gadgets again and selects name, or keeps the current
+// selection when name is empty
+func (b *gadgetBrowser) reload(name string) error {
+	scripts, err := loadScripts()
+	if err != nil {
+		return err
+	}
+	b.scripts = scripts
+	b.policies, _ = loadPolicies() // A broken policy is reported when a gadget runs
+	packs, _ := loadPacks()
+	b.owners = packOwners(packs)
+	if name == "" {
+		name = b.current()
+	}
+	b.filter(name)
+	return nil
+}
+
+// filter updates the gadget list for the search text, keeping name selected
+// if it still matches
+func (b *gadgetBrowser) filter(name string) {
+	query := strings.ToLower(strings.TrimSpace(b.search.String()))
+	b.names = b.names[:0]
+	for _, n := range b.scripts.Names() {
+		if query == "" || strings.Contains(strings.ToLower(n), query) ||
+			strings.Contains(strings.ToLower(b.scripts[n].Description), query) {
+			b.names = append(b.names, n)
+		}
+	}
+	b.selected = 0
+	for i, n := range b.names {
+		if n == name {
+			b.selected = i
+		}
+	}
+}
+
+// current returns the selected gadget's name, or "" when the list is empty
+func (b *gadgetBrowser) current() string {
+	if b.selected < len(b.names) {
+		return b.names[b.selected]
+	}
+	return ""
+}
+
+func (b *gadgetBrowser) setMessage(color, msg string) {
+	b.messageColor, b.message = color, msg
+}
+
+// handleKey reacts to a key and reports whether the browser should close
+func (b *gadgetBrowser) handleKey(k uiKey) bool {
+	b.message = ""
+	switch b.mode {
+	case uiBrowse:
+		return b.handleBrowseKey(k)
+	case uiSearch:
+		b.handleSearchKey(k)
+	case uiForm, uiEdit:
+		b.handleFormKey(k)
+	case uiConfirmRun:
+		if k.Code == keyRune && (k.Rune == 'y' || k.Rune == 'Y') {
+			b.startRun()
+			return false
+		}
+		b.setMessage(colorYellow, "⚠️ Not run.")
+		b.mode = uiBrowse
+	case uiConfirmDelete:
+		if k.Code == keyRune && (k.Rune == 'y' || k.Rune == 'Y') {
+			b.deleteGadget()
+		} else {
+			b.setMessage(colorYellow, "Not deleted.")
+		}
+		b.mode = uiBrowse
+	case uiRunning:
+		switch k.Code {
+		case keyEsc, keyCtrlC:
+			b.stopRun()
+		default:
+			b.scrollOutput(k)
+		}
+	case uiShowOutput:
+		switch {
+		case k.Code == keyEsc || k.Code == keyEnter || (k.Code == keyRune && k.Rune == 'q'):
+			b.mode = uiBrowse
+		case k.Code == keyRune && k.Rune == 'r':
+			b.confirmRun()
+		default:
+			b.scrollOutput(k)
+		}
+	}
+	return false
+}
+
+func (b *gadgetBrowser) handleBrowseKey(k uiKey) bool {
+	if b.moveSelection(k) {
+		return false
+	}
+	switch k.Code {
+	case keyEsc:
+		if b.search.String() == "" {
+			return true
+		}
+		b.search = newTextField("Search", "", "")
+		b.filter(b.current())
+	case keyCtrlC:
+		return true
+	case keyEnter:
+		b.openForm()
+	case keyDelete:
+		b.confirmDelete()
+	case keyRune:
+		switch k.Rune {
+		case 'q':
+			return true
+		case '/':
+			b.mode = uiSearch
+		case 'r':
+			b.openForm()
+		case 'e':
+			b.openEdit()
+		case 'd':
+			b.confirmDelete()
+		case 'o':
+			if b.output != nil {
+				b.mode, b.scroll = uiShowOutput, 0
+			}
+		}
+	}
+	return false
+}
+
+func (b *gadgetBrowser) handleSearchKey(k uiKey) {
+	if b.moveSelection(k) {
+		return
+	}
+	switch k.Code {
+	case keyEnter:
+		b.mode = uiBrowse
+	case keyEsc, keyCtrlC:
+		b.search = newTextField("Search", "", "")
+		b.filter(b.current())
+		b.mode = uiBrowse
+	default:
+		if b.search.handle(k) {
+			b.filter(b.current())
+		}
+	}
+}
+
+// moveSelection handles the keys that move through the gadget list
+func (b *gadgetBrowser) moveSelection(k uiKey) bool {
+	vim := b.mode == uiBrowse && k.Code == keyRune
+	switch {
+	case k.Code == keyUp || (vim && k.Rune == 'k'):
+		b.selected--
+	case k.Code == keyDown || (vim && k.Rune == 'j'):
+		b.selected++
+	case k.Code == keyPageUp:
+		b.selected -= 10
+	case k.Code == keyPageDown:
+		b.selected += 10
+	case k.Code == keyHome && b.mode == uiBrowse:
+		b.selected = 0
+	case k.Code == keyEnd && b.mode == uiBrowse:
+		b.selected = len(b.names) - 1
+	default:
+		return false
+	}
+	b.selected = max(0, min(b.selected, len(b.names)-1))
+	return true
+}
+
+func (b *gadgetBrowser) handleFormKey(k uiKey) {
+	last := len(b.fields) - 1
+	switch k.Code {
+	case keyEsc, keyCtrlC:
+		b.mode = uiBrowse
+		return
+	case keyTab, keyDown:
+		b.focus = min(b.focus+1, last)
+		return
+	case keyShiftTab, keyUp:
+		b.focus = max(b.focus-1, 0)
+		return
+	case keyCtrlS:
+		b.submitForm()
+		return
+	}
+	if len(b.fields) > 0 && b.fields[b.focus].handle(k) {
+		return
+	}
+	if k.Code == keyEnter {
+		if b.focus < last {
+			b.focus++
+		} else {
+			b.submitForm()
+		}
+	}
+}
+
+func (b *gadgetBrowser) submitForm() {
+	if b.mode == uiEdit {
+		b.saveEdit()
+		return
+	}
+	name, config := b.runName, b.scripts[b.runName]
+	given := map[string][]string{}
+	for i, v := range b.formVars {
+		if value := b.fields[i].String(); value != "" {
+			given[v] = []string{value}
+		}
+	}
+	// Like an empty answer at the prompt, a variable left empty is run empty
+	resolver := gogo.Resolver{Prompt: func(string, gogo.Gadget) (string, error) { return "", nil }}
+	values, err := resolver.Values(b.formVars, config, given)
+	if err != nil {
+		b.setMessage(colorRed, "❌ "+err.Error())
+		return
+	}
+	b.runs = gogo.Combinations(b.formVars, values)
+	b.runLabels = labelVariables(b.formVars, values)
+	b.runName = name
+	b.confirmRun()
+}
+
+// openForm shows the variables of the selected gadget, filled in with their
+// defaults, or goes straight to running it when it has none
+func (b *gadgetBrowser) openForm() {
+	name := b.current()
+	if name == "" {
+		return
+	}
+	config := b.scripts[name]
+	if _, err := checkPolicy(name, config, b.scripts); err != nil {
+		b.setMessage(colorRed, "⛔ "+err.Error())
+		return
+	}
+	b.runName = name
+	b.formVars = gogo.VariableNames(name, config, b.scripts)
+	b.fields, b.focus = nil, 0
+	for _, v := range b.formVars {
+		def, _ := config.VariableDefault(v)
+		b.fields = append(b.fields, newTextField(v, variableHint(config, v), def))
+	}
+	if len(b.fields) == 0 {
+		b.runs, b.runLabels = []map[string]string{{}}, nil
+		b.confirmRun()
+		return
+	}
+	b.mode = uiForm
+}
+
+// variableHint describes a variable's description, type and list setting
+func variableHint(config gogo.Gadget, varName string) string {
+	hint := config.VariableDescription(varName)
+	var extras []string
+	if config.IsListVariable(varName) {
+		extras = append(extras, "list: separate with commas")
+	}
+	if typ := config.VariableOptions[varName].Type; typ != "" {
+		extras = append(extras, typ)
+	}
+	if len(extras) > 0 {
+		hint += " (" + strings.Join(extras, ", ") + ")"
+	}
+	return hint
+}
+
+// confirmRun asks before a dangerous gadget runs, and otherwise runs it
+func (b *gadgetBrowser) confirmRun() {
+	config := b.scripts[b.runName]
+	if len(gadgetDangers(b.runName, config, b.scripts)) > 0 || config.Dangerous {
+		b.mode = uiConfirmRun
+		return
+	}
+	b.startRun()
+}
+
+// startRun runs the gadget in the background, once per set of variables,
+// with its output going to the output pane
+func (b *gadgetBrowser) startRun() {
+	name, config, scripts, runs, labels := b.runName, b.scripts[b.runName], b.scripts, b.runs, b.runLabels
+	ctx, stop := context.WithCancelCause(b.ctx)
+	b.stop, b.intr = stop, nil
+	out := &uiOutput{redraw: b.redraw}
+	b.output, b.scroll, b.mode = out, 0, uiRunning
+	if warning := signatureWarning(name, config, b.policies); warning != "" {
+		fmt.Fprintln(out, warning)
+	}
+
+	go func() {
+		defer stop(nil)
+		res := uiRunResult{Runs: len(runs)}
+		for i, vars := range runs {
+			if ctx.Err() != nil {
+				break
+			}
+			if len(runs) > 1 {
+				fmt.Fprintf(out, "── %d/%d %s ──\n", i+1, len(runs), runLabel(labels, vars))
+			}
+			runner := defaultRunner()
+			runner.Stdin, runner.Stdout, runner.Stderr = nil, out, out
+			// The keyboard belongs to the browser, so workflow steps can't ask for values
+			runner.Prompt = func(string, gogo.Gadget) (string, error) { return "", nil }
+			runner.Warn = func(msg string) { fmt.Fprintln(out, "⚠️ "+msg) }
+			start := time.Now()
+			err := runGadgetWithHooks(ctx, name, config, scripts, vars, runner)
+			recordRun(RunSourceUI, name, vars, start, err)
+			if err != nil {
+				res.Failed++
+				res.Err = err
+				if len(runs) > 1 {
+					fmt.Fprintf(out, "❌ %v\n", err)
+				}
+			}
+		}
+		b.finished <- res
+	}()
+}
+
+// stopRun interrupts the running gadget; a second stop kills it at once
+func (b *gadgetBrowser) stopRun() {
+	if b.intr != nil {
+		b.intr.Force()
+		return
+	}
+	b.intr = gogo.NewInterrupt(os.Interrupt)
+	b.stop(b.intr)
+}
+
+func (b *gadgetBrowser) runFinished(res uiRunResult) {
+	b.mode = uiShowOutput
+	switch {
+	case res.Err == nil:
+		b.setMessage(colorGreen, "✅ Gadget finished!")
+	case gogo.ExitCode(res.Err) == gogo.ExitInterrupted:
+		b.setMessage(colorYellow, "⚠️ Gadget stopped.")
+	case res.Runs > 1:
+		b.setMessage(colorRed, fmt.Sprintf("❌ %d of %d runs failed.", res.Failed, res.Runs))
+	default:
+		var policyErr *PolicyError
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(res.Err, &policyErr):
+			b.setMessage(colorRed, "⛔ "+res.Err.Error())
+		case errors.As(res.Err, &exitErr):
+			b.setMessage(colorRed, fmt.Sprintf("❌ The gadget failed with exit code %d.", exitErr.ExitCode()))
+		default:
+			b.setMessage(colorRed, "❌ "+res.Err.Error())
+		}
+	}
+}
+
+func (b *gadgetBrowser) scrollOutput(k uiKey) {
+	switch k.Code {
+	case keyUp:
+		b.scroll++
+	case keyDown:
+		b.scroll--
+	case keyPageUp:
+		b.scroll += 10
+	case keyPageDown:
+		b.scroll -= 10
+	case keyHome:
+		b.scroll = 1 << 30
+	case keyEnd:
+		b.scroll = 0
+	}
+	b.scroll = max(b.scroll, 0)
+}
+
+// openEdit shows the selected gadget's settings as a form
+func (b *gadgetBrowser) openEdit() {
+	name := b.current()
+	if name == "" {
+		return
+	}
+	config := b.scripts[name]
+	b.runName = name
+	b.fields = []*textField{
+		newTextField("Name", "letters, numbers, dashes and underscores", name),
+		newTextField("Description", "", config.Description),
+	}
+	if !config.IsWorkflow() {
+		command := newTextField("Command", "Enter adds a line", config.Command)
+		command.Multiline = true
+		b.fields = append(b.fields, command)
+	}
+	b.fields = append(b.fields,
+		newTextField("Working folder", "may use {{variables}}", config.Workdir),
+		newTextField("Timeout", "e.g. 30s or 5m; empty for none", config.Timeout))
+	b.formVars = gogo.VariableNames(name, config, b.scripts)
+	for _, v := range b.formVars {
+		b.fields = append(b.fields, newTextField("{{"+v+"}}", "description", config.Variables[v]))
+	}
+	b.focus = 0
+	b.mode = uiEdit
+}
+
+// saveEdit checks the edit form and saves the gadget
+func (b *gadgetBrowser) saveEdit() {
+	oldName := b.runName
+	config := b.scripts[oldName]
+	field := func(label string) string {
+		for _, f := range b.fields {
+			if f.Label == label {
+				return strings.TrimSpace(f.String())
+			}
+		}
+		return ""
+	}
+
+	newName := field("Name")
+	if !gogo.ValidName(newName) {
+		b.setMessage(colorRed, "❌ Gadget names can only use letters, numbers, dashes and underscores.")
+		return
+	}
+	if _, taken := b.scripts[newName]; taken && newName != oldName {
+		b.setMessage(colorRed, fmt.Sprintf("❌ There is already a gadget called '%s'.", newName))
+		return
+	}
+	config.Description = field("Description")
+	if !config.IsWorkflow() {
+		config.Command = strings.TrimRight(field("Command"), "\n")
+		if config.Command == "" {
+			b.setMessage(colorRed, "❌ The command can't be empty.")
+			return
+		}
+	}
+	config.Workdir = field("Working folder")
+	if err := applyRunSettings(&config, nil, field("Timeout")); err != nil {
+		b.setMessage(colorRed, "❌ "+err.Error())
+		return
+	}
+
+	// Keep the descriptions of variables still in use and pick up new ones
+	descriptions := map[string]string{}
+	for v, desc := range config.Variables {
+		descriptions[v] = desc
+	}
+	for _, v := range b.formVars {
+		descriptions[v] = field("{{" + v + "}}")
+	}
+	config.Variables = map[string]string{}
+	for _, v := range gogo.VariableNames(newName, config, b.scripts) {
+		config.Variables[v] = descriptions[v]
+	}
+
+	signed := config.Signature != nil
+	if signed && checkSignature(newName, config) != nil {
+		config.Signature = nil
+	}
+	wasDangerous := config.Dangerous
+	scripts := b.scripts
+	if newName != oldName {
+		delete(scripts, oldName)
+		renameSteps(scripts, map[string]string{oldName: newName})
+	}
+	scripts[newName] = config
+	if err := saveScripts(scripts); err != nil {
+		b.setMessage(colorRed, fmt.Sprintf("❌ Error saving gadget: %v", err))
+		return
+	}
+	if err := b.reload(newName); err != nil {
+		b.setMessage(colorRed, fmt.Sprintf("❌ Error loading your gadgets: %v", err))
+		return
+	}
+	b.mode = uiBrowse
+	switch {
+	case b.scripts[newName].Dangerous && !wasDangerous:
+		b.setMessage(colorYellow, fmt.Sprintf("⚠️ Saved. '%s' is now marked dangerous and will ask before it runs.", newName))
+	case signed && config.Signature == nil:
+		b.setMessage(colorYellow, fmt.Sprintf("⚠️ Saved. The signature was removed because the gadget changed; sign it again with 'GoGoGadget sign %s'.", newName))
+	default:
+		b.setMessage(colorGreen, "✅ Gadget saved.")
+	}
+}
+
+func (b *gadgetBrowser) confirmDelete() {
+	if b.current() != "" {
+		b.mode = uiConfirmDelete
+	}
+}
+
+func (b *gadgetBrowser) deleteGadget() {
+	name := b.current()
+	delete(b.scripts, name)
+	if err := saveScripts(b.scripts); err != nil {
+		b.setMessage(colorRed, fmt.Sprintf("❌ Error deleting gadget: %v", err))
+		return
+	}
+	selected := b.selected
+	if err := b.reload(""); err != nil {
+		b.setMessage(colorRed, fmt.Sprintf("❌ Error loading your gadgets: %v", err))
+		return
+	}
+	b.selected = max(0, min(selected, len(b.names)-1))
+	b.setMessage(colorGreen, fmt.Sprintf("✅ Deleted '%s'.", name))
+}
+
+// Colors used by the browser
+const (
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorCyan    = "\x1b[36m"
+	colorMagenta = "\x1b[1;35m"
+	colorGray    = "\x1b[90m"
+	colorReset   = "\x1b[0m"
+)
+
+// view draws the whole screen: the search bar, the gadget list next to the
+// current pane, a status line and the keys for the current mode
+func (b *gadgetBrowser) view(width, height int) []string {
+	if width < 40 || height < 10 {
+		return []string{colorYellow + "Make the window bigger to browse your gadgets." + colorReset}
+	}
+	lines := []string{b.header(width)}
+
+	bodyHeight := height - 3
+	listWidth := min(32, width/3)
+	paneWidth := width - listWidth - 3
+	list := b.listLines(listWidth, bodyHeight)
+	pane := b.paneLines(paneWidth, bodyHeight)
+	for i := 0; i < bodyHeight; i++ {
+		left, right := "", ""
+		if i < len(list) {
+			left = list[i]
+		}
+		if i < len(pane) {
+			right = pane[i]
+		}
+		lines = append(lines, fit(left, listWidth)+colorGray+" │ "+colorReset+right)
+	}
+
+	lines = append(lines, b.statusLine(), colorGray+b.keysLine()+colorReset)
+	return lines
+}
+
+func (b *gadgetBrowser) header(width int) string {
+	title := "\x1b[1;7;36m GoGoGadget \x1b[0m  "
+	label := colorGray + "/ search: " + colorReset
+	if b.mode == uiSearch {
+		label = colorCyan + "search: " + colorReset
+	}
+	count := fmt.Sprintf("  %s%d of %d%s", colorGray, len(b.names), len(b.scripts), colorReset)
+	room := width - textWidth(title+label+count)
+	return title + label + renderFieldLine(b.search.value, b.searchCursor(), room) + count
+}
+
+func (b *gadgetBrowser) searchCursor() int {
+	if b.mode == uiSearch {
+		return b.search.cursor
+	}
+	return -1
+}
+
+// listLines draws the gadget list, scrolled to keep the selection in view
+func (b *gadgetBrowser) listLines(width, height int) []string {
+	if len(b.scripts) == 0 {
+		return wrapText("No gadgets yet. Add one with 'GoGoGadget add'.", width)
+	}
+	if len(b.names) == 0 {
+		return wrapText("No gadgets match your search.", width)
+	}
+	if b.selected < b.listTop {
+		b.listTop = b.selected
+	}
+	if b.selected >= b.listTop+height {
+		b.listTop = b.selected - height + 1
+	}
+	b.listTop = max(0, min(b.listTop, len(b.names)-height))
+
+	var lines []string
+	for i := b.listTop; i < len(b.names) && len(lines) < height; i++ {
+		name := b.names[i]
+		mark := " "
+		if b.scripts[name].Dangerous {
+			mark = colorYellow + "!" + colorReset
+		}
+		line := " " + name
+		if i == b.selected {
+			line = "\x1b[7m" + fit("▶"+name, width-1) + colorReset
+		}
+		lines = append(lines, fit(line, width-1)+mark)
+	}
+	return lines
+}
+
+// paneLines draws the right-hand pane for the current mode
+func (b *gadgetBrowser) paneLines(width, height int) []string {
+	switch b.mode {
+	case uiForm:
+		return b.formLines(width, "▶ Run "+b.runName, b.commandPreview(width))
+	case uiEdit:
+		return b.formLines(width, "✏️  Edit "+b.runName, nil)
+	case uiConfirmRun:
+		return b.dangerLines(width)
+	case uiRunning, uiShowOutput:
+		return b.outputLines(width, height)
+	}
+	name := b.current()
+	if name == "" {
+		return nil
+	}
+	return b.detailLines(name, width)
+}
+
+// detailLines describes a gadget: its description, command and variables
+func (b *gadgetBrowser) detailLines(name string, width int) []string {
+	config := b.scripts[name]
+	lines := []string{colorMagenta + name + colorReset}
+	lines = append(lines, wrapText(config.Description, width)...)
+
+	var tags []string
+	if config.IsWorkflow() {
+		tags = append(tags, fmt.Sprintf("workflow, %d steps", len(config.Steps)))
+	}
+	if pack := b.owners[name]; pack != "" {
+		tags = append(tags, "pack "+pack)
+	}
+	if config.Signature != nil {
+		if who, ok := trustedKeyName(config.Signature.PublicKey, b.policies); ok && checkSignature(name, config) == nil {
+			tags = append(tags, "signed by "+who)
+		} else {
+			tags = append(tags, "signature not trusted")
+		}
+	}
+	if len(tags) > 0 {
+		lines = append(lines, colorGray+"("+strings.Join(tags, ", ")+")"+colorReset)
+	}
+	if config.Dangerous {
+		lines = append(lines, colorYellow+"⚠️ Dangerous: asks before it runs"+colorReset)
+	}
+	if len(gadgetPolicyViolations(name, config, b.scripts, b.policies)) > 0 {
+		lines = append(lines, colorRed+"⛔ Blocked by policy"+colorReset)
+	}
+
+	lines = append(lines, "")
+	if config.IsWorkflow() {
+		lines = append(lines, colorCyan+"Steps:"+colorReset)
+		for i, step := range config.Steps {
+			lines = append(lines, fmt.Sprintf("  %d) %s", i+1, formatWorkflowStep(step)))
+		}
+	} else {
+		lines = append(lines, colorCyan+"Command:"+colorReset)
+		for _, l := range strings.Split(config.Command, "\n") {
+			lines = append(lines, "  "+highlightPowerShell(l))
+		}
+	}
+
+	if varNames := gogo.VariableNames(name, config, b.scripts); len(varNames) > 0 {
+		lines = append(lines, "", colorCyan+"Variables:"+colorReset)
+		for _, v := range varNames {
+			line := fmt.Sprintf("  %s%s%s  %s", colorMagenta, v, colorReset, variableHint(config, v))
+			if def, ok := config.VariableDefault(v); ok {
+				line += fmt.Sprintf(" %sdefault %q%s", colorGray, def, colorReset)
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	settings := [][2]string{{"Working folder", config.Workdir}, {"Timeout", config.Timeout}, {"Before", config.Before}, {"After", config.After}}
+	for _, k := range sortedKeys(config.Env) {
+		settings = append(settings, [2]string{"$env:" + k, config.Env[k]})
+	}
+	first := true
+	for _, s := range settings {
+		if s[1] == "" {
+			continue
+		}
+		if first {
+			lines = append(lines, "")
+			first = false
+		}
+		lines = append(lines, fmt.Sprintf("%s%s:%s %s", colorCyan, s[0], colorReset, strings.ReplaceAll(s[1], "\n", " ⏎ ")))
+	}
+	return lines
+}
+
+// formLines draws a form with a label, hint and input for each field
+func (b *gadgetBrowser) formLines(width int, title string, footer []string) []string {
+	lines := []string{colorMagenta + title + colorReset, ""}
+	for i, f := range b.fields {
+		label := f.Label
+		if i == b.focus {
+			label = colorCyan + "▶ " + label + colorReset
+		} else {
+			label = "  " + label
+		}
+		if f.Hint != "" {
+			label += "  " + colorGray + f.Hint + colorReset
+		}
+		lines = append(lines, label)
+		for _, l := range f.render(width-4, i == b.focus) {
+			lines = append(lines, "    "+l)
+		}
+	}
+	if len(footer) > 0 {
+		lines = append(append(lines, ""), footer...)
+	}
+	return lines
+}
+
+// commandPreview shows the command with the values typed so far
+func (b *gadgetBrowser) commandPreview(width int) []string {
+	config := b.scripts[b.runName]
+	if config.IsWorkflow() {
+		return nil
+	}
+	vars := map[string]string{}
+	for i, v := range b.formVars {
+		vars[v] = b.fields[i].String()
+	}
+	lines := []string{colorCyan + "Will run:" + colorReset}
+	for _, l := range strings.Split(gogo.RenderCommand(config.Command, vars), "\n") {
+		lines = append(lines, "  "+highlightPowerShell(l))
+	}
+	return lines
+}
+
+// dangerLines explains why a gadget asks before it runs
+func (b *gadgetBrowser) dangerLines(width int) []string {
+	lines := []string{colorYellow + fmt.Sprintf("⚠️ '%s' is marked dangerous because it:", b.runName) + colorReset}
+	for _, f := range gadgetDangers(b.runName, b.scripts[b.runName], b.scripts) {
+		msg := fmt.Sprintf("• %s: %s", f.Command, f.Reason)
+		if f.Gadget != b.runName {
+			msg += fmt.Sprintf(" (in '%s')", f.Gadget)
+		}
+		for _, l := range wrapText(msg, width-2) {
+			lines = append(lines, "  "+l)
+		}
+	}
+	if len(b.runs) > 1 {
+		lines = append(lines, "", fmt.Sprintf("It will run %d times.", len(b.runs)))
+	}
+	return lines
+}
+
+// outputLines shows the end of the run's output, or an earlier part when scrolled
+func (b *gadgetBrowser) outputLines(width, height int) []string {
+	title := colorMagenta + "▶ " + b.runName + colorReset
+	if b.mode == uiRunning {
+		title += colorGray + "  running…" + colorReset
+	}
+	var body []string
+	if b.output != nil {
+		body = wrapText(strings.TrimRight(b.output.String(), "\n"), width)
+	}
+	room := height - 1
+	end := len(body) - b.scroll
+	if end < room {
+		end = min(room, len(body))
+	}
+	b.scroll = len(body) - end
+	start := max(0, end-room)
+	return append([]string{title}, body[start:end]...)
+}
+
+func (b *gadgetBrowser) statusLine() string {
+	if b.message != "" {
+		return b.messageColor + b.message + colorReset
+	}
+	switch b.mode {
+	case uiConfirmRun:
+		return colorYellow + fmt.Sprintf("Run '%s' anyway? Press y to run, any other key to cancel.", b.runName) + colorReset
+	case uiConfirmDelete:
+		return colorYellow + fmt.Sprintf("Delete '%s'? Press y to delete, any other key to keep it.", b.current()) + colorReset
+	case uiRunning:
+		if b.intr != nil {
+			return colorYellow + "Stopping… press Esc again to stop it right away." + colorReset
+		}
+	case uiShowOutput:
+		if b.scroll > 0 {
+			return colorGray + fmt.Sprintf("Scrolled up %d lines.", b.scroll) + colorReset
+		}
+	}
+	return ""
+}
+
+func (b *gadgetBrowser) keysLine() string {
+	switch b.mode {
+	case uiSearch:
+		return "type to search · ↑↓ move · Enter done · Esc clear"
+	case uiForm:
+		return "Tab/↑↓ next field · Enter next, or run on the last field · Ctrl+S run · Esc back"
+	case uiEdit:
+		return "Tab/↑↓ next field · Ctrl+S save · Ctrl+U clear field · Esc cancel"
+	case uiRunning:
+		return "↑↓ PgUp PgDn scroll · Esc/Ctrl+C stop"
+	case uiShowOutput:
+		return "↑↓ PgUp PgDn scroll · r run again · Esc back"
+	case uiConfirmRun, uiConfirmDelete:
+		return "y yes · any other key no"
+	}
+	return "↑↓ move · / search · Enter run · e edit · d delete · o last output · q quit"
+}
@@ -0,0 +1,387 @@
+package scripts
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keyCode is a key the gadget browser reacts to
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyEnter
+	keyEsc
+	keyBackspace
+	keyDelete
+	keyTab
+	keyShiftTab
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyPageUp
+	keyPageDown
+	keyCtrlC
+	keyCtrlS
+	keyCtrlU
+	keyUnknown
+)
+
+// uiKey is one key press; Rune is set for keyRune
+type uiKey struct {
+	Code keyCode
+	Rune rune
+}
+
+// escapeKeys maps the escape sequences terminals send for special keys,
+// without the leading ESC
+var escapeKeys = map[string]keyCode{
+	"[A": keyUp, "[B": keyDown, "[C": keyRight, "[D": keyLeft,
+	"OA": keyUp, "OB": keyDown, "OC": keyRight, "OD": keyLeft,
+	"[H": keyHome, "[F": keyEnd, "OH": keyHome, "OF": keyEnd,
+	"[1~": keyHome, "[7~": keyHome, "[4~": keyEnd, "[8~": keyEnd,
+	"[3~": keyDelete, "[5~": keyPageUp, "[6~": keyPageDown, "[Z": keyShiftTab,
+}
+
+// readKeys sends the keys read from r until reading fails, then closes keys
+func readKeys(r io.Reader, keys chan<- uiKey) {
+	buf := make([]byte, 256)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		for b := buf[:n]; len(b) > 0; {
+			k, size := decodeKey(b)
+			keys <- k
+			b = b[size:]
+		}
+	}
+}
+
+// decodeKey reads the first key in b and returns it with the number of bytes it used
+func decodeKey(b []byte) (uiKey, int) {
+	switch c := b[0]; {
+	case c == 0x1b:
+		if len(b) > 1 && (b[1] == '[' || b[1] == 'O') {
+			// Parameters, then a final byte between @ and ~
+			for i := 2; i < len(b); i++ {
+				if b[i] >= 0x40 && b[i] <= 0x7e {
+					code, ok := escapeKeys[string(b[1:i+1])]
+					if !ok {
+						code = keyUnknown
+					}
+					return uiKey{Code: code}, i + 1
+				}
+			}
+			return uiKey{Code: keyUnknown}, len(b)
+		}
+		return uiKey{Code: keyEsc}, 1
+	case c == '\r' || c == '\n':
+		return uiKey{Code: keyEnter}, 1
+	case c == 0x7f || c == 0x08:
+		return uiKey{Code: keyBackspace}, 1
+	case c == '\t':
+		return uiKey{Code: keyTab}, 1
+	case c == 0x03:
+		return uiKey{Code: keyCtrlC}, 1
+	case c == 0x13:
+		return uiKey{Code: keyCtrlS}, 1
+	case c == 0x15:
+		return uiKey{Code: keyCtrlU}, 1
+	case c < 0x20:
+		return uiKey{Code: keyUnknown}, 1
+	}
+	r, size := utf8.DecodeRune(b)
+	return uiKey{Code: keyRune, Rune: r}, size
+}
+
+// ansiRe matches terminal escape sequences such as colors
+var ansiRe = regexp.MustCompile(`^(\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-Z\\-_])`)
+
+// stripANSI removes escape sequences from s
+func stripANSI(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] == 0x1b {
+			if m := ansiRe.FindStringIndex(s[i:]); m != nil {
+				i += m[1]
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
+
+// runeWidth returns how many columns a terminal uses for r
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x20 || r == 0x7f:
+		return 0
+	case unicode.Is(unicode.Mn, r) || r == 0x200d || (r >= 0xfe00 && r <= 0xfe0f):
+		return 0
+	case r >= 0x1100 && (r <= 0x115f ||
+		(r >= 0x2e80 && r <= 0xa4cf) || (r >= 0xac00 && r <= 0xd7a3) ||
+		(r >= 0xf900 && r <= 0xfaff) || (r >= 0xfe30 && r <= 0xfe4f) ||
+		(r >= 0xff00 && r <= 0xff60) || (r >= 0xffe0 && r <= 0xffe6) ||
+		(r >= 0x1f300 && r <= 0x1f64f) || (r >= 0x1f900 && r <= 0x1faff) ||
+		(r >= 0x20000 && r <= 0x3fffd)):
+		return 2
+	}
+	return 1
+}
+
+// textWidth returns how many columns s uses, ignoring escape sequences
+func textWidth(s string) int {
+	w := 0
+	for _, r := range stripANSI(s) {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+// fit cuts s, which may contain colors, to width columns, ending with … when
+// something was cut, and pads it with spaces to exactly width columns
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if w := textWidth(s); w <= width {
+		return s + "\x1b[0m" + strings.Repeat(" ", width-w)
+	}
+	var b strings.Builder
+	used := 0
+	for i := 0; i < len(s); {
+		if s[i] == 0x1b {
+			if m := ansiRe.FindStringIndex(s[i:]); m != nil {
+				b.WriteString(s[i : i+m[1]])
+				i += m[1]
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if used+runeWidth(r) > width-1 {
+			break
+		}
+		b.WriteRune(r)
+		used += runeWidth(r)
+		i += size
+	}
+	b.WriteString("…\x1b[0m")
+	return b.String() + strings.Repeat(" ", width-used-1)
+}
+
+// wrapText breaks plain text into lines of at most width columns, at spaces
+// where it can
+func wrapText(s string, width int) []string {
+	if width <= 0 {
+		return nil
+	}
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		line, lineWidth := "", 0
+		for i, word := range strings.Split(para, " ") {
+			// Spaces are kept, including indentation, except where a line breaks
+			if i > 0 {
+				if lineWidth > 0 && lineWidth+1+textWidth(word) > width {
+					lines = append(lines, line)
+					line, lineWidth = "", 0
+				} else if lineWidth < width {
+					line += " "
+					lineWidth++
+				}
+			}
+			// Words longer than a line are split wherever they reach the edge
+			for _, r := range word {
+				if lineWidth+runeWidth(r) > width {
+					lines = append(lines, line)
+					line, lineWidth = "", 0
+				}
+				line += string(r)
+				lineWidth += runeWidth(r)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// cleanOutput makes a gadget's output safe to show in a pane: colors and other
+// control sequences are removed, and a carriage return (used for progress
+// bars) keeps only the text after it
+func cleanOutput(s string) string {
+	s = stripANSI(strings.ReplaceAll(s, "\r\n", "\n"))
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if i := strings.LastIndex(line, "\r"); i >= 0 {
+			line = line[i+1:]
+		}
+		line = strings.ReplaceAll(line, "\t", "    ")
+		lines = append(lines, strings.Map(func(r rune) rune {
+			if r < 0x20 || r == 0x7f {
+				return -1
+			}
+			return r
+		}, line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// screen draws whole frames on the terminal's alternate screen
+type screen struct {
+	out           io.Writer
+	width, height int
+}
+
+// enter switches to the alternate screen, hides the cursor and turns off line wrapping
+func (s *screen) enter() {
+	fmt.Fprint(s.out, "\x1b[?1049h\x1b[?25l\x1b[?7l\x1b[2J")
+}
+
+// leave puts the terminal back the way it was
+func (s *screen) leave() {
+	fmt.Fprint(s.out, "\x1b[0m\x1b[?7h\x1b[?25h\x1b[?1049l")
+}
+
+// draw replaces the screen with lines, one per row
+func (s *screen) draw(lines []string) {
+	var b strings.Builder
+	for i := 0; i < s.height; i++ {
+		line := ""
+		if i < len(lines) {
+			line = lines[i]
+		}
+		fmt.Fprintf(&b, "\x1b[%d;1H%s", i+1, fit(line, s.width))
+	}
+	io.WriteString(s.out, b.String())
+}
+
+// textField is an editable piece of text in a form
+type textField struct {
+	Label string
+	// Hint is shown next to the label, e.g. a variable's type
+	Hint string
+	// Multiline fields take Enter as a line break
+	Multiline bool
+	value     []rune
+	cursor    int
+}
+
+func newTextField(label, hint, value string) *textField {
+	v := []rune(value)
+	return &textField{Label: label, Hint: hint, value: v, cursor: len(v)}
+}
+
+// String returns the text in the field
+func (f *textField) String() string {
+	return string(f.value)
+}
+
+// handle applies an editing key and reports whether the key was used
+func (f *textField) handle(k uiKey) bool {
+	switch k.Code {
+	case keyRune:
+		f.insert(k.Rune)
+	case keyEnter:
+		if !f.Multiline {
+			return false
+		}
+		f.insert('\n')
+	case keyBackspace:
+		if f.cursor > 0 {
+			f.value = append(f.value[:f.cursor-1], f.value[f.cursor:]...)
+			f.cursor--
+		}
+	case keyDelete:
+		if f.cursor < len(f.value) {
+			f.value = append(f.value[:f.cursor], f.value[f.cursor+1:]...)
+		}
+	case keyLeft:
+		if f.cursor > 0 {
+			f.cursor--
+		}
+	case keyRight:
+		if f.cursor < len(f.value) {
+			f.cursor++
+		}
+	case keyHome:
+		f.cursor = 0
+	case keyEnd:
+		f.cursor = len(f.value)
+	case keyCtrlU:
+		f.value, f.cursor = nil, 0
+	default:
+		return false
+	}
+	return true
+}
+
+func (f *textField) insert(r rune) {
+	f.value = append(f.value[:f.cursor], append([]rune{r}, f.value[f.cursor:]...)...)
+	f.cursor++
+}
+
+// render returns the field's text as lines of at most width columns, showing
+// the cursor when the field has focus. Long lines scroll to keep the cursor in view.
+func (f *textField) render(width int, focused bool) []string {
+	var lines []string
+	start := 0
+	for i := 0; i <= len(f.value); i++ {
+		if i < len(f.value) && f.value[i] != '\n' {
+			continue
+		}
+		cursor := -1
+		if focused && f.cursor >= start && f.cursor <= i {
+			cursor = f.cursor - start
+		}
+		lines = append(lines, renderFieldLine(f.value[start:i], cursor, width))
+		start = i + 1
+	}
+	return lines
+}
+
+// renderFieldLine draws one line of a field with the cursor at index cursor,
+// or without a cursor when it is -1
+func renderFieldLine(line []rune, cursor, width int) string {
+	start := 0
+	for cursor >= 0 && start < cursor && runesWidth(line[start:cursor]) > width-2 {
+		start++
+	}
+	var b strings.Builder
+	used := 0
+	for i := start; i <= len(line); i++ {
+		if i == cursor {
+			ch := " "
+			if i < len(line) {
+				ch = string(line[i])
+			}
+			b.WriteString("\x1b[7m" + ch + "\x1b[27m")
+			used++
+			continue
+		}
+		if i == len(line) || used+runeWidth(line[i]) > width {
+			break
+		}
+		b.WriteRune(line[i])
+		used += runeWidth(line[i])
+	}
+	return b.String()
+}
+
+func runesWidth(rs []rune) int {
+	w := 0
+	for _, r := range rs {
+		w += runeWidth(r)
+	}
+	return w
+}
@@ -2,6 +2,7 @@ package scripts
 
 import (
 	"fmt"
+	"gogo/gogo"
 
 	"github.com/spf13/cobra"
 )
@@ -10,7 +11,7 @@ import (
 func ShowScriptVariables(scriptName string) {
 	scripts, err := loadScripts()
 	if err != nil {
-		colorText.Red("❌ Error loading user_scripts.json: " + err.Error())
+		colorText.Red("❌ Error loading your gadgets: " + err.Error())
 		return
 	}
 	config, ok := scripts[scriptName]
@@ -18,14 +19,17 @@ func ShowScriptVariables(scriptName string) {
 		colorText.Red(fmt.Sprintf("❌ Script '%s' not found.", scriptName))
 		return
 	}
-	varNames := extractVariables(config.Command)
+	varNames := gogo.VariableNames(scriptName, config, scripts)
 	if len(varNames) == 0 {
 		colorText.Yellow("This shortcut has no variables.")
 		return
 	}
 	colorText.Cyan(fmt.Sprintf("Variables for '%s':", scriptName))
 	for _, varName := range varNames {
-		desc := getVariableDescription(varName, config)
+		desc := config.VariableDescription(varName)
+		if config.IsListVariable(varName) {
+			desc += " (list)"
+		}
 		colorText.Green(fmt.Sprintf("  %s: ", varName))
 		fmt.Printf("%s\n", desc)
 	}
@@ -0,0 +1,219 @@
+package scripts
+
+import (
+	"context"
+	"fmt"
+	"gogo/gogo"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChangedFilesVariable holds the files that triggered a watch-mode run
+const ChangedFilesVariable = gogo.ChangedFilesVariable
+
+// watchPollInterval is how often watch mode looks for changed files
+var watchPollInterval = 500 * time.Millisecond
+
+// fileStamp is what watch mode compares to notice a file has changed
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshotGlobs returns the stamp of every file matching any of the patterns.
+// Patterns use '/' or the OS separator, '*' and '?' within a path segment, and
+// '**' for any number of folders (e.g. "src/**/*.ps1").
+func snapshotGlobs(patterns []string) map[string]fileStamp {
+	files := map[string]fileStamp{}
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		root := globRoot(pattern)
+		_ = filepath.WalkDir(filepath.FromSlash(root), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil // Unreadable or vanished: try again next poll
+			}
+			if d.IsDir() {
+				if name := d.Name(); path != filepath.FromSlash(root) && (name == ".git" || name == "node_modules") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !matchGlob(pattern, filepath.ToSlash(path)) {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				files[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// globRoot returns the folder a pattern starts in: everything before its first wildcard
+func globRoot(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	var root []string
+	for _, seg := range segments[:len(segments)-1] {
+		if strings.ContainsAny(seg, "*?[") {
+			break
+		}
+		root = append(root, seg)
+	}
+	if len(root) == 0 {
+		return "."
+	}
+	if len(root) == 1 && root[0] == "" {
+		return "/"
+	}
+	return strings.Join(root, "/")
+}
+
+// matchGlob reports whether a slash-separated path matches pattern, where '**'
+// matches any number of path segments
+func matchGlob(pattern, path string) bool {
+	path = strings.TrimPrefix(path, "./")
+	pattern = strings.TrimPrefix(pattern, "./")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(path, "/"))
+}
+
+func matchSegments(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+// changedFiles returns the files added, modified or removed between two snapshots
+func changedFiles(before, after map[string]fileStamp) []string {
+	var changed []string
+	for path, stamp := range after {
+		if old, ok := before[path]; !ok || old != stamp {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// formatChangedFiles joins paths for use in a command line, each in single
+// quotes so no character in a file name is read as code
+func formatChangedFiles(paths []string) string {
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = "'" + strings.ReplaceAll(p, "'", "''") + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// watchRunFunc runs the watched gadget once; changed is empty for the first run
+type watchRunFunc func(ctx context.Context, changed []string) error
+
+// runWatch runs the gadget once, then again whenever files matching the patterns
+// change. Changes are collected until none have arrived for the debounce period.
+// With cancelInFlight, a change stops a run that is still going and starts over.
+func runWatch(ctx context.Context, patterns []string, debounce time.Duration, cancelInFlight bool, run watchRunFunc) error {
+	colorText.Cyan(fmt.Sprintf("👀 Watching %s. Press Ctrl+C to stop.", strings.Join(patterns, ", ")))
+
+	prev := snapshotGlobs(patterns)
+	runDone := make(chan error, 1)
+	var cancelRun context.CancelFunc
+	running := false
+	start := func(changed []string) {
+		var runCtx context.Context
+		runCtx, cancelRun = context.WithCancel(ctx)
+		running = true
+		go func() { runDone <- run(runCtx, changed) }()
+	}
+	start(nil)
+
+	pending := map[string]bool{}
+	var lastChange time.Time
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if running {
+				<-runDone
+			}
+			warnText("⚠️ Stopped watching.")
+			return &ExitCodeError{Code: gogo.ExitInterrupted}
+		case err := <-runDone:
+			running = false
+			cancelRun()
+			switch {
+			case ctx.Err() != nil:
+				continue // Interrupted: handled above
+			case err == nil:
+				successText("✅ Gadget finished. Waiting for changes...")
+			case len(pending) > 0 && cancelInFlight:
+				warnText("⏹️  Run cancelled because files changed.")
+			default:
+				errorText(fmt.Sprintf("❌ Gadget failed: %v. Waiting for changes...", err))
+			}
+		case <-ticker.C:
+			cur := snapshotGlobs(patterns)
+			for _, path := range changedFiles(prev, cur) {
+				pending[path] = true
+				lastChange = time.Now()
+			}
+			prev = cur
+			if len(pending) == 0 || time.Since(lastChange) < debounce {
+				continue
+			}
+			if running {
+				if cancelInFlight {
+					cancelRun()
+				}
+				continue
+			}
+			changed := make([]string, 0, len(pending))
+			for path := range pending {
+				changed = append(changed, path)
+			}
+			sort.Strings(changed)
+			pending = map[string]bool{}
+			colorText.Cyan(fmt.Sprintf("🔄 Changed: %s", strings.Join(changed, ", ")))
+			start(changed)
+		}
+	}
+}
+
+// watchPatternsValid checks each pattern can be walked, to catch typos early
+func watchPatternsValid(patterns []string) error {
+	for _, pattern := range patterns {
+		root := globRoot(filepath.ToSlash(pattern))
+		if _, err := os.Stat(filepath.FromSlash(root)); err != nil {
+			return fmt.Errorf("can't watch '%s': %w", pattern, err)
+		}
+		if _, err := filepath.Match(filepath.Base(pattern), ""); err != nil {
+			return fmt.Errorf("can't watch '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package scripts
+
+import "testing"
+
+func TestFormatChangedFiles(t *testing.T) {
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"a.ps1"}, "'a.ps1'"},
+		{[]string{"my file.ps1", "b.ps1"}, "'my file.ps1' 'b.ps1'"},
+		{[]string{"it's.ps1"}, "'it''s.ps1'"},
+		{[]string{"$(Stop-Computer).ps1", "a;b.ps1"}, "'$(Stop-Computer).ps1' 'a;b.ps1'"},
+	}
+	for _, tt := range tests {
+		if got := formatChangedFiles(tt.paths); got != tt.want {
+			t.Errorf("formatChangedFiles(%q) = %q, want %q", tt.paths, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package scripts
+
+import (
+	"fmt"
+	"gogo/gogo"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// parseWorkflowStep parses a step written on the command line, e.g.
+//
+//	restart-vm name={{vm}} force=true --continue-on-error
+func parseWorkflowStep(spec string) (gogo.WorkflowStep, error) {
+	words, err := splitWords(spec)
+	if err != nil {
+		return gogo.WorkflowStep{}, err
+	}
+
+	fs := pflag.NewFlagSet("step", pflag.ContinueOnError)
+	continueOnError := fs.Bool("continue-on-error", false, "")
+	stop := fs.Bool("stop", false, "")
+	capture := fs.String("capture", "", "")
+	captureField := fs.String("capture-field", "", "")
+	if err := fs.Parse(words); err != nil {
+		return gogo.WorkflowStep{}, fmt.Errorf("step %q: %w", spec, err)
+	}
+	if *continueOnError && *stop {
+		return gogo.WorkflowStep{}, fmt.Errorf("step %q: use either --continue-on-error or --stop", spec)
+	}
+
+	rest := fs.Args()
+	if len(rest) == 0 {
+		return gogo.WorkflowStep{}, fmt.Errorf("step %q: missing gadget name", spec)
+	}
+	if *captureField != "" && *capture == "" {
+		return gogo.WorkflowStep{}, fmt.Errorf("step %q: --capture-field needs --capture to name the variable", spec)
+	}
+	if *capture != "" && !variableNameRe.MatchString(*capture) {
+		return gogo.WorkflowStep{}, fmt.Errorf("step %q: '%s' is not a valid variable name", spec, *capture)
+	}
+	step := gogo.WorkflowStep{
+		Gadget:          rest[0],
+		ContinueOnError: *continueOnError,
+		Capture:         *capture,
+		CaptureField:    *captureField,
+	}
+	for _, kv := range rest[1:] {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return gogo.WorkflowStep{}, fmt.Errorf("step %q: expected variable=value, got %q", spec, kv)
+		}
+		if step.Variables == nil {
+			step.Variables = map[string]string{}
+		}
+		step.Variables[k] = v
+	}
+	return step, nil
+}
+
+// formatWorkflowStep writes a step back in the form parseWorkflowStep accepts
+func formatWorkflowStep(step gogo.WorkflowStep) string {
+	parts := []string{step.Gadget}
+	for _, k := range sortedKeys(step.Variables) {
+		parts = append(parts, quoteWord(k+"="+step.Variables[k]))
+	}
+	if step.ContinueOnError {
+		parts = append(parts, "--continue-on-error")
+	}
+	if step.Capture != "" {
+		parts = append(parts, "--capture", step.Capture)
+	}
+	if step.CaptureField != "" {
+		parts = append(parts, "--capture-field", quoteWord(step.CaptureField))
+	}
+	return strings.Join(parts, " ")
+}
+
+// splitWords splits s on whitespace, keeping single- or double-quoted text together
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// quoteWord quotes w if it would not survive splitWords as a single word
+func quoteWord(w string) string {
+	if w != "" && !strings.ContainsAny(w, " \t\n'\"") {
+		return w
+	}
+	if !strings.Contains(w, "'") {
+		return "'" + w + "'"
+	}
+	return `"` + w + `"`
+}
+
+// printWorkflowStep writes the header shown before a workflow step runs
+func printWorkflowStep(w io.Writer, number, total int, step gogo.WorkflowStep) {
+	fmt.Fprintf(w, "\x1b[1;36m▶ Step %d/%d: %s\x1b[0m\n", number, total, step.Gadget)
+}
+
+// printWorkflowSummary writes each step's status and how long it took
+func printWorkflowSummary(w io.Writer, name string, results []gogo.StepResult) {
+	fmt.Fprintf(w, "\n\x1b[36mWorkflow '%s' summary:\x1b[0m\n", name)
+	for i, r := range results {
+		icon, color := "✅", "\x1b[32m"
+		switch r.Status {
+		case gogo.StepFailed:
+			icon, color = "❌", "\x1b[31m"
+		case gogo.StepContinued:
+			icon, color = "⚠️ ", "\x1b[33m"
+		case gogo.StepSkipped:
+			icon, color = "⏭️ ", "\x1b[90m"
+		}
+		line := fmt.Sprintf("  %s %d. %-20s %-20s", icon, i+1, r.Step.Gadget, r.Status)
+		if r.Status != gogo.StepSkipped {
+			line += fmt.Sprintf(" %8s", r.Duration.Round(time.Millisecond))
+		}
+		if r.Err != nil {
+			line += fmt.Sprintf("  %v", r.Err)
+		}
+		fmt.Fprintln(w, color+line+"\x1b[0m")
+	}
+}